@@ -1,6 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"go-azure/config"
 	"go-azure/controllers"
 	"go-azure/middleware"
@@ -19,6 +27,13 @@ func main() {
 
 	// Load configuration
 	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		logger.WithError(err).Fatal("Invalid configuration")
+	}
+
+	// Cancelled on SIGINT or SIGTERM to stop the background workers and the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Initialize database
 	_, err := utils.InitDatabase(cfg)
@@ -26,18 +41,86 @@ func main() {
 		logger.WithError(err).Fatal("Failed to initialize database")
 	}
 
+	// Initialize the cache backing home timelines
+	utils.InitCache()
+
+	// Initialize media storage
+	blobStore, err := utils.NewBlobStore(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize media storage")
+	}
+
+	// Initialize the store of revoked access tokens
+	revocationStore, err := utils.NewRevocationStore(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize token revocation store")
+	}
+
+	// Initialize the keys access tokens are signed with
+	keyRing, err := utils.NewKeyRing(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize JWT signing keys")
+	}
+
 	// Initialize services
-	authService := services.NewAuthService(cfg)
+	authService := services.NewAuthService(cfg, revocationStore, keyRing, services.NewIdentityProviders(cfg))
+	userService := services.NewUserService()
+	personalAccessTokenService := services.NewPersonalAccessTokenService()
 	taskService := services.NewTaskService()
-	socialMediaService := services.NewSocialMediaService()
+	timelineService := services.NewTimelineService(cfg)
+	streamHub := services.NewStreamHub()
+	notificationService := services.NewNotificationService(streamHub)
+	socialMediaService := services.NewSocialMediaService(cfg, timelineService, notificationService, streamHub)
+	commentService := services.NewCommentService(notificationService, streamHub)
+	reactionService := services.NewReactionService(cfg, notificationService, streamHub)
+	moderationService := services.NewModerationService()
+	followService := services.NewFollowService(timelineService, notificationService)
+	mediaService := services.NewMediaService(cfg, blobStore)
+	tagService := services.NewTagService(cfg)
+	messagingService := services.NewMessagingService(streamHub)
+
+	// Authors with many followers are merged into timelines at read time
+	if err := timelineService.LoadCelebrities(); err != nil {
+		logger.WithError(err).Warn("Failed to load celebrities")
+	}
+
+	// Generate resized image variants in the background
+	go mediaService.StartVariantWorker(ctx)
+
+	// Record notifications in the background
+	go notificationService.StartWorker(ctx)
+
+	// Copy new posts into home timelines in the background
+	go timelineService.StartFanOutWorker(ctx)
+
+	// Purge trashed posts in the background
+	go socialMediaService.StartTrashPurger(ctx)
+
+	// Prune revocations of expired access tokens in the background
+	go authService.StartRevocationPruner(ctx)
+
+	// Rotate the keys access tokens are signed with in the background
+	go authService.StartKeyRotation(ctx)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService)
+	authMiddleware := middleware.NewAuthMiddleware(authService, personalAccessTokenService)
 
 	// Initialize controllers
-	authController := controllers.NewAuthController(authService, cfg)
+	authController := controllers.NewAuthController(authService, userService, authMiddleware, cfg)
+	personalAccessTokenController := controllers.NewPersonalAccessTokenController(personalAccessTokenService, authMiddleware)
 	taskController := controllers.NewTaskController(taskService, authMiddleware)
 	socialMediaController := controllers.NewSocialMediaController(socialMediaService, authMiddleware)
+	commentController := controllers.NewCommentController(commentService, authMiddleware)
+	likeController := controllers.NewLikeController(reactionService, authMiddleware)
+	reactionController := controllers.NewReactionController(reactionService, authMiddleware)
+	adminController := controllers.NewAdminController(moderationService, authMiddleware)
+	followController := controllers.NewFollowController(followService, authMiddleware)
+	feedController := controllers.NewFeedController(timelineService, authMiddleware)
+	mediaController := controllers.NewMediaController(mediaService, authMiddleware)
+	tagController := controllers.NewTagController(tagService, authMiddleware)
+	notificationController := controllers.NewNotificationController(notificationService, authMiddleware)
+	streamController := controllers.NewStreamController(streamHub, authService, authMiddleware, cfg)
+	messagingController := controllers.NewMessagingController(messagingService, authMiddleware)
 
 	// Initialize router
 	router := gin.Default()
@@ -47,7 +130,7 @@ func main() {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", cfg.AppURL)
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -78,8 +161,20 @@ func main() {
 
 	// Register routes
 	authController.RegisterRoutes(router)
+	personalAccessTokenController.RegisterRoutes(router)
 	taskController.RegisterRoutes(router)
 	socialMediaController.RegisterRoutes(router)
+	commentController.RegisterRoutes(router)
+	likeController.RegisterRoutes(router)
+	reactionController.RegisterRoutes(router)
+	adminController.RegisterRoutes(router)
+	followController.RegisterRoutes(router)
+	feedController.RegisterRoutes(router)
+	mediaController.RegisterRoutes(router)
+	tagController.RegisterRoutes(router)
+	notificationController.RegisterRoutes(router)
+	streamController.RegisterRoutes(router)
+	messagingController.RegisterRoutes(router)
 
 	// Add health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -93,8 +188,26 @@ func main() {
 		"port": cfg.Port,
 	}).Info("Server starting")
 
-	if err := router.Run(cfg.Host + ":" + cfg.Port); err != nil {
-		logger.WithError(err).Fatal("Failed to start server")
+	server := &http.Server{
+		Addr:    cfg.Host + ":" + cfg.Port,
+		Handler: router,
+	}
+	// Streams never finish on their own; end them so Shutdown does not wait for them
+	server.RegisterOnShutdown(streamHub.Close)
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.WithError(err).Fatal("Failed to start server")
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Info("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Failed to shut down server gracefully")
 	}
 
 	// Use:
@@ -29,7 +29,11 @@ func main() {
 
 	// Seed database (only in development environment)
 	if os.Getenv("APP_ENV") != "production" {
-		if err := migrations.Seed(db); err != nil {
+		blobStore, err := utils.NewBlobStore(cfg)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to initialize media storage")
+		}
+		if err := migrations.Seed(db, blobStore); err != nil {
 			logger.WithError(err).Fatal("Failed to seed database")
 		}
 	}
@@ -1,14 +1,22 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultJWTSecret is the placeholder JWT_SECRET, which must not be used in production
+const DefaultJWTSecret = "your-secret-key"
+
 // Config holds all configuration for the application
 type Config struct {
+	AppEnv                string
 	Host                  string
 	Port                  string
 	JWTSecret             string
@@ -17,7 +25,65 @@ type Config struct {
 	MicrosoftClientSecret string
 	MicrosoftRedirectURI  string
 	MicrosoftTenantID     string
+	// Microsoft identity platform and Graph API base URLs, overridable to use a fake server
+	MicrosoftAuthorityURL string
+	MicrosoftGraphURL     string
 	AppURL                string
+	AdminEmails           []string
+
+	// A generic OpenID Connect provider is offered as "oidc" when OIDCIssuerURL is set. Its
+	// endpoints and signing keys are discovered from the issuer.
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURI  string
+	OIDCScopes       []string
+
+	// The "dev" provider logs anyone in with the email they ask for, without an external service.
+	// It is only offered when DevLoginEnabled is set outside production.
+	DevLoginEnabled     bool
+	DevLoginRedirectURI string
+
+	// Refresh tokens are single-use and expire RefreshTokenExpirationDays after they are issued
+	RefreshTokenExpirationDays int
+
+	// Access tokens are signed with JWTSigningAlgorithm: RS256 or EdDSA with the newest PEM private
+	// key in JWTKeysDir, or with keys generated at startup and rotated every JWTKeyRotationHours when
+	// no directory is set. HS256 signs with JWTSecret instead.
+	JWTSigningAlgorithm string
+	JWTKeysDir          string
+	JWTKeyRotationHours int
+
+	// Revoked access tokens are remembered in the "database" or in "memory" (single instance only)
+	// until they expire. Expired entries are pruned every TokenRevocationPruneIntervalMinutes.
+	TokenRevocationStore                string
+	TokenRevocationPruneIntervalMinutes int
+
+	// Reaction types users can pick for posts and comments, in display order
+	ReactionTypes []string
+
+	// Deleted posts stay in the author's trash for TrashRetentionDays before being purged
+	TrashRetentionDays        int
+	TrashPurgeIntervalMinutes int
+
+	// Home timelines keep the newest TimelineMaxLength posts. Authors with at least
+	// TimelineCelebrityFollowers followers are merged in at read time instead of fanned out.
+	// Timelines not read for TimelineTTLHours are dropped and rebuilt when read again.
+	TimelineMaxLength          int
+	TimelineCelebrityFollowers int
+	TimelineTTLHours           int
+
+	// Trending tags count the posts created in the last TrendingWindowHours
+	TrendingWindowHours int
+
+	// Uploaded media is stored on the local filesystem ("local") or in Azure Blob Storage ("azure")
+	MediaStorage          string
+	MediaLocalDir         string
+	MediaMaxUploadMB      int
+	AzureStorageAccount   string
+	AzureStorageKey       string
+	AzureStorageContainer string
+	AzureStorageEndpoint  string
 
 	// Database configuration
 	DBHost     string
@@ -34,15 +100,56 @@ func LoadConfig() *Config {
 
 	// Set default values
 	config := &Config{
+		AppEnv:                getEnv("APP_ENV", "development"),
 		Host:                  getEnv("HOST", ""),
 		Port:                  getEnv("PORT", "8080"),
-		JWTSecret:             getEnv("JWT_SECRET", "your-secret-key"),
+		JWTSecret:             getEnv("JWT_SECRET", DefaultJWTSecret),
 		JWTExpirationMinutes:  60, // 1 hour
 		MicrosoftClientID:     getEnv("MICROSOFT_CLIENT_ID", ""),
 		MicrosoftClientSecret: getEnv("MICROSOFT_CLIENT_SECRET", ""),
 		MicrosoftRedirectURI:  getEnv("MICROSOFT_REDIRECT_URI", "http://localhost:8080/auth/microsoft/callback"),
 		MicrosoftTenantID:     getEnv("MICROSOFT_TENANT_ID", "common"),
+		MicrosoftAuthorityURL: getEnv("MICROSOFT_AUTHORITY_URL", "https://login.microsoftonline.com"),
+		MicrosoftGraphURL:     getEnv("MICROSOFT_GRAPH_URL", "https://graph.microsoft.com"),
 		AppURL:                getEnv("APP_URL", "http://localhost:3000"),
+		AdminEmails:           getEnvList("ADMIN_EMAILS", ""),
+
+		OIDCIssuerURL:    strings.TrimSuffix(getEnv("OIDC_ISSUER_URL", ""), "/"),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURI:  getEnv("OIDC_REDIRECT_URI", "http://localhost:8080/auth/oidc/callback"),
+		OIDCScopes:       getEnvList("OIDC_SCOPES", "openid,profile,email"),
+
+		DevLoginEnabled:     getEnv("DEV_LOGIN_ENABLED", "false") == "true",
+		DevLoginRedirectURI: getEnv("DEV_LOGIN_REDIRECT_URI", "http://localhost:8080/auth/dev/callback"),
+
+		RefreshTokenExpirationDays: getEnvInt("REFRESH_TOKEN_EXPIRATION_DAYS", 30),
+
+		JWTSigningAlgorithm: getEnv("JWT_SIGNING_ALGORITHM", "RS256"),
+		JWTKeysDir:          getEnv("JWT_KEYS_DIR", ""),
+		JWTKeyRotationHours: getEnvInt("JWT_KEY_ROTATION_HOURS", 24),
+
+		TokenRevocationStore:                getEnv("TOKEN_REVOCATION_STORE", "database"),
+		TokenRevocationPruneIntervalMinutes: getEnvInt("TOKEN_REVOCATION_PRUNE_INTERVAL_MINUTES", 60),
+
+		ReactionTypes: getEnvList("REACTION_TYPES", "like,love,laugh,sad,angry"),
+
+		TrashRetentionDays:        getEnvInt("TRASH_RETENTION_DAYS", 30),
+		TrashPurgeIntervalMinutes: getEnvInt("TRASH_PURGE_INTERVAL_MINUTES", 60),
+
+		TimelineMaxLength:          getEnvInt("TIMELINE_MAX_LENGTH", 800),
+		TimelineCelebrityFollowers: getEnvInt("TIMELINE_CELEBRITY_FOLLOWERS", 10000),
+		TimelineTTLHours:           getEnvInt("TIMELINE_TTL_HOURS", 168),
+
+		TrendingWindowHours: getEnvInt("TRENDING_WINDOW_HOURS", 24),
+
+		MediaStorage:          getEnv("MEDIA_STORAGE", "local"),
+		MediaLocalDir:         getEnv("MEDIA_LOCAL_DIR", "uploads"),
+		MediaMaxUploadMB:      getEnvInt("MEDIA_MAX_UPLOAD_MB", 10),
+		AzureStorageAccount:   getEnv("AZURE_STORAGE_ACCOUNT", ""),
+		AzureStorageKey:       getEnv("AZURE_STORAGE_KEY", ""),
+		AzureStorageContainer: getEnv("AZURE_STORAGE_CONTAINER", "media"),
+		AzureStorageEndpoint:  getEnv("AZURE_STORAGE_ENDPOINT", ""),
 
 		// Database configuration
 		DBHost:     getEnv("DB_HOST", "localhost"),
@@ -58,6 +165,74 @@ func LoadConfig() *Config {
 	return config
 }
 
+// Validate reports configuration that is unsafe to run with. The trash must keep posts for at
+// least a day, since a retention of 0 or less would purge posts as soon as they are deleted.
+// REACTION_TYPES must include "like", which the like endpoints react with.
+// Production must also not sign tokens with the placeholder secret or with keys generated at
+// startup, which other instances do not share.
+func (c *Config) Validate() error {
+	if c.TrashRetentionDays < 1 {
+		return errors.New("TRASH_RETENTION_DAYS must be at least 1")
+	}
+	if c.TrashPurgeIntervalMinutes < 1 {
+		return errors.New("TRASH_PURGE_INTERVAL_MINUTES must be at least 1")
+	}
+	if !slices.ContainsFunc(c.ReactionTypes, func(reactionType string) bool { return strings.EqualFold(reactionType, "like") }) {
+		return errors.New("REACTION_TYPES must include like")
+	}
+
+	if !c.IsProduction() {
+		return nil
+	}
+
+	switch c.JWTSigningAlgorithm {
+	case "HS256":
+		if c.JWTSecret == DefaultJWTSecret || c.JWTSecret == "" {
+			return errors.New("JWT_SECRET must be set to a secret value in production")
+		}
+	default:
+		if c.JWTKeysDir == "" {
+			return errors.New("JWT_KEYS_DIR must be set in production")
+		}
+	}
+	return nil
+}
+
+// IsProduction reports whether APP_ENV is production
+func (c *Config) IsProduction() bool {
+	return c.AppEnv == "production"
+}
+
+// IsAdminEmail reports whether the email is listed in ADMIN_EMAILS
+func (c *Config) IsAdminEmail(email string) bool {
+	for _, adminEmail := range c.AdminEmails {
+		if strings.EqualFold(adminEmail, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// getEnvInt gets an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList gets a comma separated environment variable as a list or returns the default list
+func getEnvList(key string, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminController handles role management and moderation endpoints
+type AdminController struct {
+	moderationService *services.ModerationService
+	authMiddleware    *middleware.AuthMiddleware
+	logger            *logrus.Logger
+}
+
+// NewAdminController creates a new AdminController
+func NewAdminController(moderationService *services.ModerationService, authMiddleware *middleware.AuthMiddleware) *AdminController {
+	return &AdminController{
+		moderationService: moderationService,
+		authMiddleware:    authMiddleware,
+		logger:            utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the AdminController
+func (c *AdminController) RegisterRoutes(router *gin.Engine) {
+	admin := router.Group("/admin")
+	admin.Use(c.authMiddleware.RequireAuth())
+	{
+		admin.GET("/moderation-actions", c.authMiddleware.RequireRole(models.RoleModerator, models.RoleAdmin), c.GetModerationActions)
+		admin.PUT("/users/:user_id/role", c.authMiddleware.RequireRole(models.RoleAdmin), c.SetUserRole)
+	}
+}
+
+// SetUserRoleRequest is the body of SetUserRole
+type SetUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// SetUserRole changes the role of a user
+// @Summary Change a user's role
+// @Description Sets the role (user, moderator or admin) of a user; admin only
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param role body SetUserRoleRequest true "Role"
+// @Success 200 {object} models.User
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *AdminController) SetUserRole(ctx *gin.Context) {
+	// Get admin ID from context (set by auth middleware)
+	adminID := ctx.GetString("user_id")
+
+	// Get user ID from URL
+	userID := ctx.Param("user_id")
+
+	// Parse request body
+	var request SetUserRoleRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := c.moderationService.SetUserRole(userID, request.Role, adminID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to set user role")
+		switch {
+		case errors.Is(err, services.ErrInvalidRole):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// GetModerationActions lists the moderation log
+// @Summary List moderation actions
+// @Description Lists who removed or edited other users' content and why, newest first; moderators and admins only
+// @Tags Admin
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of entries per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+func (c *AdminController) GetModerationActions(ctx *gin.Context) {
+	// Convert page and limit to integers
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid page parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	response, err := c.moderationService.GetModerationActions(page, limit)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get moderation actions")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
@@ -1,12 +1,16 @@
 package controllers
 
 import (
-	"encoding/json"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"go-azure/config"
+	"go-azure/middleware"
 	"go-azure/services"
 	"go-azure/utils"
 
@@ -16,17 +20,21 @@ import (
 
 // AuthController handles authentication endpoints
 type AuthController struct {
-	authService *services.AuthService
-	logger      *logrus.Logger
-	config      *config.Config
+	authService    *services.AuthService
+	userService    *services.UserService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+	config         *config.Config
 }
 
 // NewAuthController creates a new AuthController
-func NewAuthController(authService *services.AuthService, config *config.Config) *AuthController {
+func NewAuthController(authService *services.AuthService, userService *services.UserService, authMiddleware *middleware.AuthMiddleware, config *config.Config) *AuthController {
 	return &AuthController{
-		authService: authService,
-		logger:      utils.GetLogger(),
-		config:      config,
+		authService:    authService,
+		userService:    userService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+		config:         config,
 	}
 }
 
@@ -34,50 +42,128 @@ func NewAuthController(authService *services.AuthService, config *config.Config)
 func (c *AuthController) RegisterRoutes(router *gin.Engine) {
 	auth := router.Group("/auth")
 	{
-		auth.GET("/microsoft", c.MicrosoftLogin)
-		auth.GET("/microsoft/callback", c.MicrosoftCallback)
-		auth.POST("/signout", c.SignOut)
-		auth.GET("/me", c.GetCurrentUser)
+		auth.GET("/providers", c.GetProviders)
+		auth.GET("/identities", c.authMiddleware.RequireAuth(), c.GetIdentities)
+		auth.GET("/:provider", c.Login)
+		auth.GET("/:provider/callback", c.Callback)
+		auth.POST("/:provider/link", c.authMiddleware.RequireAuth(), c.LinkIdentity)
+		auth.POST("/exchange", c.Exchange)
+		auth.POST("/refresh", c.Refresh)
+		auth.POST("/signout", c.authMiddleware.RequireAuth(), c.SignOut)
+		auth.POST("/signout-all", c.authMiddleware.RequireAuth(), c.SignOutEverywhere)
+		auth.GET("/me", c.authMiddleware.RequireAuth(), c.GetCurrentUser)
+		auth.PATCH("/me", c.authMiddleware.RequireAuth(), c.UpdateCurrentUser)
 	}
+
+	router.GET("/.well-known/jwks.json", c.GetJWKS)
+}
+
+// oauthStateCookie holds the state of the login started by the browser, binding the callback to it
+const oauthStateCookie = "oauth_state"
+
+// GetProviders lists the identity providers users can sign in with
+// @Summary List identity providers
+// @Description Lists the names of the configured identity providers, such as microsoft, oidc and dev
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} gin.H
+func (c *AuthController) GetProviders(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"providers": c.authService.Providers()})
+}
+
+// GetJWKS publishes the public keys access tokens are verified with
+// @Summary Retrieve the JSON Web Key Set
+// @Description Lists the public keys access tokens are signed with, by the kid in the token header. Replaced keys stay listed until the tokens they signed expire. Empty when tokens are signed with HS256.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} utils.JWKS
+func (c *AuthController) GetJWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, c.authService.JWKS())
+}
+
+// Login returns the login URL of an identity provider
+// @Summary Start a login
+// @Description Starts a login with the identity provider and returns the URL to send the user to. The response sets the oauth_state cookie the callback checks, so it must be fetched with credentials.
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Identity provider"
+// @Param login_hint query string false "Email address to sign in with; the dev provider signs in as it"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *AuthController) Login(ctx *gin.Context) {
+	c.startLogin(ctx, "")
+}
+
+// LinkIdentity returns the login URL of an identity provider whose identity is linked to the
+// authenticated user once they log in
+// @Summary Link an identity
+// @Description Starts a login with the identity provider; the identity the user logs in with is linked to the authenticated user, who can then sign in with it too
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Identity provider"
+// @Param login_hint query string false "Email address to sign in with"
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *AuthController) LinkIdentity(ctx *gin.Context) {
+	c.startLogin(ctx, ctx.GetString("user_id"))
 }
 
-// MicrosoftLogin returns Microsoft OAuth login URL
-func (c *AuthController) MicrosoftLogin(ctx *gin.Context) {
-	// Generate state for CSRF protection
-	state, err := c.authService.GenerateState()
+// startLogin starts a login, linking the identity to linkUserID when set
+func (c *AuthController) startLogin(ctx *gin.Context, linkUserID string) {
+	providerName := ctx.Param("provider")
+	provider, err := c.authService.Provider(providerName)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to generate state")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate login"})
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Store state in cookie
-	ctx.SetCookie("oauth_state", state, 3600, "/", "", false, true)
+	// Generate state for CSRF protection, with PKCE and a nonce for the ID token
+	state, loginURL, err := c.authService.StartLogin(providerName, ctx.Query("login_hint"), linkUserID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to start login")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate login"})
+		return
+	}
 
-	// Get Microsoft login URL
-	loginURL := c.authService.GetMicrosoftLoginURL(state)
+	// Store state in a cookie sent back only to the callback. The SPA fetches this URL with
+	// credentials, and Lax cookies are sent on the top-level redirect from the provider.
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oauthStateCookie, state, 600, "/auth/"+providerName, "", secureCookies(provider), true)
 
 	// Return the login URL as JSON
 	ctx.JSON(http.StatusOK, gin.H{"login_url": loginURL})
 }
 
-// MicrosoftCallback handles the callback from Microsoft OAuth
-func (c *AuthController) MicrosoftCallback(ctx *gin.Context) {
-	////Get state from cookie
-	//stateCookie, err := ctx.Cookie("oauth_state")
-	//if err != nil {
-	//	c.logger.WithError(err).Error("Failed to get state cookie")
-	//	ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
-	//	return
-	//}
-	//
-	////Verify state
-	//state := ctx.Query("state")
-	//if state != stateCookie {
-	//	c.logger.Error("State mismatch")
-	//	ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
-	//	return
-	//}
+// Callback handles the callback from an identity provider
+func (c *AuthController) Callback(ctx *gin.Context) {
+	providerName := ctx.Param("provider")
+	provider, err := c.authService.Provider(providerName)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get state from cookie
+	stateCookie, err := ctx.Cookie(oauthStateCookie)
+	if err != nil {
+		c.logger.WithError(err).Warn("Failed to get state cookie")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+
+	// Clear state cookie; each state can be used once
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oauthStateCookie, "", -1, "/auth/"+providerName, "", secureCookies(provider), true)
+
+	// Verify state
+	state := ctx.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(stateCookie)) != 1 {
+		c.logger.Warn("State mismatch")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
 
 	// Get code
 	code := ctx.Query("code")
@@ -88,39 +174,40 @@ func (c *AuthController) MicrosoftCallback(ctx *gin.Context) {
 	}
 
 	// Exchange code for token
-	tokenDetails, user, err := c.authService.HandleMicrosoftCallback(code)
+	tokenDetails, user, err := c.authService.HandleCallback(providerName, code, state, ctx.Request.UserAgent())
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to handle Microsoft callback")
+		c.logger.WithError(err).Error("Failed to handle login callback")
+		switch {
+		case errors.Is(err, services.ErrInvalidOAuthState):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+			return
+		case errors.Is(err, services.ErrInvalidIDToken):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to authenticate"})
+			return
+		case errors.Is(err, services.ErrIdentityLinked), errors.Is(err, services.ErrEmailNotVerified):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
 		return
 	}
 
-	// Clear state cookie
-	//ctx.SetCookie("oauth_state", "", -1, "/", "", false, true)
-
 	// Log successful login
 	c.logger.WithFields(logrus.Fields{
 		"user_id": user.ID,
 		"name":    user.Name,
-		"email":   user.Email,
+		"email":   user.EmailAddress(),
 	}).Info("User logged in")
 
-	// Convert token and user to JSON
-	tokenJSON, err := json.Marshal(tokenDetails)
+	// Hand the tokens over with a short-lived single-use code, so they never appear in a URL
+	loginCode, err := c.authService.CreateLoginCode(tokenDetails, user)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to marshal token")
+		c.logger.WithError(err).Error("Failed to create login code")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
 		return
 	}
 
-	userJSON, err := json.Marshal(user)
-	if err != nil {
-		c.logger.WithError(err).Error("Failed to marshal user")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
-		return
-	}
-
-	// Build redirect URL with token and user data as query parameters
+	// Build redirect URL with the login code as a query parameter
 	redirectURL, err := url.Parse(fmt.Sprintf("%s/login", c.config.AppURL))
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to parse frontend URL")
@@ -129,52 +216,264 @@ func (c *AuthController) MicrosoftCallback(ctx *gin.Context) {
 	}
 
 	query := redirectURL.Query()
-	query.Set("token", string(tokenJSON))
-	query.Set("user", string(userJSON))
+	query.Set("code", loginCode)
 	redirectURL.RawQuery = query.Encode()
 
-	// Redirect to frontend application with token and user data
+	// Redirect to frontend application, which exchanges the code at /auth/exchange
 	ctx.Redirect(http.StatusTemporaryRedirect, redirectURL.String())
 }
 
+// exchangeRequest is the body of a login code exchange request
+type exchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Exchange exchanges the login code from the callback redirect for tokens
+// @Summary Exchange login code
+// @Description Exchanges the single-use code the login callback redirected with for the access token, refresh token and user. Codes expire after one minute.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param exchange body exchangeRequest true "Login code"
+// @Success 200 {object} services.LoginResult
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+func (c *AuthController) Exchange(ctx *gin.Context) {
+	var request exchangeRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := c.authService.ExchangeLoginCode(request.Code)
+	if err != nil {
+		c.logger.WithError(err).Warn("Failed to exchange login code")
+		if errors.Is(err, services.ErrInvalidLoginCode) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange login code"})
+		return
+	}
+
+	// Keep the tokens out of any cache
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, result)
+}
+
+// secureCookies reports whether login cookies must only be sent over HTTPS, which is the case when
+// the provider's callback is served over HTTPS
+func secureCookies(provider services.IdentityProvider) bool {
+	return strings.HasPrefix(provider.RedirectURL(), "https://")
+}
+
+// refreshRequest is the body of a token refresh request
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh exchanges a refresh token for new tokens
+// @Summary Refresh tokens
+// @Description Exchanges a refresh token for a new access token and refresh token. Refresh tokens are single-use; reusing one revokes every token issued from the same login.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param refresh body refreshRequest true "Refresh token"
+// @Success 200 {object} models.TokenDetails
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+func (c *AuthController) Refresh(ctx *gin.Context) {
+	var request refreshRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenDetails, err := c.authService.RefreshTokens(request.RefreshToken)
+	if err != nil {
+		c.logger.WithError(err).Warn("Failed to refresh tokens")
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh tokens"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokenDetails)
+}
+
+// signOutRequest is the optional body of a sign out request
+type signOutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // SignOut handles user sign out
+// @Summary Sign out
+// @Description Revokes the access token used for the request until it expires. When a refresh_token is sent, every refresh token issued from the same login is revoked as well.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param signout body signOutRequest false "Refresh token of this device"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
 func (c *AuthController) SignOut(ctx *gin.Context) {
-	// In a stateless JWT authentication system, the client is responsible for
-	// discarding the token. The server doesn't need to do anything special.
-	// However, in a real application, you might want to blacklist the token.
+	userID := ctx.GetString("user_id")
 
-	// Get user ID from context (set by auth middleware)
-	userID, exists := ctx.Get("user_id")
-	if exists {
-		c.logger.WithFields(logrus.Fields{
-			"user_id": userID,
-		}).Info("User signed out")
+	// The body is optional
+	var request signOutRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			c.logger.WithError(err).Error("Failed to parse request body")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := c.authService.SignOut(userID, ctx.GetString("jti"), ctx.GetTime("token_expires_at"), request.RefreshToken)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out"})
+		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Successfully signed out"})
 }
 
+// signOutEverywhereRequest is the optional body of a request signing out every session
+type signOutEverywhereRequest struct {
+	Before *time.Time `json:"before"`
+}
+
+// SignOutEverywhere signs the user out of every session
+// @Summary Sign out everywhere
+// @Description Revokes every access token and refresh token issued to the authenticated user at or before the given RFC 3339 time, or now when no time is given, including the token used for the request.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param signout body signOutEverywhereRequest false "Sessions started at or before this time are signed out"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+func (c *AuthController) SignOutEverywhere(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	// The body is optional
+	var request signOutEverywhereRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			c.logger.WithError(err).Error("Failed to parse request body")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var before time.Time
+	if request.Before != nil {
+		before = *request.Before
+	}
+
+	revokedBefore, err := c.authService.SignOutEverywhere(userID, before)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "Successfully signed out everywhere",
+		"revoked_before": revokedBefore,
+	})
+}
+
+// GetIdentities lists the identities linked to the authenticated user
+// @Summary List linked identities
+// @Description Lists the identity provider accounts the authenticated user can sign in with
+// @Tags Auth
+// @Produce json
+// @Success 200 {array} models.UserIdentity
+// @Failure 401 {object} gin.H
+func (c *AuthController) GetIdentities(ctx *gin.Context) {
+	identities, err := c.authService.GetIdentities(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get identities"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// GetCurrentUser retrieves the authenticated user's profile
+// @Summary Retrieve the current user
+// @Description Fetches the authenticated user's profile from the database, with their avatar URL and post and follow counts
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} models.User
+// @Failure 401 {object} gin.H
+// @Failure 404 {object} gin.H
 func (c *AuthController) GetCurrentUser(ctx *gin.Context) {
-	// Get user info from context (set by auth middleware)
 	userID := ctx.GetString("user_id")
-	name := ctx.GetString("name")
-	email := ctx.GetString("email")
 
-	if userID == "" {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	user, err := c.userService.GetProfile(userID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get current user")
+		ctx.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// Log successful login
-	c.logger.WithFields(logrus.Fields{
-		"user_id": userID,
-		"name":    name,
-		"email":   email,
-	}).Info("User logged in")
+	ctx.JSON(http.StatusOK, gin.H{"user": user})
+}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"user_id": userID,
-		"name":    name,
-		"email":   email,
+// updateProfileRequest is the body of a profile update. Omitted fields are left unchanged.
+type updateProfileRequest struct {
+	Name          *string `json:"name"`
+	Bio           *string `json:"bio"`
+	AvatarMediaID *string `json:"avatar_media_id"`
+}
+
+// UpdateCurrentUser edits the authenticated user's profile
+// @Summary Update the current user
+// @Description Changes the authenticated user's display name, bio or avatar. An edited name is kept instead of the Microsoft display name on later logins. The avatar is the media_id of an image the user uploaded, or an empty string to remove it.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param profile body updateProfileRequest true "Profile fields to change"
+// @Success 200 {object} models.User
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+func (c *AuthController) UpdateCurrentUser(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	var request updateProfileRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := c.userService.UpdateProfile(userID, services.ProfileUpdate{
+		Name:          request.Name,
+		Bio:           request.Bio,
+		AvatarMediaID: request.AvatarMediaID,
 	})
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to update profile")
+		ctx.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// profileErrorStatus maps user service errors to HTTP status codes
+func profileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidName), errors.Is(err, services.ErrBioTooLong), errors.Is(err, services.ErrMediaNotFound):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
 }
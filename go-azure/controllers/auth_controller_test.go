@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"go-azure/config"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCallbackRejectsStateCookieMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	utils.InitCache()
+
+	// Any request reaching the identity provider means the callback went past the state check
+	var providerRequests atomic.Int32
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		providerRequests.Add(1)
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}))
+	defer fake.Close()
+
+	cfg := &config.Config{
+		MicrosoftClientID:     "test-client",
+		MicrosoftRedirectURI:  "http://localhost/auth/microsoft/callback",
+		MicrosoftTenantID:     "common",
+		MicrosoftAuthorityURL: fake.URL,
+		MicrosoftGraphURL:     fake.URL,
+		AppURL:                "http://localhost:3000",
+	}
+	authService := services.NewAuthService(cfg, nil, nil, map[string]services.IdentityProvider{
+		services.ProviderMicrosoft: services.NewMicrosoftProvider(cfg),
+	})
+	controller := NewAuthController(authService, nil, nil, cfg)
+	router := gin.New()
+	router.GET("/auth/:provider/callback", controller.Callback)
+
+	state, _, err := authService.StartLogin(services.ProviderMicrosoft, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherState, _, err := authService.StartLogin(services.ProviderMicrosoft, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+	}{
+		{name: "no cookie", state: state},
+		{name: "cookie of another login", cookie: otherState, state: state},
+		{name: "no state", cookie: state},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := url.Values{"code": {"code"}}
+			if test.state != "" {
+				query.Set("state", test.state)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/auth/microsoft/callback?"+query.Encode(), nil)
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: test.cookie})
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	if n := providerRequests.Load(); n != 0 {
+		t.Errorf("identity provider was called %d times, want 0", n)
+	}
+}
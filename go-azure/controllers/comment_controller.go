@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// CommentController handles comment endpoints
+type CommentController struct {
+	commentService *services.CommentService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewCommentController creates a new CommentController
+func NewCommentController(commentService *services.CommentService, authMiddleware *middleware.AuthMiddleware) *CommentController {
+	return &CommentController{
+		commentService: commentService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the CommentController
+func (c *CommentController) RegisterRoutes(router *gin.Engine) {
+	comments := router.Group("/posts/:post_id/comments")
+	comments.Use(c.authMiddleware.RequireAuth(models.ResourcePosts))
+	{
+		comments.GET("", c.GetComments)
+		comments.POST("", c.CreateComment)
+		comments.GET("/:comment_id/replies", c.GetReplies)
+		comments.PUT("/:comment_id", c.UpdateComment)
+		comments.DELETE("/:comment_id", c.DeleteComment)
+	}
+}
+
+// GetComments retrieves the comments of a post
+// @Summary Retrieve comments of a post
+// @Description Fetches the top-level comments of a post with pagination, oldest first. Each comment includes the first replies of its thread, a few levels deep; load the rest with the replies endpoint.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of top-level comments per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *CommentController) GetComments(ctx *gin.Context) {
+	// Get post ID from URL
+	postID := ctx.Param("post_id")
+
+	// Convert page and limit to integers
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid page parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	// Get comments
+	response, err := c.commentService.GetCommentsByPostID(postID, page, limit, ctx.GetString("user_id"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get comments")
+		ctx.JSON(commentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetReplies retrieves the replies to a comment
+// @Summary Retrieve replies to a comment
+// @Description Fetches the direct replies to a comment, oldest first, each with the first replies of its own thread. Pass a comment's replies_cursor, or next_cursor of the previous page, to continue.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Param comment_id path string true "Comment ID"
+// @Param cursor query string false "Cursor to continue after"
+// @Param limit query int false "Number of replies per page" default(20)
+// @Success 200 {object} services.CommentRepliesPage
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *CommentController) GetReplies(ctx *gin.Context) {
+	// Get post and comment IDs from URL
+	postID := ctx.Param("post_id")
+	commentID := ctx.Param("comment_id")
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	// Get replies
+	page, err := c.commentService.GetReplies(postID, commentID, ctx.Query("cursor"), limit, ctx.GetString("user_id"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get replies")
+		ctx.JSON(commentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// CreateComment adds a comment to a post
+// @Summary Create a comment
+// @Description Adds a comment to a post as the authenticated user. Set parent_comment_id to reply to another comment of the post; replies can be nested up to 5 levels deep.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Param comment body models.SocialMediaComments true "Comment"
+// @Success 201 {object} models.SocialMediaComments
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *CommentController) CreateComment(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post ID from URL
+	postID := ctx.Param("post_id")
+
+	// Parse request body
+	var comment models.SocialMediaComments
+	if err := ctx.ShouldBindJSON(&comment); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create comment
+	createdComment, err := c.commentService.CreateComment(postID, &comment, userID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to create comment")
+		ctx.JSON(commentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"comment": createdComment})
+}
+
+// UpdateComment edits a comment
+// @Summary Update a comment
+// @Description Edits a comment; only its author or a moderator may do so
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Param comment_id path string true "Comment ID"
+// @Param comment body models.SocialMediaComments true "Updated Comment"
+// @Success 200 {object} models.SocialMediaComments
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *CommentController) UpdateComment(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post and comment IDs from URL
+	postID := ctx.Param("post_id")
+	commentID := ctx.Param("comment_id")
+
+	// Parse request body
+	var comment models.SocialMediaComments
+	if err := ctx.ShouldBindJSON(&comment); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update comment
+	updatedComment, err := c.commentService.UpdateComment(postID, commentID, &comment, userID, ctx.GetString("role"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to update comment")
+		ctx.JSON(commentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"comment": updatedComment})
+}
+
+// DeleteComment deletes a comment
+// @Summary Delete a comment
+// @Description Deletes a comment; only its author or a moderator may do so. A comment with replies is replaced by a "[deleted]" placeholder so the replies stay visible.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Param comment_id path string true "Comment ID"
+// @Param reason query string false "Reason, required when a moderator removes someone else's comment"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *CommentController) DeleteComment(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post and comment IDs from URL
+	postID := ctx.Param("post_id")
+	commentID := ctx.Param("comment_id")
+
+	// Delete comment; moderators removing someone else's comment must give a reason
+	err := c.commentService.DeleteComment(postID, commentID, userID, ctx.GetString("role"), ctx.Query("reason"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to delete comment")
+		ctx.JSON(commentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// commentErrorStatus maps comment service errors to HTTP status codes
+func commentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPostNotFound), errors.Is(err, services.ErrCommentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCommentForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrModerationReasonRequired), errors.Is(err, services.ErrParentCommentNotFound),
+		errors.Is(err, services.ErrCommentTooDeep), errors.Is(err, utils.ErrInvalidCursor):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
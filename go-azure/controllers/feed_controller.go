@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// FeedController handles personalized feed endpoints
+type FeedController struct {
+	timelineService *services.TimelineService
+	authMiddleware  *middleware.AuthMiddleware
+	logger          *logrus.Logger
+}
+
+// NewFeedController creates a new FeedController
+func NewFeedController(timelineService *services.TimelineService, authMiddleware *middleware.AuthMiddleware) *FeedController {
+	return &FeedController{
+		timelineService: timelineService,
+		authMiddleware:  authMiddleware,
+		logger:          utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the FeedController
+func (c *FeedController) RegisterRoutes(router *gin.Engine) {
+	feed := router.Group("/feed")
+	feed.Use(c.authMiddleware.RequireAuth(models.ResourcePosts))
+	{
+		feed.GET("/home", c.GetHomeFeed)
+	}
+}
+
+// GetHomeFeed retrieves the authenticated user's home timeline
+// @Summary Retrieve the home timeline
+// @Description Fetches posts from the users the authenticated user follows plus their own posts, newest first. Without cursor the response is a numbered page like GET /posts; with cursor (empty for the first page) it is a PostFeedPage read from the materialized timeline.
+// @Tags Feed
+// @Produce json
+// @Param page query int false "Page number, when cursor is not sent" default(1)
+// @Param cursor query string false "Cursor returned as next_cursor by a previous call; send it empty for the first page"
+// @Param limit query int false "Number of posts per page" default(10)
+// @Success 200 {object} services.PostFeedPage
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+func (c *FeedController) GetHomeFeed(ctx *gin.Context) {
+	// USAGE: http://localhost:8080/feed/home?page=1&limit=10
+	// USAGE: http://localhost:8080/feed/home?limit=10&cursor=<next_cursor>
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	cursor, useCursor := ctx.GetQuery("cursor")
+	if !useCursor {
+		pageNum, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+		if err != nil {
+			c.logger.WithError(err).Error("Invalid page parameter")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
+			return
+		}
+
+		response, err := c.timelineService.GetHomeFeedPage(userID, pageNum, limit)
+		if err != nil {
+			c.logger.WithError(err).Error("Failed to get home feed")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+
+	page, err := c.timelineService.GetHomeTimeline(userID, cursor, limit)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get home feed")
+		if errors.Is(err, utils.ErrInvalidCursor) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-azure/middleware"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// FollowController handles follow graph endpoints
+type FollowController struct {
+	followService  *services.FollowService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewFollowController creates a new FollowController
+func NewFollowController(followService *services.FollowService, authMiddleware *middleware.AuthMiddleware) *FollowController {
+	return &FollowController{
+		followService:  followService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the FollowController
+func (c *FollowController) RegisterRoutes(router *gin.Engine) {
+	users := router.Group("/users/:user_id")
+	users.Use(c.authMiddleware.RequireAuth())
+	{
+		users.POST("/follow", c.Follow)
+		users.DELETE("/follow", c.Unfollow)
+		users.GET("/followers", c.GetFollowers)
+		users.GET("/following", c.GetFollowing)
+		users.GET("/follow-counts", c.GetFollowCounts)
+	}
+}
+
+// Follow follows a user
+// @Summary Follow a user
+// @Description The authenticated user follows the user; following twice has no effect
+// @Tags Follows
+// @Produce json
+// @Param user_id path string true "User ID to follow"
+// @Success 200 {object} services.FollowCounts
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *FollowController) Follow(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	counts, err := c.followService.Follow(userID, ctx.Param("user_id"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to follow user")
+		ctx.JSON(followErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, counts)
+}
+
+// Unfollow unfollows a user
+// @Summary Unfollow a user
+// @Description The authenticated user stops following the user; unfollowing twice has no effect
+// @Tags Follows
+// @Produce json
+// @Param user_id path string true "User ID to unfollow"
+// @Success 200 {object} services.FollowCounts
+// @Failure 404 {object} gin.H
+func (c *FollowController) Unfollow(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	counts, err := c.followService.Unfollow(userID, ctx.Param("user_id"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to unfollow user")
+		ctx.JSON(followErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, counts)
+}
+
+// GetFollowCounts returns follower and followee counts of a user
+// @Summary Get follow counts
+// @Description Returns how many followers and followees a user has and whether the authenticated user follows them
+// @Tags Follows
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 200 {object} services.FollowCounts
+// @Failure 404 {object} gin.H
+func (c *FollowController) GetFollowCounts(ctx *gin.Context) {
+	counts, err := c.followService.GetFollowCounts(ctx.Param("user_id"), ctx.GetString("user_id"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get follow counts")
+		ctx.JSON(followErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, counts)
+}
+
+// GetFollowers lists the followers of a user
+// @Summary List followers
+// @Description Lists the users following a user, most recent first
+// @Tags Follows
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of users per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *FollowController) GetFollowers(ctx *gin.Context) {
+	page, limit, ok := c.pagination(ctx)
+	if !ok {
+		return
+	}
+
+	response, err := c.followService.GetFollowers(ctx.Param("user_id"), page, limit)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get followers")
+		ctx.JSON(followErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetFollowing lists the users a user follows
+// @Summary List followees
+// @Description Lists the users a user follows, most recent first
+// @Tags Follows
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of users per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *FollowController) GetFollowing(ctx *gin.Context) {
+	page, limit, ok := c.pagination(ctx)
+	if !ok {
+		return
+	}
+
+	response, err := c.followService.GetFollowing(ctx.Param("user_id"), page, limit)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get followees")
+		ctx.JSON(followErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// pagination reads the page and limit query parameters, writing a 400 response when they are invalid
+func (c *FollowController) pagination(ctx *gin.Context) (int, int, bool) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid page parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
+		return 0, 0, false
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return 0, 0, false
+	}
+
+	return page, limit, true
+}
+
+// followErrorStatus maps follow service errors to HTTP status codes
+func followErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCannotFollowSelf):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// LikeController handles post like endpoints. A like is a reaction of type "like".
+type LikeController struct {
+	reactionService *services.ReactionService
+	authMiddleware  *middleware.AuthMiddleware
+	logger          *logrus.Logger
+}
+
+// NewLikeController creates a new LikeController
+func NewLikeController(reactionService *services.ReactionService, authMiddleware *middleware.AuthMiddleware) *LikeController {
+	return &LikeController{
+		reactionService: reactionService,
+		authMiddleware:  authMiddleware,
+		logger:          utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the LikeController
+func (c *LikeController) RegisterRoutes(router *gin.Engine) {
+	like := router.Group("/posts/:post_id/like")
+	like.Use(c.authMiddleware.RequireAuth(models.ResourcePosts))
+	{
+		like.POST("", c.LikePost)
+		like.DELETE("", c.UnlikePost)
+	}
+}
+
+// LikePost likes a post
+// @Summary Like a post
+// @Description Likes a post as the authenticated user, replacing any other reaction; liking twice has no effect
+// @Tags Likes
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} gin.H
+func (c *LikeController) LikePost(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post ID from URL
+	postID := ctx.Param("post_id")
+
+	post, err := c.reactionService.ReactToPost(postID, userID, models.ReactionLike)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to like post")
+		ctx.JSON(reactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"post_id":    post.PostID,
+		"like_count": post.LikeCount,
+		"is_liked":   post.IsLiked,
+	})
+}
+
+// UnlikePost removes a like from a post
+// @Summary Unlike a post
+// @Description Removes the authenticated user's like from a post; other reactions are kept and unliking twice has no effect
+// @Tags Likes
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} gin.H
+func (c *LikeController) UnlikePost(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post ID from URL
+	postID := ctx.Param("post_id")
+
+	post, err := c.reactionService.RemovePostReaction(postID, userID, models.ReactionLike)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to unlike post")
+		ctx.JSON(reactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"post_id":    post.PostID,
+		"like_count": post.LikeCount,
+		"is_liked":   post.IsLiked,
+	})
+}
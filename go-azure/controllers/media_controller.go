@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// multipartOverhead leaves room for the multipart boundaries and headers around the file
+const multipartOverhead = 1 << 20
+
+// MediaController handles image upload and download endpoints
+type MediaController struct {
+	mediaService   *services.MediaService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewMediaController creates a new MediaController
+func NewMediaController(mediaService *services.MediaService, authMiddleware *middleware.AuthMiddleware) *MediaController {
+	return &MediaController{
+		mediaService:   mediaService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the MediaController
+func (c *MediaController) RegisterRoutes(router *gin.Engine) {
+	media := router.Group("/media")
+	{
+		// Public so images can be loaded by <img> tags; media IDs are random UUIDs
+		media.GET("/:media_id", c.GetMedia)
+		media.GET("/:media_id/:width", c.GetMedia)
+		media.POST("", c.authMiddleware.RequireAuth(models.ResourcePosts), c.UploadMedia)
+	}
+}
+
+// UploadMedia uploads an image
+// @Summary Upload an image
+// @Description Uploads a JPEG, PNG or GIF image as multipart form field "file". Metadata such as EXIF is removed. Reference the returned media_id from a post.
+// @Tags Media
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Image"
+// @Success 201 {object} models.Media
+// @Failure 400 {object} gin.H
+// @Failure 413 {object} gin.H
+// @Failure 415 {object} gin.H
+func (c *MediaController) UploadMedia(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, c.mediaService.MaxUploadBytes()+multipartOverhead)
+
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to read uploaded file")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrMediaTooLarge.Error()})
+			return
+		}
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A file must be uploaded in the \"file\" field"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to open uploaded file")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	media, err := c.mediaService.UploadMedia(file, userID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to upload media")
+		switch {
+		case errors.Is(err, services.ErrMediaTooLarge):
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUnsupportedMediaType):
+			ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"media": media})
+}
+
+// GetMedia serves an uploaded image or one of its resized variants
+// @Summary Download an image
+// @Description Serves an uploaded image, or its resized variant when a width is given. Supports Range requests and conditional requests with If-None-Match.
+// @Tags Media
+// @Produce image/jpeg,image/png,image/gif
+// @Param media_id path string true "Media ID"
+// @Param width path int false "Width of a resized variant, as listed in a post's image.variants"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Success 304
+// @Failure 404 {object} gin.H
+func (c *MediaController) GetMedia(ctx *gin.Context) {
+	width := 0
+	if widthParam := ctx.Param("width"); widthParam != "" {
+		var err error
+		width, err = strconv.Atoi(widthParam)
+		if err != nil || width <= 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": services.ErrMediaNotFound.Error()})
+			return
+		}
+	}
+
+	media, file, err := c.mediaService.OpenMedia(ctx.Param("media_id"), width)
+	if err != nil {
+		if errors.Is(err, services.ErrMediaNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to open media")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	// Media never changes once uploaded, so it can be cached for good
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", media.ContentType)
+	header.Set("ETag", `"`+media.Checksum+`"`)
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	header.Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent handles Range, If-Range and If-None-Match
+	http.ServeContent(ctx.Writer, ctx.Request, "", media.CreatedAt, file)
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// MessagingController handles direct message endpoints
+type MessagingController struct {
+	messagingService *services.MessagingService
+	authMiddleware   *middleware.AuthMiddleware
+	logger           *logrus.Logger
+}
+
+// NewMessagingController creates a new MessagingController
+func NewMessagingController(messagingService *services.MessagingService, authMiddleware *middleware.AuthMiddleware) *MessagingController {
+	return &MessagingController{
+		messagingService: messagingService,
+		authMiddleware:   authMiddleware,
+		logger:           utils.GetLogger(),
+	}
+}
+
+// startConversationRequest is the body of a request starting a conversation
+type startConversationRequest struct {
+	ParticipantIDs []string `json:"participant_ids" binding:"required,min=1"`
+	Title          string   `json:"title"`
+}
+
+// markReadRequest is the optional body of a request marking a conversation as read
+type markReadRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+// RegisterRoutes registers the routes for the MessagingController
+func (c *MessagingController) RegisterRoutes(router *gin.Engine) {
+	conversations := router.Group("/conversations")
+	conversations.Use(c.authMiddleware.RequireAuth())
+	{
+		conversations.GET("", c.GetConversations)
+		conversations.POST("", c.StartConversation)
+		conversations.GET("/:conversation_id", c.GetConversation)
+		conversations.GET("/:conversation_id/messages", c.GetMessages)
+		conversations.POST("/:conversation_id/messages", c.SendMessage)
+		conversations.POST("/:conversation_id/read", c.MarkRead)
+	}
+}
+
+// GetConversations retrieves the user's conversations
+// @Summary Retrieve conversations
+// @Description Fetches the authenticated user's conversations, most recently active first, using an opaque cursor. Each has its participants, last message and unread count.
+// @Tags Messages
+// @Produce json
+// @Param cursor query string false "Cursor returned as next_cursor by a previous call"
+// @Param limit query int false "Number of conversations per page" default(20)
+// @Success 200 {object} services.ConversationPage
+// @Failure 400 {object} gin.H
+func (c *MessagingController) GetConversations(ctx *gin.Context) {
+	// USAGE: http://localhost:8080/conversations?limit=20&cursor=<next_cursor>
+	userID := ctx.GetString("user_id")
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	page, err := c.messagingService.GetConversations(userID, ctx.Query("cursor"), limit)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get conversations")
+		if errors.Is(err, utils.ErrInvalidCursor) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversations"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// StartConversation starts a conversation
+// @Summary Start a conversation
+// @Description Starts a conversation with one other user, or a group conversation with up to 19 others. Starting a 1:1 conversation that already exists returns it.
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Param conversation body startConversationRequest true "Participants and optional group title"
+// @Success 200 {object} models.Conversation
+// @Success 201 {object} models.Conversation
+// @Failure 400 {object} gin.H
+func (c *MessagingController) StartConversation(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	var request startConversationRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conversation, created, err := c.messagingService.StartConversation(userID, request.ParticipantIDs, request.Title)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to start conversation")
+		ctx.JSON(messagingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	ctx.JSON(status, gin.H{"conversation": conversation})
+}
+
+// GetConversation retrieves a conversation
+// @Summary Retrieve a conversation
+// @Description Fetches a conversation with its participants and their read receipts. Only participants may read it.
+// @Tags Messages
+// @Produce json
+// @Param conversation_id path string true "Conversation ID"
+// @Success 200 {object} models.Conversation
+// @Failure 404 {object} gin.H
+func (c *MessagingController) GetConversation(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	conversation, err := c.messagingService.GetConversation(ctx.Param("conversation_id"), userID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get conversation")
+		ctx.JSON(messagingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"conversation": conversation})
+}
+
+// GetMessages retrieves the messages of a conversation
+// @Summary Retrieve messages
+// @Description Fetches the messages of a conversation, newest first, using an opaque cursor. Only participants may read them.
+// @Tags Messages
+// @Produce json
+// @Param conversation_id path string true "Conversation ID"
+// @Param cursor query string false "Cursor returned as next_cursor by a previous call"
+// @Param limit query int false "Number of messages per page" default(50)
+// @Success 200 {object} services.MessagePage
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *MessagingController) GetMessages(ctx *gin.Context) {
+	// USAGE: http://localhost:8080/conversations/<id>/messages?limit=50&cursor=<next_cursor>
+	userID := ctx.GetString("user_id")
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	page, err := c.messagingService.GetMessages(ctx.Param("conversation_id"), userID, ctx.Query("cursor"), limit)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get messages")
+		ctx.JSON(messagingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// SendMessage sends a message to a conversation
+// @Summary Send a message
+// @Description Sends a message to a conversation the authenticated user participates in
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Param conversation_id path string true "Conversation ID"
+// @Param message body models.Message true "Message"
+// @Success 201 {object} models.Message
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *MessagingController) SendMessage(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	var message models.Message
+	if err := ctx.ShouldBindJSON(&message); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sentMessage, err := c.messagingService.SendMessage(ctx.Param("conversation_id"), userID, &message)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to send message")
+		ctx.JSON(messagingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"message": sentMessage})
+}
+
+// MarkRead records a read receipt
+// @Summary Mark a conversation as read
+// @Description Marks a conversation as read up to a message, or up to its latest message when no message_id is given. Read receipts never move backwards.
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Param conversation_id path string true "Conversation ID"
+// @Param receipt body markReadRequest false "Last message read"
+// @Success 200 {object} services.ConversationReadEvent
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *MessagingController) MarkRead(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	// The body is optional
+	var request markReadRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			c.logger.WithError(err).Error("Failed to parse request body")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	receipt, err := c.messagingService.MarkRead(ctx.Param("conversation_id"), userID, request.MessageID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to mark conversation as read")
+		ctx.JSON(messagingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, receipt)
+}
+
+// messagingErrorStatus maps messaging service errors to HTTP status codes
+func messagingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrConversationNotFound), errors.Is(err, services.ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidParticipants), errors.Is(err, services.ErrUnknownParticipant),
+		errors.Is(err, services.ErrInvalidMessage), errors.Is(err, utils.ErrInvalidCursor):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-azure/middleware"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// NotificationController handles notification endpoints
+type NotificationController struct {
+	notificationService *services.NotificationService
+	authMiddleware      *middleware.AuthMiddleware
+	logger              *logrus.Logger
+}
+
+// NewNotificationController creates a new NotificationController
+func NewNotificationController(notificationService *services.NotificationService, authMiddleware *middleware.AuthMiddleware) *NotificationController {
+	return &NotificationController{
+		notificationService: notificationService,
+		authMiddleware:      authMiddleware,
+		logger:              utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the NotificationController
+func (c *NotificationController) RegisterRoutes(router *gin.Engine) {
+	notifications := router.Group("/notifications")
+	notifications.Use(c.authMiddleware.RequireAuth())
+	{
+		notifications.GET("", c.GetNotifications)
+		notifications.GET("/unread-count", c.GetUnreadCount)
+		notifications.POST("/read-all", c.MarkAllRead)
+		notifications.POST("/:notification_id/read", c.MarkRead)
+	}
+}
+
+// GetNotifications retrieves the user's notifications
+// @Summary Retrieve notifications
+// @Description Fetches the authenticated user's notifications, most recently updated first, using an opaque cursor. Repeated events on the same target are grouped into one notification.
+// @Tags Notifications
+// @Produce json
+// @Param cursor query string false "Cursor returned as next_cursor by a previous call"
+// @Param limit query int false "Number of notifications per page" default(20)
+// @Param unread_only query bool false "Only list unread notifications"
+// @Success 200 {object} services.NotificationPage
+// @Failure 400 {object} gin.H
+func (c *NotificationController) GetNotifications(ctx *gin.Context) {
+	// USAGE: http://localhost:8080/notifications?limit=20&cursor=<next_cursor>&unread_only=true
+	userID := ctx.GetString("user_id")
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	unreadOnly, err := strconv.ParseBool(ctx.DefaultQuery("unread_only", "false"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid unread_only parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unread_only parameter"})
+		return
+	}
+
+	page, err := c.notificationService.GetNotifications(userID, ctx.Query("cursor"), limit, unreadOnly)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get notifications")
+		if errors.Is(err, utils.ErrInvalidCursor) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// GetUnreadCount retrieves the number of unread notifications
+// @Summary Count unread notifications
+// @Description Returns the number of unread notifications of the authenticated user
+// @Tags Notifications
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+func (c *NotificationController) GetUnreadCount(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	count, err := c.notificationService.GetUnreadCount(userID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to count unread notifications")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count unread notifications"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"unread_count": count})
+}
+
+// MarkRead marks a notification as read
+// @Summary Mark a notification as read
+// @Description Marks one of the authenticated user's notifications as read; marking it twice has no effect
+// @Tags Notifications
+// @Produce json
+// @Param notification_id path string true "Notification ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} gin.H
+func (c *NotificationController) MarkRead(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	if err := c.notificationService.MarkRead(userID, ctx.Param("notification_id")); err != nil {
+		c.logger.WithError(err).Error("Failed to mark notification as read")
+		ctx.JSON(notificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+// MarkAllRead marks all notifications as read
+// @Summary Mark all notifications as read
+// @Description Marks all of the authenticated user's notifications as read
+// @Tags Notifications
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+func (c *NotificationController) MarkAllRead(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	count, err := c.notificationService.MarkAllRead(userID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to mark notifications as read")
+		ctx.JSON(notificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"marked_read": count})
+}
+
+// notificationErrorStatus maps notification service errors to HTTP status codes
+func notificationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrNotificationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, utils.ErrInvalidCursor):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
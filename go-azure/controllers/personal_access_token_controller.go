@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-azure/middleware"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// PersonalAccessTokenController handles personal access token endpoints
+type PersonalAccessTokenController struct {
+	tokenService   *services.PersonalAccessTokenService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewPersonalAccessTokenController creates a new PersonalAccessTokenController
+func NewPersonalAccessTokenController(tokenService *services.PersonalAccessTokenService, authMiddleware *middleware.AuthMiddleware) *PersonalAccessTokenController {
+	return &PersonalAccessTokenController{
+		tokenService:   tokenService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// createTokenRequest is the body of a request creating a personal access token
+type createTokenRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// RegisterRoutes registers the routes for the PersonalAccessTokenController. Personal access
+// tokens cannot be used to manage tokens.
+func (c *PersonalAccessTokenController) RegisterRoutes(router *gin.Engine) {
+	tokens := router.Group("/auth/tokens")
+	tokens.Use(c.authMiddleware.RequireAuth())
+	{
+		tokens.GET("", c.GetTokens)
+		tokens.POST("", c.CreateToken)
+		tokens.DELETE("/:token_id", c.RevokeToken)
+	}
+}
+
+// GetTokens lists the user's personal access tokens
+// @Summary List personal access tokens
+// @Description Lists the authenticated user's personal access tokens, newest first, with their scopes, expiry and when they were last used. The tokens themselves are not shown.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} gin.H
+func (c *PersonalAccessTokenController) GetTokens(ctx *gin.Context) {
+	tokens, err := c.tokenService.GetTokens(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get personal access tokens"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateToken creates a personal access token
+// @Summary Create a personal access token
+// @Description Creates a personal access token for scripts and integrations, sent as "Authorization: Bearer pat_...". The token is returned only in this response.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param token body createTokenRequest true "Name, scopes and optional expiry"
+// @Success 201 {object} services.CreatedPersonalAccessToken
+// @Failure 400 {object} gin.H
+func (c *PersonalAccessTokenController) CreateToken(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	var request createTokenRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := c.tokenService.CreateToken(userID, request.Name, request.Scopes, request.ExpiresAt)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to create personal access token")
+		ctx.JSON(tokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// The token cannot be shown again, so it must not be cached anywhere
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusCreated, gin.H{"token": token})
+}
+
+// RevokeToken revokes a personal access token
+// @Summary Revoke a personal access token
+// @Description Deletes one of the authenticated user's personal access tokens. Requests made with it fail from then on.
+// @Tags Auth
+// @Produce json
+// @Param token_id path string true "Token ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *PersonalAccessTokenController) RevokeToken(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+
+	if err := c.tokenService.RevokeToken(userID, ctx.Param("token_id")); err != nil {
+		c.logger.WithError(err).Error("Failed to revoke personal access token")
+		ctx.JSON(tokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Personal access token revoked"})
+}
+
+// tokenErrorStatus maps personal access token service errors to HTTP status codes
+func tokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPersonalAccessTokenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidTokenName), errors.Is(err, services.ErrInvalidScopes),
+		errors.Is(err, services.ErrInvalidTokenExpiry):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTooManyTokens):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
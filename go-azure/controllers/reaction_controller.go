@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ReactionController handles reaction endpoints for posts and comments
+type ReactionController struct {
+	reactionService *services.ReactionService
+	authMiddleware  *middleware.AuthMiddleware
+	logger          *logrus.Logger
+}
+
+// NewReactionController creates a new ReactionController
+func NewReactionController(reactionService *services.ReactionService, authMiddleware *middleware.AuthMiddleware) *ReactionController {
+	return &ReactionController{
+		reactionService: reactionService,
+		authMiddleware:  authMiddleware,
+		logger:          utils.GetLogger(),
+	}
+}
+
+// reactionRequest is the body of a request setting a reaction
+type reactionRequest struct {
+	Type string `json:"type" binding:"required"`
+}
+
+// RegisterRoutes registers the routes for the ReactionController
+func (c *ReactionController) RegisterRoutes(router *gin.Engine) {
+	router.GET("/reactions", c.GetReactionTypes)
+
+	post := router.Group("/posts/:post_id")
+	post.Use(c.authMiddleware.RequireAuth(models.ResourcePosts))
+	{
+		post.PUT("/reaction", c.ReactToPost)
+		post.DELETE("/reaction", c.RemovePostReaction)
+		post.PUT("/comments/:comment_id/reaction", c.ReactToComment)
+		post.DELETE("/comments/:comment_id/reaction", c.RemoveCommentReaction)
+	}
+}
+
+// GetReactionTypes lists the available reaction types
+// @Summary List reaction types
+// @Description Returns the reaction types that can be used on posts and comments, in display order
+// @Tags Reactions
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+func (c *ReactionController) GetReactionTypes(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"types": c.reactionService.Types()})
+}
+
+// ReactToPost sets the user's reaction to a post
+// @Summary React to a post
+// @Description Sets the authenticated user's reaction to a post; reacting again with another type changes it
+// @Tags Reactions
+// @Accept json
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Param reaction body reactionRequest true "Reaction type"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *ReactionController) ReactToPost(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post ID from URL
+	postID := ctx.Param("post_id")
+
+	// Parse request body
+	var request reactionRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, err := c.reactionService.ReactToPost(postID, userID, request.Type)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to react to post")
+		ctx.JSON(reactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"post_id":        post.PostID,
+		"reactions":      post.Reactions,
+		"reaction_count": post.ReactionCount,
+		"my_reaction":    post.MyReaction,
+	})
+}
+
+// RemovePostReaction removes the user's reaction to a post
+// @Summary Remove a reaction from a post
+// @Description Removes the authenticated user's reaction to a post; removing it twice has no effect
+// @Tags Reactions
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} gin.H
+func (c *ReactionController) RemovePostReaction(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post ID from URL
+	postID := ctx.Param("post_id")
+
+	post, err := c.reactionService.RemovePostReaction(postID, userID, "")
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to remove reaction from post")
+		ctx.JSON(reactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"post_id":        post.PostID,
+		"reactions":      post.Reactions,
+		"reaction_count": post.ReactionCount,
+		"my_reaction":    post.MyReaction,
+	})
+}
+
+// ReactToComment sets the user's reaction to a comment
+// @Summary React to a comment
+// @Description Sets the authenticated user's reaction to a comment; reacting again with another type changes it
+// @Tags Reactions
+// @Accept json
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Param comment_id path string true "Comment ID"
+// @Param reaction body reactionRequest true "Reaction type"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *ReactionController) ReactToComment(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post and comment IDs from URL
+	postID := ctx.Param("post_id")
+	commentID := ctx.Param("comment_id")
+
+	// Parse request body
+	var request reactionRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := c.reactionService.ReactToComment(postID, commentID, userID, request.Type)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to react to comment")
+		ctx.JSON(reactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"comment_id":     comment.CommentID,
+		"reactions":      comment.Reactions,
+		"reaction_count": comment.ReactionCount,
+		"my_reaction":    comment.MyReaction,
+	})
+}
+
+// RemoveCommentReaction removes the user's reaction to a comment
+// @Summary Remove a reaction from a comment
+// @Description Removes the authenticated user's reaction to a comment; removing it twice has no effect
+// @Tags Reactions
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Param comment_id path string true "Comment ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} gin.H
+func (c *ReactionController) RemoveCommentReaction(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post and comment IDs from URL
+	postID := ctx.Param("post_id")
+	commentID := ctx.Param("comment_id")
+
+	comment, err := c.reactionService.RemoveCommentReaction(postID, commentID, userID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to remove reaction from comment")
+		ctx.JSON(reactionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"comment_id":     comment.CommentID,
+		"reactions":      comment.Reactions,
+		"reaction_count": comment.ReactionCount,
+		"my_reaction":    comment.MyReaction,
+	})
+}
+
+// reactionErrorStatus maps reaction service errors to HTTP status codes
+func reactionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPostNotFound), errors.Is(err, services.ErrCommentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidReactionType):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -29,14 +30,25 @@ func NewSocialMediaController(socialmediaService *services.SocialMediaService, a
 	}
 }
 
+// updatePostRequest is the body of a post update. The image is only changed when media_id is
+// sent; null or an empty string removes it.
+type updatePostRequest struct {
+	PostText string                 `json:"post_text"`
+	MediaID  utils.Optional[string] `json:"media_id"`
+}
+
 // RegisterRoutes registers the routes for the SocialMediaController
 func (c *SocialMediaController) RegisterRoutes(router *gin.Engine) {
 	posts := router.Group("/posts")
-	posts.Use(c.authMiddleware.RequireAuth())
+	posts.Use(c.authMiddleware.RequireAuth(models.ResourcePosts))
 	{
 		posts.GET("/page/:page_num/:page_limit", c.GetAllSocialMediaPosts)
 		posts.GET("/page/:page_num/:page_limit/:sort_by/:sort_order", c.GetAllSocialMediaPosts)
 		posts.GET("", c.GetAllSocialMediaPosts)
+		posts.GET("/search", c.QuerySocialMediaPost)
+		posts.GET("/feed", c.GetSocialMediaPostFeed)
+		posts.GET("/trash", c.GetTrashedSocialMediaPosts)
+		posts.POST("/:post_id/restore", c.RestoreSocialMediaPost)
 		posts.GET("/:post_id/", c.GetSocialMediaPostByPostID)
 		posts.GET("/user/:user_id", c.GetAllSocialMediaPostByUserID)
 		posts.GET("/:post_id/user", c.GetSocialMediaPostByPostAndUserID)
@@ -54,15 +66,15 @@ func (c *SocialMediaController) RegisterRoutes(router *gin.Engine) {
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Number of posts per page" default(10)
-// @Param colname query string false "Column name to filter by"
+// @Param colname query string false "Column name to filter by (post_text, post_image, user_id)" default(post_text)
 // @Param searchtext query string false "Search text for filtering"
-// @Param sort_by query string false "Field to sort by" default(created_at)
+// @Param sort_by query string false "Field to sort by (created_at, updated_at, post_text, likes)" default(created_at)
 // @Param sort_order query string false "Sort order (asc or desc)" default(desc)
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} services.PostSearchResult
 // @Failure 400 {object} gin.H
 // @Failure 500 {object} gin.H
 func (c *SocialMediaController) QuerySocialMediaPost(ctx *gin.Context) {
-	// USAGE: http://localhost:8080/posts?page=1&limit=10&colname=post_text&searchtext=test&create_at&desc
+	// USAGE: http://localhost:8080/posts/search?page=1&limit=10&colname=post_text&searchtext=test&sort_by=created_at&sort_order=desc
 	// Extract query parameters
 	pageStr := ctx.DefaultQuery("page", "1")
 	limitStr := ctx.DefaultQuery("limit", "10")
@@ -87,15 +99,21 @@ func (c *SocialMediaController) QuerySocialMediaPost(ctx *gin.Context) {
 	}
 
 	// Call the service to query posts
-	posts, err := c.socialmediaService.QuerySocialMediaPost(page, limit, colName, searchText, sortBy, sortOrder)
+	result, err := c.socialmediaService.QuerySocialMediaPost(page, limit, colName, searchText, sortBy, sortOrder, ctx.GetString("user_id"))
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to query social media posts")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+
+		var columnErr *services.InvalidSearchColumnError
+		if errors.As(err, &columnErr) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query social media posts"})
 		return
 	}
 
-	// Return the posts as JSON
-	ctx.JSON(http.StatusOK, gin.H{"posts": posts})
+	// Return the search result as JSON
+	ctx.JSON(http.StatusOK, result)
 }
 
 // GetAllSocialMediaPosts retrieves social media posts with pagination and sorting
@@ -106,7 +124,7 @@ func (c *SocialMediaController) QuerySocialMediaPost(ctx *gin.Context) {
 // @Produce json
 // @Param page_num path int false "Page number" default(1)
 // @Param page_limit path int false "Number of posts per page" default(10)
-// @Param sort_by path string false "Field to sort by" default(created_at)
+// @Param sort_by path string false "Field to sort by (created_at, updated_at, post_text, likes)" default(created_at)
 // @Param sort_order path string false "Sort order (asc or desc)" default(desc)
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} gin.H
@@ -152,7 +170,7 @@ func (c *SocialMediaController) GetAllSocialMediaPosts(ctx *gin.Context) {
 	}
 
 	// Call the service to get posts
-	response, err := c.socialmediaService.GetAllSocialMediaPosts(page, limit, sortBy, sortOrder)
+	response, err := c.socialmediaService.GetAllSocialMediaPosts(page, limit, sortBy, sortOrder, ctx.GetString("user_id"))
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to get social media posts")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -163,6 +181,53 @@ func (c *SocialMediaController) GetAllSocialMediaPosts(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
+// GetSocialMediaPostFeed retrieves the post feed with cursor pagination
+// @Summary Retrieve the post feed
+// @Description Fetches posts newest first using an opaque cursor; pages do not skip or repeat posts while new posts arrive
+// @Tags SocialMedia
+// @Accept json
+// @Produce json
+// @Param cursor query string false "Cursor returned as next_cursor or prev_cursor by a previous call"
+// @Param direction query string false "next for older posts, prev for newer posts" default(next)
+// @Param limit query int false "Number of posts per page" default(10)
+// @Param with_count query bool false "Include the total number of posts" default(false)
+// @Success 200 {object} services.PostFeedPage
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+func (c *SocialMediaController) GetSocialMediaPostFeed(ctx *gin.Context) {
+	// USAGE: http://localhost:8080/posts/feed?limit=10&cursor=<next_cursor>&direction=next
+	cursor := ctx.Query("cursor")
+	direction := ctx.DefaultQuery("direction", services.FeedDirectionNext)
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	withCount, err := strconv.ParseBool(ctx.DefaultQuery("with_count", "false"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid with_count parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid with_count parameter"})
+		return
+	}
+
+	// Call the service to get the feed page
+	page, err := c.socialmediaService.GetSocialMediaPostFeed(cursor, direction, limit, withCount, ctx.GetString("user_id"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get social media post feed")
+		if errors.Is(err, utils.ErrInvalidCursor) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get social media post feed"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
 // GetSocialMediaPostByPostID retrieves a social media post by its ID
 // @Summary Retrieve a social media post by ID
 // @Description Fetches a single social media post by its ID
@@ -177,7 +242,7 @@ func (c *SocialMediaController) GetSocialMediaPostByPostID(ctx *gin.Context) {
 	postID := ctx.Param("post_id")
 
 	// Get posts details by postID
-	post, err := c.socialmediaService.GetSocialMediaPostByPostID(postID)
+	post, err := c.socialmediaService.GetSocialMediaPostByPostID(postID, ctx.GetString("user_id"))
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to get task")
 		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -205,7 +270,7 @@ func (c *SocialMediaController) GetAllSocialMediaPostByUserID(ctx *gin.Context)
 	userID := ctx.Param("user_id")
 
 	// Get posts details by userID
-	post, err := c.socialmediaService.GetAllSocialMediaPostByUserID(userID)
+	post, err := c.socialmediaService.GetAllSocialMediaPostByUserID(userID, ctx.GetString("user_id"))
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to get social media posts")
 		ctx.JSON(http.StatusNotFound, gin.H{"status": "Post Not Found"})
@@ -268,7 +333,7 @@ func (c *SocialMediaController) CreateSocialMediaPost(ctx *gin.Context) {
 	createdSocialMediaPost, err := c.socialmediaService.CreateSocialMediaPost(&post, userID)
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to create post")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(postErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -277,14 +342,15 @@ func (c *SocialMediaController) CreateSocialMediaPost(ctx *gin.Context) {
 
 // UpdateSocialMediaPost updates an existing social media post
 // @Summary Update a social media post
-// @Description Updates an existing social media post for the authenticated user
+// @Description Updates an existing social media post; only its author or a moderator may do so
 // @Tags SocialMedia
 // @Accept json
 // @Produce json
 // @Param post_id path string true "Post ID"
-// @Param post body models.SocialMediaPost true "Updated Social Media Post"
+// @Param post body updatePostRequest true "Updated Social Media Post"
 // @Success 200 {object} models.SocialMediaPost
 // @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
 // @Failure 404 {object} gin.H
 func (c *SocialMediaController) UpdateSocialMediaPost(ctx *gin.Context) {
 	// Get user ID from context (set by auth middleware)
@@ -294,18 +360,19 @@ func (c *SocialMediaController) UpdateSocialMediaPost(ctx *gin.Context) {
 	postID := ctx.Param("post_id")
 
 	// Parse request body
-	var post models.SocialMediaPost
-	if err := ctx.ShouldBindJSON(&post); err != nil {
+	var req updatePostRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		c.logger.WithError(err).Error("Failed to parse request body")
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Update task
-	updatedSocialMediaPost, err := c.socialmediaService.UpdateSocialMediaPost(postID, &post, userID)
+	update := services.PostUpdate{PostText: req.PostText, MediaID: req.MediaID}
+	updatedSocialMediaPost, err := c.socialmediaService.UpdateSocialMediaPost(postID, update, userID, ctx.GetString("role"))
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to update social media post")
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(postErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -314,24 +381,109 @@ func (c *SocialMediaController) UpdateSocialMediaPost(ctx *gin.Context) {
 
 // DeleteSocialMediaPost deletes a social media post
 // @Summary Delete a social media post
-// @Description Deletes a social media post by its ID
+// @Description Moves a social media post and its comments and likes to the trash; only its author or a moderator may do so
 // @Tags SocialMedia
 // @Accept json
 // @Produce json
 // @Param post_id path string true "Post ID"
+// @Param reason query string false "Reason, required when a moderator removes someone else's post"
 // @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
 // @Failure 404 {object} gin.H
 func (c *SocialMediaController) DeleteSocialMediaPost(ctx *gin.Context) {
-	// Get task ID from URL
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post ID from URL
 	postID := ctx.Param("post_id")
 
-	// Delete post
-	err := c.socialmediaService.DeleteSocialMediaPost(postID)
+	// Delete post; moderators removing someone else's post must give a reason
+	err := c.socialmediaService.DeleteSocialMediaPost(postID, userID, ctx.GetString("role"), ctx.Query("reason"))
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to delete social media post")
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(postErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
+
+// GetTrashedSocialMediaPosts lists the authenticated user's deleted posts
+// @Summary List trashed posts
+// @Description Lists posts the authenticated user deleted and can still restore, with the time they will be purged
+// @Tags SocialMedia
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of posts per page" default(10)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+func (c *SocialMediaController) GetTrashedSocialMediaPosts(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Convert page and limit to integers
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid page parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	response, err := c.socialmediaService.GetTrashedSocialMediaPosts(userID, page, limit)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get trashed posts")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RestoreSocialMediaPost restores a post from the trash
+// @Summary Restore a deleted post
+// @Description Restores a post together with the comments and likes deleted with it; authors can restore their own deletions, moderators any post
+// @Tags SocialMedia
+// @Produce json
+// @Param post_id path string true "Post ID"
+// @Success 200 {object} models.SocialMediaPost
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+func (c *SocialMediaController) RestoreSocialMediaPost(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get post ID from URL
+	postID := ctx.Param("post_id")
+
+	post, err := c.socialmediaService.RestoreSocialMediaPost(postID, userID, ctx.GetString("role"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to restore social media post")
+		ctx.JSON(postErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"post": post})
+}
+
+// postErrorStatus maps post service errors to HTTP status codes
+func postErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPostNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPostForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrModerationReasonRequired), errors.Is(err, services.ErrMediaNotFound):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-azure/config"
+	"go-azure/middleware"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// streamHeartbeatInterval keeps idle connections open through proxies and detects dead clients
+	streamHeartbeatInterval = 25 * time.Second
+	// streamWriteTimeout bounds how long a single write to a client may block
+	streamWriteTimeout = 10 * time.Second
+)
+
+// StreamController pushes real-time events to connected clients
+type StreamController struct {
+	hub            *services.StreamHub
+	authService    *services.AuthService
+	authMiddleware *middleware.AuthMiddleware
+	config         *config.Config
+	logger         *logrus.Logger
+}
+
+// NewStreamController creates a new StreamController
+func NewStreamController(hub *services.StreamHub, authService *services.AuthService, authMiddleware *middleware.AuthMiddleware, cfg *config.Config) *StreamController {
+	return &StreamController{
+		hub:            hub,
+		authService:    authService,
+		authMiddleware: authMiddleware,
+		config:         cfg,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the StreamController
+func (c *StreamController) RegisterRoutes(router *gin.Engine) {
+	router.POST("/stream/ticket", c.authMiddleware.RequireAuth(), c.CreateTicket)
+	router.GET("/stream", c.authMiddleware.RequireStreamAuth(), c.Stream)
+}
+
+// streamSession is the access token a stream was opened with. The stream ends when the token
+// expires or is revoked.
+type streamSession struct {
+	userID    string
+	jti       string
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+// CreateTicket creates a ticket to open a stream with
+// @Summary Create a stream ticket
+// @Description Creates a single-use ticket for clients that cannot set the Authorization header on EventSource and WebSocket requests. Pass it as the ticket query parameter of /stream within 30 seconds.
+// @Tags Stream
+// @Produce json
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+func (c *StreamController) CreateTicket(ctx *gin.Context) {
+	accessToken := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+
+	ticket, err := c.authService.CreateStreamTicket(accessToken)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream ticket"})
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"expires_in": int64(services.StreamTicketTTL.Seconds()),
+	})
+}
+
+// Stream pushes events to the client
+// @Summary Stream real-time events
+// @Description Pushes new posts, new comments, reaction count changes and the user's notifications as they happen. Served as Server-Sent Events, or over a WebSocket when the request asks for an upgrade. Clients that cannot set the Authorization header pass a ticket from POST /stream/ticket instead. The stream closes when the access token expires or is revoked; reconnect with a new token.
+// @Tags Stream
+// @Produce text/event-stream
+// @Param ticket query string false "Single-use stream ticket, for clients that cannot set the Authorization header"
+// @Success 200 {object} services.StreamEvent
+// @Failure 401 {object} gin.H
+// @Failure 503 {object} gin.H
+func (c *StreamController) Stream(ctx *gin.Context) {
+	// USAGE: new EventSource("http://localhost:8080/stream?ticket=<ticket from POST /stream/ticket>")
+	userID := ctx.GetString("user_id")
+	session := streamSession{
+		userID:    userID,
+		jti:       ctx.GetString("jti"),
+		issuedAt:  ctx.GetTime("token_issued_at"),
+		expiresAt: ctx.GetTime("token_expires_at"),
+	}
+
+	sub := c.hub.Subscribe(userID)
+	if sub == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+		return
+	}
+	defer c.hub.Unsubscribe(sub)
+
+	logger := c.logger.WithField("user_id", userID)
+	logger.Info("Stream connected")
+	defer logger.Info("Stream disconnected")
+
+	if strings.EqualFold(ctx.GetHeader("Upgrade"), "websocket") {
+		server := websocket.Server{
+			Handshake: c.checkOrigin,
+			Handler: func(conn *websocket.Conn) {
+				c.serveWebSocket(conn, sub, session)
+			},
+		}
+		server.ServeHTTP(ctx.Writer, ctx.Request)
+		return
+	}
+
+	c.serveEvents(ctx, sub, session)
+}
+
+// sessionEnded reports whether the stream's access token was revoked
+func (c *StreamController) sessionEnded(session streamSession) bool {
+	revoked, err := c.authService.IsTokenRevoked(session.jti, session.userID, session.issuedAt)
+	if err != nil {
+		// Keep the stream open; the next heartbeat checks again
+		return false
+	}
+	if revoked {
+		c.logger.WithField("user_id", session.userID).Info("Stream token revoked")
+	}
+	return revoked
+}
+
+// serveEvents writes events as Server-Sent Events until the client leaves, the subscription ends
+// or the session does
+func (c *StreamController) serveEvents(ctx *gin.Context, sub *services.StreamSubscription, session streamSession) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	writer := http.NewResponseController(ctx.Writer)
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	expiry := time.NewTimer(time.Until(session.expiresAt))
+	defer expiry.Stop()
+
+	for {
+		var message []byte
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-expiry.C:
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				c.logger.WithError(err).Error("Failed to encode stream event")
+				continue
+			}
+			message = []byte("event: " + event.Type + "\ndata: " + string(data) + "\n\n")
+		case <-heartbeat.C:
+			if c.sessionEnded(session) {
+				return
+			}
+			message = []byte(": heartbeat\n\n")
+		}
+
+		// A client that stops reading fails the write instead of blocking the handler forever
+		if err := writer.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return
+		}
+		if _, err := ctx.Writer.Write(message); err != nil {
+			return
+		}
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// serveWebSocket writes events as JSON messages until the client leaves, the subscription ends or
+// the session does. Messages from the client are read and ignored so that a closed connection is
+// noticed.
+func (c *StreamController) serveWebSocket(conn *websocket.Conn, sub *services.StreamSubscription, session streamSession) {
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var message string
+		for websocket.Message.Receive(conn, &message) == nil {
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	expiry := time.NewTimer(time.Until(session.expiresAt))
+	defer expiry.Stop()
+
+	for {
+		var event services.StreamEvent
+		select {
+		case <-closed:
+			return
+		case <-expiry.C:
+			return
+		case received, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			event = received
+		case <-heartbeat.C:
+			if c.sessionEnded(session) {
+				return
+			}
+			event = services.StreamEvent{Type: services.StreamEventHeartbeat}
+		}
+
+		if err := conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			return
+		}
+		if err := websocket.JSON.Send(conn, event); err != nil {
+			return
+		}
+	}
+}
+
+// checkOrigin only accepts WebSocket handshakes from the frontend or from clients that send no Origin
+func (c *StreamController) checkOrigin(wsConfig *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(origin, strings.TrimSuffix(c.config.AppURL, "/")) {
+		c.logger.WithField("origin", origin).Warn("Rejected WebSocket origin")
+		return errors.New("origin not allowed")
+	}
+
+	wsConfig.Origin = parsed
+	return nil
+}
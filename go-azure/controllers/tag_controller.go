@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// TagController handles hashtag endpoints
+type TagController struct {
+	tagService     *services.TagService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewTagController creates a new TagController
+func NewTagController(tagService *services.TagService, authMiddleware *middleware.AuthMiddleware) *TagController {
+	return &TagController{
+		tagService:     tagService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the TagController
+func (c *TagController) RegisterRoutes(router *gin.Engine) {
+	tags := router.Group("/tags")
+	tags.Use(c.authMiddleware.RequireAuth(models.ResourcePosts))
+	{
+		tags.GET("/trending", c.GetTrendingTags)
+		tags.GET("/:tag", c.GetTagPosts)
+	}
+}
+
+// GetTagPosts retrieves the posts with a hashtag
+// @Summary Retrieve posts with a hashtag
+// @Description Fetches the posts containing a hashtag, newest first, using an opaque cursor. The tag is case-insensitive and may be given with or without "#".
+// @Tags Tags
+// @Produce json
+// @Param tag path string true "Hashtag"
+// @Param cursor query string false "Cursor returned as next_cursor by a previous call"
+// @Param limit query int false "Number of posts per page" default(10)
+// @Success 200 {object} services.PostFeedPage
+// @Failure 400 {object} gin.H
+func (c *TagController) GetTagPosts(ctx *gin.Context) {
+	// USAGE: http://localhost:8080/tags/golang?limit=10&cursor=<next_cursor>
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	page, err := c.tagService.GetTagPosts(ctx.Param("tag"), ctx.Query("cursor"), limit, ctx.GetString("user_id"))
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get tag posts")
+		if errors.Is(err, utils.ErrInvalidCursor) || errors.Is(err, services.ErrInvalidTag) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tag posts"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// GetTrendingTags retrieves the most used hashtags
+// @Summary Retrieve trending hashtags
+// @Description Fetches the hashtags used by the most posts created in the last hours, 24 by default and at most 168
+// @Tags Tags
+// @Produce json
+// @Param hours query int false "Size of the sliding window in hours"
+// @Param limit query int false "Number of tags" default(10)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+func (c *TagController) GetTrendingTags(ctx *gin.Context) {
+	hours, err := strconv.Atoi(ctx.DefaultQuery("hours", "0"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid hours parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hours parameter"})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.logger.WithError(err).Error("Invalid limit parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	tags, err := c.tagService.GetTrendingTags(time.Duration(hours)*time.Hour, limit)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to get trending tags")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trending tags"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"tags": tags})
+}
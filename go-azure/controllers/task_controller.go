@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -27,15 +29,30 @@ func NewTaskController(taskService *services.TaskService, authMiddleware *middle
 	}
 }
 
+// updateTaskRequest is the body of a task update. Omitted fields are left unchanged; due_date and
+// parent_task_id are cleared with null.
+type updateTaskRequest struct {
+	Title            *string                   `json:"title"`
+	Description      *string                   `json:"description"`
+	Completed        *bool                     `json:"completed"`
+	Priority         *string                   `json:"priority"`
+	Position         *int                      `json:"position"`
+	Labels           *[]string                 `json:"labels"`
+	DueDate          utils.Optional[time.Time] `json:"due_date"`
+	ParentTaskID     utils.Optional[string]    `json:"parent_task_id"`
+	CompleteSubtasks bool                      `json:"complete_subtasks"`
+}
+
 // RegisterRoutes registers the routes for the TaskController
 func (c *TaskController) RegisterRoutes(router *gin.Engine) {
 	tasks := router.Group("/tasks")
-	tasks.Use(c.authMiddleware.RequireAuth())
+	tasks.Use(c.authMiddleware.RequireAuth(models.ResourceTasks))
 	{
 		tasks.GET("", c.GetAllTasks)
 		tasks.GET("/:id", c.GetTaskByID)
 		tasks.POST("", c.CreateTask)
 		tasks.PUT("/:id", c.UpdateTask)
+		tasks.PATCH("/:id", c.UpdateTask)
 		tasks.DELETE("/:id", c.DeleteTask)
 	}
 }
@@ -63,7 +80,7 @@ func (c *TaskController) GetTaskByID(ctx *gin.Context) {
 	task, err := c.taskService.GetTaskByID(taskID, userID)
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to get task")
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(taskErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -87,14 +104,15 @@ func (c *TaskController) CreateTask(ctx *gin.Context) {
 	createdTask, err := c.taskService.CreateTask(&task, userID)
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to create task")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(taskErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	ctx.JSON(http.StatusCreated, gin.H{"task": createdTask})
 }
 
-// UpdateTask updates an existing task
+// UpdateTask updates the fields of an existing task sent in the request body. Completing a task
+// with incomplete subtasks fails unless complete_subtasks is true, which completes them too.
 func (c *TaskController) UpdateTask(ctx *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID := ctx.GetString("user_id")
@@ -103,18 +121,28 @@ func (c *TaskController) UpdateTask(ctx *gin.Context) {
 	taskID := ctx.Param("id")
 
 	// Parse request body
-	var task models.Task
-	if err := ctx.ShouldBindJSON(&task); err != nil {
+	var request updateTaskRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		c.logger.WithError(err).Error("Failed to parse request body")
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Update task
-	updatedTask, err := c.taskService.UpdateTask(taskID, &task, userID)
+	updatedTask, err := c.taskService.UpdateTask(taskID, services.TaskUpdate{
+		Title:            request.Title,
+		Description:      request.Description,
+		Completed:        request.Completed,
+		Priority:         request.Priority,
+		Position:         request.Position,
+		Labels:           request.Labels,
+		DueDate:          request.DueDate,
+		ParentTaskID:     request.ParentTaskID,
+		CompleteSubtasks: request.CompleteSubtasks,
+	}, userID)
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to update task")
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(taskErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -133,9 +161,25 @@ func (c *TaskController) DeleteTask(ctx *gin.Context) {
 	err := c.taskService.DeleteTask(taskID, userID)
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to delete task")
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(taskErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Task deleted successfully"})
-}
\ No newline at end of file
+}
+
+// taskErrorStatus maps task service errors to HTTP status codes
+func taskErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTaskNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidTaskTitle), errors.Is(err, services.ErrInvalidPriority),
+		errors.Is(err, services.ErrInvalidLabels), errors.Is(err, services.ErrInvalidPosition),
+		errors.Is(err, services.ErrInvalidParentTask):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTaskHasSubtasks), errors.Is(err, services.ErrSubtasksIncomplete):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"go-azure/models"
 	"go-azure/services"
 	"go-azure/utils"
 
@@ -11,25 +14,52 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// AuthMiddleware is a middleware for JWT authentication
+// AuthMiddleware is a middleware for JWT and personal access token authentication
 type AuthMiddleware struct {
-	authService *services.AuthService
-	logger      *logrus.Logger
+	authService  *services.AuthService
+	tokenService *services.PersonalAccessTokenService
+	logger       *logrus.Logger
 }
 
 // NewAuthMiddleware creates a new AuthMiddleware
-func NewAuthMiddleware(authService *services.AuthService) *AuthMiddleware {
+func NewAuthMiddleware(authService *services.AuthService, tokenService *services.PersonalAccessTokenService) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService: authService,
-		logger:      utils.GetLogger(),
+		authService:  authService,
+		tokenService: tokenService,
+		logger:       utils.GetLogger(),
 	}
 }
 
-// RequireAuth is a middleware that requires JWT authentication
-func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
+// RequireAuth is a middleware that requires JWT authentication. Personal access tokens are
+// accepted only on routes of the given resources, and must hold a scope for each of them:
+// <resource>:read for GET and HEAD requests, <resource>:write otherwise, or <resource>:*.
+func (m *AuthMiddleware) RequireAuth(resources ...string) gin.HandlerFunc {
+	return m.requireAuth(false, resources)
+}
+
+// RequireStreamAuth is RequireAuth for streaming endpoints. Browsers cannot set headers on
+// EventSource and WebSocket requests, so a single-use stream ticket may be sent as the ticket
+// query parameter instead. Access tokens are never taken from the URL, which ends up in logs.
+func (m *AuthMiddleware) RequireStreamAuth() gin.HandlerFunc {
+	return m.requireAuth(true, nil)
+}
+
+// requireAuth validates the bearer token, optionally falling back to the token of the stream
+// ticket in the ticket query parameter
+func (m *AuthMiddleware) requireAuth(allowStreamTicket bool, resources []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get authorization header
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" && allowStreamTicket && c.Query("ticket") != "" {
+			accessToken, err := m.authService.RedeemStreamTicket(c.Query("ticket"))
+			if err != nil {
+				m.logger.WithError(err).Warn("Invalid stream ticket")
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid stream ticket"})
+				c.Abort()
+				return
+			}
+			authHeader = "Bearer " + accessToken
+		}
 		if authHeader == "" {
 			m.logger.Warn("Missing authorization header")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is required"})
@@ -48,10 +78,20 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 		// Extract token
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
+		if strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			m.authenticatePersonalAccessToken(c, tokenString, resources)
+			return
+		}
+
 		// Validate token
 		claims, err := m.authService.ValidateToken(tokenString)
 		if err != nil {
 			m.logger.WithError(err).Warn("Invalid token")
+			if errors.Is(err, services.ErrTokenRevoked) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			c.Abort()
 			return
@@ -70,6 +110,19 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 		c.Set("user_id", userID)
 		c.Set("email", claims["email"])
 		c.Set("name", claims["name"])
+		role, _ := claims["role"].(string)
+		if role == "" {
+			role = models.RoleUser
+		}
+		c.Set("role", role)
+		// Signing out revokes the token by its ID until it expires
+		c.Set("jti", claims["jti"])
+		if exp, ok := claims["exp"].(int64); ok {
+			c.Set("token_expires_at", time.Unix(exp, 0))
+		}
+		if iat, ok := claims["iat"].(int64); ok {
+			c.Set("token_issued_at", time.Unix(iat, 0))
+		}
 
 		m.logger.WithFields(logrus.Fields{
 			"user_id": userID,
@@ -78,3 +131,78 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// authenticatePersonalAccessToken authenticates the request with a personal access token, which
+// must hold a scope for each resource of the route
+func (m *AuthMiddleware) authenticatePersonalAccessToken(c *gin.Context, tokenString string, resources []string) {
+	if len(resources) == 0 {
+		m.logger.Warn("Personal access token used on a route without scopes")
+		c.JSON(http.StatusForbidden, gin.H{"error": "personal access tokens cannot be used for this endpoint"})
+		c.Abort()
+		return
+	}
+
+	token, user, err := m.tokenService.Authenticate(tokenString)
+	if err != nil {
+		m.logger.WithError(err).Warn("Invalid personal access token")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		c.Abort()
+		return
+	}
+
+	for _, resource := range resources {
+		scope := resource + ":write"
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			scope = resource + ":read"
+		}
+		if !token.Scopes.Has(scope) {
+			m.logger.WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"token_id": token.TokenID,
+				"scope":    scope,
+			}).Warn("Insufficient token scope")
+			c.JSON(http.StatusForbidden, gin.H{"error": "token is missing the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+	}
+
+	// Set the same session variables as for a JWT
+	c.Set("user_id", user.ID)
+	c.Set("email", user.EmailAddress())
+	c.Set("name", user.Name)
+	role := user.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	c.Set("role", role)
+	c.Set("token_id", token.TokenID)
+
+	m.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"token_id": token.TokenID,
+	}).Info("User authenticated with personal access token")
+
+	c.Next()
+}
+
+// RequireRole is a middleware that only lets users with one of the given roles through.
+// It must run after RequireAuth.
+func (m *AuthMiddleware) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		m.logger.WithFields(logrus.Fields{
+			"user_id": c.GetString("user_id"),
+			"role":    role,
+		}).Warn("Insufficient role")
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/testutil"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAuthPersonalAccessTokenScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t)
+	user := testutil.CreateUser(t, db, "alice")
+
+	tokenService := services.NewPersonalAccessTokenService()
+	createToken := func(scopes ...string) string {
+		t.Helper()
+		token, err := tokenService.CreateToken(user.ID, "test", scopes, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.Token
+	}
+	postsRead := createToken(models.ScopePostsRead)
+	postsWrite := createToken(models.ScopePostsWrite)
+	postsAll := createToken(models.ScopePostsAll)
+	tasksAll := createToken(models.ScopeTasksAll)
+
+	expired, err := tokenService.CreateToken(user.ID, "expired", []string{models.ScopePostsAll}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.PersonalAccessToken{}).Where("token_id = ?", expired.TokenID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := tokenService.CreateToken(user.ID, "revoked", []string{models.ScopePostsAll}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tokenService.RevokeToken(user.ID, revoked.TokenID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The JWT path is not exercised, so no AuthService is needed
+	auth := NewAuthMiddleware(nil, tokenService)
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router := gin.New()
+	posts := router.Group("/posts", auth.RequireAuth(models.ResourcePosts))
+	posts.Any("", ok)
+	posts.Any("/:post_id", ok)
+	tasks := router.Group("/tasks", auth.RequireAuth(models.ResourceTasks))
+	tasks.Any("", ok)
+	router.POST("/auth/signout-all", auth.RequireAuth(), ok)
+	router.Any("/auth/tokens", auth.RequireAuth(), ok)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "read scope on GET", method: http.MethodGet, path: "/posts", token: postsRead, want: http.StatusNoContent},
+		{name: "read scope on HEAD", method: http.MethodHead, path: "/posts", token: postsRead, want: http.StatusNoContent},
+		{name: "read scope on POST", method: http.MethodPost, path: "/posts", token: postsRead, want: http.StatusForbidden},
+		{name: "read scope on PUT", method: http.MethodPut, path: "/posts/1", token: postsRead, want: http.StatusForbidden},
+		{name: "read scope on PATCH", method: http.MethodPatch, path: "/posts/1", token: postsRead, want: http.StatusForbidden},
+		{name: "read scope on DELETE", method: http.MethodDelete, path: "/posts/1", token: postsRead, want: http.StatusForbidden},
+		{name: "write scope on GET", method: http.MethodGet, path: "/posts", token: postsWrite, want: http.StatusForbidden},
+		{name: "write scope on POST", method: http.MethodPost, path: "/posts", token: postsWrite, want: http.StatusNoContent},
+		{name: "wildcard scope on GET", method: http.MethodGet, path: "/posts", token: postsAll, want: http.StatusNoContent},
+		{name: "wildcard scope on DELETE", method: http.MethodDelete, path: "/posts/1", token: postsAll, want: http.StatusNoContent},
+		{name: "tasks scope on posts", method: http.MethodGet, path: "/posts", token: tasksAll, want: http.StatusForbidden},
+		{name: "tasks scope on tasks", method: http.MethodPost, path: "/tasks", token: tasksAll, want: http.StatusNoContent},
+		{name: "posts scope on tasks", method: http.MethodGet, path: "/tasks", token: postsAll, want: http.StatusForbidden},
+		{name: "expired token", method: http.MethodGet, path: "/posts", token: expired.Token, want: http.StatusUnauthorized},
+		{name: "revoked token", method: http.MethodGet, path: "/posts", token: revoked.Token, want: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodGet, path: "/posts", token: models.PersonalAccessTokenPrefix + "unknown", want: http.StatusUnauthorized},
+		{name: "sign out everywhere", method: http.MethodPost, path: "/auth/signout-all", token: postsAll, want: http.StatusForbidden},
+		{name: "list tokens", method: http.MethodGet, path: "/auth/tokens", token: postsAll, want: http.StatusForbidden},
+		{name: "create token", method: http.MethodPost, path: "/auth/tokens", token: tasksAll, want: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != test.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireStreamAuthTicketIsSingleUse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t)
+	user := testutil.CreateUser(t, db, "alice")
+
+	cfg := &config.Config{JWTSigningAlgorithm: "HS256", JWTSecret: "test-secret", JWTExpirationMinutes: 15}
+	keys, err := utils.NewKeyRing(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authService := services.NewAuthService(cfg, utils.NewMemoryRevocationStore(), keys, nil)
+	tokenDetails, err := utils.GenerateToken(user.ID, "", user.Name, user.Role, keys, cfg.JWTExpirationMinutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err := authService.CreateStreamTicket(tokenDetails.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := NewAuthMiddleware(authService, services.NewPersonalAccessTokenService())
+	router := gin.New()
+	router.GET("/stream", auth.RequireStreamAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("user_id"))
+	})
+
+	tests := []struct {
+		name   string
+		query  string
+		want   int
+		wantID string
+	}{
+		{name: "ticket", query: "ticket=" + url.QueryEscape(ticket), want: http.StatusOK, wantID: user.ID},
+		{name: "same ticket again", query: "ticket=" + url.QueryEscape(ticket), want: http.StatusUnauthorized},
+		{name: "unknown ticket", query: "ticket=unknown", want: http.StatusUnauthorized},
+		{name: "access token in the URL", query: "ticket=" + url.QueryEscape(tokenDetails.AccessToken), want: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream?"+test.query, nil))
+
+			if rec.Code != test.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.want, rec.Body.String())
+			}
+			if test.wantID != "" && rec.Body.String() != test.wantID {
+				t.Errorf("user_id = %q, want %q", rec.Body.String(), test.wantID)
+			}
+		})
+	}
+}
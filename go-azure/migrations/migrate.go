@@ -2,12 +2,52 @@ package migrations
 
 import (
 	"go-azure/models"
+	"go-azure/utils"
 	"log"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// completedMigration records a one-off data migration that finished, so it is not run again
+type completedMigration struct {
+	Name        string    `gorm:"type:varchar(100);primaryKey"`
+	CompletedAt time.Time `gorm:"not null"`
+}
+
+// TableName specifies the table name for completedMigration
+func (completedMigration) TableName() string {
+	return "completed_migrations"
+}
+
+// Models are the tables created and updated by AutoMigrate
+var Models = []any{
+	&models.User{},
+	&models.Task{},
+	&models.SocialMediaPost{},
+	&models.SocialMediaComments{},
+	&models.Reaction{},
+	&models.ModerationAction{},
+	&models.Follow{},
+	&models.Media{},
+	&models.MediaVariant{},
+	&models.PostHashtag{},
+	&models.PostMention{},
+	&models.Notification{},
+	&models.NotificationActor{},
+	&models.Conversation{},
+	&models.ConversationParticipant{},
+	&models.Message{},
+	&models.RefreshToken{},
+	&models.RevokedToken{},
+	&models.UserTokenRevocation{},
+	&models.UserIdentity{},
+	&models.PersonalAccessToken{},
+	&completedMigration{},
+}
+
 // Migrate runs database migrations
 func Migrate(db *gorm.DB) error {
 	logrus.Info("Running database migrations")
@@ -22,19 +62,172 @@ func Migrate(db *gorm.DB) error {
 	log.Printf("Database %s is ready.", dbName)
 	// logrus.Info("Database %s is ready.", dbName)
 
+	// Existing users need usernames before the unique index is created
+	if err := backfillUsernames(db); err != nil {
+		logrus.WithError(err).Error("Failed to backfill usernames")
+		return err
+	}
+
 	// Auto migrate models
-	err := db.AutoMigrate(
-		&models.User{},
-		&models.Task{},
-		&models.SocialMediaPost{},
-		&models.SocialMediaComments{},
-		&models.SocialMediaLikes{},
-	)
+	err := db.AutoMigrate(Models...)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to run migrations")
 		return err
 	}
 
+	// Full-text search on post_text needs a FULLTEXT index
+	if err := ensureFullTextIndex(db, &models.SocialMediaPost{}, "post_text"); err != nil {
+		logrus.WithError(err).Error("Failed to create FULLTEXT index")
+		return err
+	}
+
+	// Likes are now computed from reactions
+	if err := dropColumns(db, &models.SocialMediaPost{}, "likes", "is_liked"); err != nil {
+		logrus.WithError(err).Error("Failed to drop denormalized like columns")
+		return err
+	}
+
+	// Comments created before threading are top-level comments
+	if err := backfillCommentPaths(db); err != nil {
+		logrus.WithError(err).Error("Failed to backfill comment paths")
+		return err
+	}
+
+	// Likes became reactions of type "like"
+	if err := migrateLikesToReactions(db); err != nil {
+		logrus.WithError(err).Error("Failed to migrate likes to reactions")
+		return err
+	}
+
+	// Posts written before hashtags were recorded are indexed once
+	if err := runOnce(db, "backfill_post_hashtags", backfillPostHashtags); err != nil {
+		logrus.WithError(err).Error("Failed to index hashtags of existing posts")
+		return err
+	}
+
 	logrus.Info("Database migrations completed successfully")
 	return nil
 }
+
+// migrateLikesToReactions copies the rows of the old social_media_likes table into reactions
+// and drops it. Duplicate likes by the same user collapse into one reaction.
+func migrateLikesToReactions(db *gorm.DB) error {
+	if !db.Migrator().HasTable("social_media_likes") {
+		return nil
+	}
+
+	logrus.Info("Migrating likes to reactions")
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT IGNORE INTO reactions (reaction_id, post_id, comment_id, user_id, type, created_at, updated_at, deleted_at)
+			SELECT like_id, post_id, '', user_id, ?, created_at, updated_at, deleted_at FROM social_media_likes`, models.ReactionLike).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable("social_media_likes")
+	})
+}
+
+// backfillUsernames adds the username column to an existing users table and fills it in
+func backfillUsernames(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.User{}) {
+		return nil
+	}
+	if !db.Migrator().HasColumn(&models.User{}, "username") {
+		if err := db.Exec("ALTER TABLE users ADD COLUMN username varchar(30) NOT NULL DEFAULT ''").Error; err != nil {
+			return err
+		}
+	}
+
+	// Usernames must start with a letter to be @mentioned; older ones starting with a digit or an
+	// underscore get a new one derived from the old one
+	var users []models.User
+	if err := db.Unscoped().Select("id, email, username").Where("username = '' OR username NOT REGEXP '^[a-z]'").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		source := user.EmailAddress()
+		if user.Username != "" {
+			source = user.Username
+		}
+		username, err := models.UniqueUsername(db, source)
+		if err != nil {
+			return err
+		}
+		if err := db.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Update("username", username).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runOnce runs a data migration unless it completed before. It is only recorded as completed
+// once it succeeds, so one that failed or was interrupted runs again on the next start.
+func runOnce(db *gorm.DB, name string, migrate func(*gorm.DB) error) error {
+	var count int64
+	if err := db.Model(&completedMigration{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	logrus.WithField("migration", name).Info("Running data migration")
+	if err := migrate(db); err != nil {
+		return err
+	}
+	return db.Create(&completedMigration{Name: name, CompletedAt: time.Now()}).Error
+}
+
+// backfillPostHashtags records the hashtags of existing posts. Hashtags recorded by an earlier,
+// interrupted run or by posts created meanwhile are kept.
+func backfillPostHashtags(db *gorm.DB) error {
+	var posts []models.SocialMediaPost
+	return db.Unscoped().Select("post_id, post_text, created_at").FindInBatches(&posts, 500, func(tx *gorm.DB, batch int) error {
+		var hashtags []models.PostHashtag
+		for _, post := range posts {
+			for _, tag := range utils.ExtractHashtags(post.PostText) {
+				hashtags = append(hashtags, models.PostHashtag{Tag: tag, PostID: post.PostID, CreatedAt: post.CreatedAt})
+			}
+		}
+		if len(hashtags) == 0 {
+			return nil
+		}
+		return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&hashtags).Error
+	}).Error
+}
+
+// backfillCommentPaths gives comments without a materialized path their own ID as path
+func backfillCommentPaths(db *gorm.DB) error {
+	return db.Unscoped().Model(&models.SocialMediaComments{}).
+		Where("path = ''").
+		Update("path", gorm.Expr("comment_id")).Error
+}
+
+// ensureFullTextIndex creates a FULLTEXT index on the column unless one already exists,
+// for example one added by hand with ALTER TABLE ... ADD FULLTEXT
+func ensureFullTextIndex(db *gorm.DB, model interface{ TableName() string }, column string) error {
+	var count int64
+	err := db.Raw(`SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ? AND index_type = 'FULLTEXT'`,
+		model.TableName(), column).Scan(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	logrus.WithField("column", column).Info("Creating FULLTEXT index")
+	return db.Exec("ALTER TABLE " + model.TableName() + " ADD FULLTEXT idx_" + model.TableName() + "_" + column + " (" + column + ")").Error
+}
+
+// dropColumns drops columns that are no longer part of a model
+func dropColumns(db *gorm.DB, model interface{}, columns ...string) error {
+	for _, column := range columns {
+		if db.Migrator().HasColumn(model, column) {
+			if err := db.Migrator().DropColumn(model, column); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
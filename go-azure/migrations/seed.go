@@ -1,11 +1,18 @@
 package migrations
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
 	"math/rand"
-	"strconv"
 	"time"
 
 	"go-azure/models"
+	"go-azure/utils"
 
 	"github.com/bxcodec/faker/v3"
 	"github.com/google/uuid"
@@ -14,7 +21,7 @@ import (
 )
 
 // Seed populates the database with fake data
-func Seed(db *gorm.DB) error {
+func Seed(db *gorm.DB, store utils.BlobStore) error {
 	logrus.Info("Seeding database")
 
 	// Seed users
@@ -32,7 +39,7 @@ func Seed(db *gorm.DB) error {
 
 	// Seed social media posts for each user
 	for _, user := range users {
-		if err := seedSocialMediaPost(db, user, 5); err != nil {
+		if err := seedSocialMediaPost(db, store, user, 5); err != nil {
 			return err
 		}
 	}
@@ -50,8 +57,8 @@ func Seed(db *gorm.DB) error {
 			if err := seedSocialMediaComments(db, post, 5); err != nil {
 				return err
 			}
-			// Seed social media likes for each post
-			if err := seedSocialMediaLikes(db, post, 5); err != nil {
+			// Seed reactions for each post
+			if err := seedReactions(db, post, users, 5); err != nil {
 				return err
 			}
 		}
@@ -66,9 +73,10 @@ func seedUsers(db *gorm.DB, count int) ([]models.User, error) {
 	var users []models.User
 
 	for i := 0; i < count; i++ {
+		email := faker.Email()
 		user := models.User{
 			ID:        uuid.New().String(),
-			Email:     faker.Email(),
+			Email:     &email,
 			Name:      faker.Name(),
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
@@ -100,6 +108,7 @@ func seedTasks(db *gorm.DB, user models.User, count int) error {
 			Description: faker.Paragraph(),
 			Completed:   completed,
 			UserID:      user.ID,
+			Position:    i,
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 		}
@@ -125,17 +134,20 @@ func RandomBool() bool {
 	return rand.Intn(2) == 0
 }
 
-func seedSocialMediaPost(db *gorm.DB, user models.User, count int) error {
+func seedSocialMediaPost(db *gorm.DB, store utils.BlobStore, user models.User, count int) error {
 	// Seed social media posts for the user
 	for i := 0; i < count; i++ {
-		imageLink := "https://picsum.photos/id/" + strconv.Itoa(RandomInt(1, 1000)) + "/" + strconv.Itoa(RandomInt(1, 1000)) + "/" + strconv.Itoa(RandomInt(1, 1000)) // Replace with a valid image URL
+		media, err := seedMedia(db, store, user)
+		if err != nil {
+			return err
+		}
+
 		post := models.SocialMediaPost{
 			PostID:    uuid.New().String(),
 			UserID:    user.ID,
-			PostText:  faker.Sentence(),
-			PostImage: imageLink, //faker.URL(),
-			Likes:     RandomInt(1, 1000),
-			IsLiked:   RandomInt(0, 1) == 1,
+			PostText:  faker.Sentence() + " #" + seedHashtags[rand.Intn(len(seedHashtags))],
+			PostImage: models.MediaURL(media.MediaID),
+			MediaID:   media.MediaID,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
@@ -144,13 +156,74 @@ func seedSocialMediaPost(db *gorm.DB, user models.User, count int) error {
 			logrus.WithError(err).Error("Failed to seed social media post")
 			return err
 		}
+
+		for _, tag := range utils.ExtractHashtags(post.PostText) {
+			hashtag := models.PostHashtag{Tag: tag, PostID: post.PostID, CreatedAt: post.CreatedAt}
+			if err := db.Create(&hashtag).Error; err != nil {
+				logrus.WithError(err).Error("Failed to seed hashtag")
+				return err
+			}
+		}
 	}
 	logrus.WithField("count", count).Info("Post seeded successfully")
 	return nil
 }
 
+// seedHashtags are appended to seeded posts so tag pages and trending tags have data
+var seedHashtags = []string{"golang", "azure", "vue", "weekend", "coffee"}
+
+// seedMedia stores a generated gradient image for the user
+func seedMedia(db *gorm.DB, store utils.BlobStore, user models.User) (models.Media, error) {
+	width, height := RandomInt(320, 960), RandomInt(240, 720)
+	from := color.RGBA{uint8(rand.Intn(256)), uint8(rand.Intn(256)), uint8(rand.Intn(256)), 255}
+	to := color.RGBA{uint8(rand.Intn(256)), uint8(rand.Intn(256)), uint8(rand.Intn(256)), 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			t := float64(x+y) / float64(width+height)
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(float64(from.R)*(1-t) + float64(to.R)*t),
+				G: uint8(float64(from.G)*(1-t) + float64(to.G)*t),
+				B: uint8(float64(from.B)*(1-t) + float64(to.B)*t),
+				A: 255,
+			})
+		}
+	}
+
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		return models.Media{}, err
+	}
+
+	checksum := sha256.Sum256(data.Bytes())
+	mediaID := uuid.New().String()
+	media := models.Media{
+		MediaID:     mediaID,
+		UserID:      user.ID,
+		ContentType: "image/png",
+		Size:        int64(data.Len()),
+		Width:       width,
+		Height:      height,
+		Checksum:    hex.EncodeToString(checksum[:]),
+		StorageKey:  mediaID + "/original",
+	}
+
+	if err := store.Put(context.Background(), media.StorageKey, bytes.NewReader(data.Bytes()), media.Size, media.ContentType); err != nil {
+		logrus.WithError(err).Error("Failed to store seed media")
+		return models.Media{}, err
+	}
+	if err := db.Create(&media).Error; err != nil {
+		logrus.WithError(err).Error("Failed to seed media")
+		return models.Media{}, err
+	}
+
+	return media, nil
+}
+
 func seedSocialMediaComments(db *gorm.DB, post models.SocialMediaPost, count int) error {
-	// Seed social media comments for the post
+	// Seed social media comments for the post; every other comment replies to the one before it
+	var previous *models.SocialMediaComments
 	for i := 0; i < count; i++ {
 		comment := models.SocialMediaComments{
 			CommentID:   uuid.New().String(),
@@ -160,32 +233,49 @@ func seedSocialMediaComments(db *gorm.DB, post models.SocialMediaPost, count int
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 		}
+		comment.Path = comment.CommentID
+		if i%2 == 1 {
+			comment.ParentCommentID = &previous.CommentID
+			comment.Path = previous.Path + "/" + comment.CommentID
+			comment.Depth = previous.Depth + 1
+		}
 
 		if err := db.Create(&comment).Error; err != nil {
 			logrus.WithError(err).Error("Failed to seed social media comment")
 			return err
 		}
+		previous = &comment
 	}
 	logrus.WithField("count", count).Info("Comments seeded successfully")
 	return nil
 }
 
-func seedSocialMediaLikes(db *gorm.DB, post models.SocialMediaPost, count int) error {
-	// Seed social media likes for the post
-	for i := 0; i < count; i++ {
-		like := models.SocialMediaLikes{
-			LikeID:    uuid.New().String(),
-			PostID:    post.PostID,
-			UserID:    post.UserID,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+// seedReactionTypes are the default reaction types, mostly likes
+var seedReactionTypes = []string{models.ReactionLike, models.ReactionLike, models.ReactionLike, "love", "laugh", "sad", "angry"}
+
+func seedReactions(db *gorm.DB, post models.SocialMediaPost, users []models.User, count int) error {
+	// A user can react to a post only once, so pick distinct users
+	if count > len(users) {
+		count = len(users)
+	}
+	reactors := rand.Perm(len(users))[:count]
+
+	// Seed reactions to the post
+	for _, i := range reactors {
+		reaction := models.Reaction{
+			ReactionID: uuid.New().String(),
+			PostID:     post.PostID,
+			UserID:     users[i].ID,
+			Type:       seedReactionTypes[rand.Intn(len(seedReactionTypes))],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
 		}
 
-		if err := db.Create(&like).Error; err != nil {
-			logrus.WithError(err).Error("Failed to seed social media like")
+		if err := db.Create(&reaction).Error; err != nil {
+			logrus.WithError(err).Error("Failed to seed reaction")
 			return err
 		}
 	}
-	logrus.WithField("count", count).Info("Likes seeded successfully")
+	logrus.WithField("count", count).Info("Reactions seeded successfully")
 	return nil
 }
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Conversation is a private 1:1 or group conversation between users
+type Conversation struct {
+	ConversationID string `gorm:"type:varchar(36);primaryKey" json:"conversation_id"`
+	IsGroup        bool   `gorm:"not null;default:false" json:"is_group"`
+	Title          string `gorm:"type:varchar(100);not null;default:''" json:"title,omitempty"`
+	CreatedBy      string `gorm:"type:varchar(36);not null" json:"created_by"`
+	// DirectKey holds the sorted user IDs of a 1:1 conversation so each pair has at most one; NULL for groups
+	DirectKey     *string   `gorm:"type:varchar(80);uniqueIndex" json:"-"`
+	LastMessageID string    `gorm:"type:varchar(36);not null;default:''" json:"-"`
+	LastMessageAt time.Time `gorm:"index" json:"last_message_at"` // last activity, the creation time until a message is sent
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// Filled in for the user reading the conversation
+	Participants []ParticipantSummary `gorm:"-" json:"participants"`
+	LastMessage  *Message             `gorm:"-" json:"last_message,omitempty"`
+	UnreadCount  int64                `gorm:"-" json:"unread_count"`
+}
+
+// TableName specifies the table name for Conversation
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// ConversationParticipant is a member of a conversation and how far they have read it
+type ConversationParticipant struct {
+	ConversationID    string     `gorm:"type:varchar(36);primaryKey"`
+	UserID            string     `gorm:"type:varchar(36);primaryKey;index"`
+	LastReadMessageID string     `gorm:"type:varchar(36);not null;default:''"`
+	LastReadAt        *time.Time // created_at of the last message read
+	JoinedAt          time.Time  `gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for ConversationParticipant
+func (ConversationParticipant) TableName() string {
+	return "conversation_participants"
+}
+
+// ParticipantSummary is a participant shown on a conversation, with their read receipt
+type ParticipantSummary struct {
+	UserID            string     `json:"user_id"`
+	Name              string     `json:"name"`
+	Username          string     `json:"username"`
+	LastReadMessageID string     `json:"last_read_message_id,omitempty"`
+	LastReadAt        *time.Time `json:"last_read_at,omitempty"`
+}
+
+// Message is a message sent to a conversation
+type Message struct {
+	MessageID      string    `gorm:"type:varchar(36);primaryKey;index:idx_messages_conversation_created,priority:3" json:"message_id"`
+	ConversationID string    `gorm:"type:varchar(36);not null;index:idx_messages_conversation_created,priority:1" json:"conversation_id"`
+	SenderID       string    `gorm:"type:varchar(36);not null" json:"sender_id"`
+	Body           string    `gorm:"type:text;not null" json:"body" binding:"required"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime;index:idx_messages_conversation_created,priority:2"`
+
+	// Other participants who have read up to this message
+	ReadBy []string `gorm:"-" json:"read_by,omitempty"`
+}
+
+// TableName specifies the table name for Message
+func (Message) TableName() string {
+	return "messages"
+}
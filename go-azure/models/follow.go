@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Follow records that FollowerID follows FolloweeID
+type Follow struct {
+	FollowerID string    `json:"follower_id" gorm:"primaryKey;type:varchar(36)"`
+	FolloweeID string    `json:"followee_id" gorm:"primaryKey;type:varchar(36);index"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for Follow
+func (Follow) TableName() string {
+	return "follows"
+}
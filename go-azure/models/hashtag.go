@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// PostHashtag records that a post contains a #hashtag. Tags are stored lowercase without the "#".
+// CreatedAt is the post's creation time so tag pages can be read in post order from the index.
+type PostHashtag struct {
+	Tag       string    `gorm:"type:varchar(100);primaryKey;index:idx_post_hashtags_tag_created,priority:1" json:"tag"`
+	PostID    string    `gorm:"type:varchar(75);primaryKey;index;index:idx_post_hashtags_tag_created,priority:3" json:"post_id"`
+	CreatedAt time.Time `gorm:"not null;index;index:idx_post_hashtags_tag_created,priority:2" json:"created_at"`
+}
+
+// TableName specifies the table name for PostHashtag
+func (PostHashtag) TableName() string {
+	return "post_hashtags"
+}
+
+// PostMention records that a post @mentions a user
+type PostMention struct {
+	PostID    string    `gorm:"type:varchar(75);primaryKey" json:"post_id"`
+	UserID    string    `gorm:"type:varchar(36);primaryKey;index" json:"user_id"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
+
+// TableName specifies the table name for PostMention
+func (PostMention) TableName() string {
+	return "post_mentions"
+}
+
+// TrendingTag is a hashtag with the number of posts using it in the trending window
+type TrendingTag struct {
+	Tag       string `json:"tag"`
+	PostCount int64  `json:"post_count"`
+}
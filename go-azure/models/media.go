@@ -0,0 +1,81 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// Media processing states. Resized variants are generated in the background after upload.
+const (
+	MediaStatusPending    = "pending"
+	MediaStatusProcessing = "processing"
+	MediaStatusReady      = "ready"
+	MediaStatusFailed     = "failed"
+)
+
+// Media is an uploaded image. The file itself lives in the BlobStore under StorageKey.
+type Media struct {
+	MediaID     string    `json:"media_id" gorm:"type:varchar(36);primaryKey"`
+	UserID      string    `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	ContentType string    `json:"content_type" gorm:"type:varchar(50);not null"`
+	Size        int64     `json:"size" gorm:"not null"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Checksum    string    `json:"-" gorm:"type:char(64);not null"` // SHA-256 of the stored file, served as the ETag
+	StorageKey  string    `json:"-" gorm:"type:varchar(255);not null"`
+	Status      string    `json:"status" gorm:"type:varchar(20);not null;default:pending;index"`
+	Blurhash    string    `json:"blurhash,omitempty" gorm:"type:varchar(64)"`
+	URL         string    `json:"url" gorm:"-"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for Media
+func (Media) TableName() string {
+	return "media"
+}
+
+// MediaVariant is a resized copy of a Media image
+type MediaVariant struct {
+	MediaID     string    `json:"media_id" gorm:"type:varchar(36);primaryKey"`
+	Width       int       `json:"width" gorm:"primaryKey;autoIncrement:false"`
+	Height      int       `json:"height" gorm:"not null"`
+	ContentType string    `json:"content_type" gorm:"type:varchar(50);not null"`
+	Size        int64     `json:"size" gorm:"not null"`
+	Checksum    string    `json:"-" gorm:"type:char(64);not null"`
+	StorageKey  string    `json:"-" gorm:"type:varchar(255);not null"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for MediaVariant
+func (MediaVariant) TableName() string {
+	return "media_variants"
+}
+
+// ImageSet describes a post image and its resized variants, smallest first, for use
+// in an <img srcset>. The original image is always the last variant.
+type ImageSet struct {
+	URL      string         `json:"url"`
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	Blurhash string         `json:"blurhash,omitempty"`
+	Variants []ImageVariant `json:"variants"`
+	Srcset   string         `json:"srcset"`
+}
+
+// ImageVariant is one candidate of an ImageSet
+type ImageVariant struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// MediaURL is the path the media is served from
+func MediaURL(mediaID string) string {
+	return "/media/" + mediaID
+}
+
+// MediaVariantURL is the path a resized variant is served from
+func MediaVariantURL(mediaID string, width int) string {
+	return MediaURL(mediaID) + "/" + strconv.Itoa(width)
+}
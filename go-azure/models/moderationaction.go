@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Moderation target types
+const (
+	ModerationTargetPost    = "post"
+	ModerationTargetComment = "comment"
+)
+
+// Moderation actions
+const (
+	ModerationActionDelete  = "delete"
+	ModerationActionUpdate  = "update"
+	ModerationActionRestore = "restore"
+)
+
+// ModerationAction records a moderator acting on content owned by another user
+type ModerationAction struct {
+	ID           string    `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	ModeratorID  string    `json:"moderator_id" gorm:"type:varchar(36);not null;index"`
+	TargetType   string    `json:"target_type" gorm:"type:varchar(20);not null;index:idx_moderation_actions_target,priority:1"`
+	TargetID     string    `json:"target_id" gorm:"type:varchar(75);not null;index:idx_moderation_actions_target,priority:2"`
+	TargetUserID string    `json:"target_user_id" gorm:"type:varchar(36);not null;index"`
+	Action       string    `json:"action" gorm:"type:varchar(20);not null"`
+	Reason       string    `json:"reason" gorm:"type:text;not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// TableName specifies the table name for ModerationAction
+func (ModerationAction) TableName() string {
+	return "moderation_actions"
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Notification types
+const (
+	NotificationComment  = "comment"  // someone commented on your post
+	NotificationReply    = "reply"    // someone replied to your comment
+	NotificationLike     = "like"     // someone liked your post or comment
+	NotificationReaction = "reaction" // someone reacted to your post or comment with another reaction type
+	NotificationMention  = "mention"  // someone mentioned you in a post
+	NotificationFollow   = "follow"   // someone followed you
+)
+
+// Notification tells a user that others interacted with them. Repeated events with the same
+// GroupKey are folded into one unread notification, such as "Ana and 12 others liked your post".
+type Notification struct {
+	NotificationID string     `gorm:"type:varchar(36);primaryKey;index:idx_notifications_user_updated,priority:3" json:"notification_id"`
+	UserID         string     `gorm:"type:varchar(36);not null;index:idx_notifications_user_updated,priority:1;index:idx_notifications_user_group,priority:1" json:"user_id"`
+	Type           string     `gorm:"type:varchar(20);not null" json:"type"`
+	GroupKey       string     `gorm:"type:varchar(200);not null;index:idx_notifications_user_group,priority:2" json:"-"`
+	PostID         string     `gorm:"type:varchar(75)" json:"post_id,omitempty"`
+	CommentID      string     `gorm:"type:varchar(75)" json:"comment_id,omitempty"`
+	ActorCount     int64      `gorm:"not null;default:0" json:"actor_count"`
+	LastActorID    string     `gorm:"type:varchar(36)" json:"-"`
+	IsRead         bool       `gorm:"not null;default:false;index" json:"is_read"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"index:idx_notifications_user_updated,priority:2"` // time of the latest event
+
+	// Filled in when notifications are listed
+	Actors  []NotificationActorSummary `gorm:"-" json:"actors,omitempty"`
+	Message string                     `gorm:"-" json:"message,omitempty"`
+}
+
+// TableName specifies the table name for Notification
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// NotificationActor records a distinct user behind a grouped notification
+type NotificationActor struct {
+	NotificationID string    `gorm:"type:varchar(36);primaryKey"`
+	ActorID        string    `gorm:"type:varchar(36);primaryKey"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for NotificationActor
+func (NotificationActor) TableName() string {
+	return "notification_actors"
+}
+
+// NotificationActorSummary is a user shown on a notification
+type NotificationActorSummary struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Resources personal access tokens can be scoped to
+const (
+	ResourcePosts = "posts"
+	ResourceTasks = "tasks"
+)
+
+// Personal access token scopes. A scope ending in ":*" grants every action on its resource.
+const (
+	ScopePostsRead  = "posts:read"
+	ScopePostsWrite = "posts:write"
+	ScopePostsAll   = "posts:*"
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+	ScopeTasksAll   = "tasks:*"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, telling them apart from JWTs
+const PersonalAccessTokenPrefix = "pat_"
+
+// PersonalAccessToken is a long-lived token a user created for scripts and integrations. Only a
+// hash of the token is stored; the token itself is shown once, when it is created.
+type PersonalAccessToken struct {
+	TokenID    string     `gorm:"type:varchar(36);primaryKey" json:"token_id"`
+	UserID     string     `gorm:"type:varchar(36);not null;index" json:"-"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	TokenHash  string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"`
+	Scopes     Scopes     `gorm:"type:varchar(255);not null" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"` // nil for tokens that never expire
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for PersonalAccessToken
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// IsValidScope reports whether scope is one of the known personal access token scopes
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopePostsRead, ScopePostsWrite, ScopePostsAll, ScopeTasksRead, ScopeTasksWrite, ScopeTasksAll:
+		return true
+	}
+	return false
+}
+
+// Scopes is a list of scopes, stored space-separated
+type Scopes []string
+
+// Has reports whether the scopes grant scope, directly or through the wildcard of its resource
+func (s Scopes) Has(scope string) bool {
+	resource, _, _ := strings.Cut(scope, ":")
+	for _, granted := range s {
+		if granted == scope || granted == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Value implements driver.Valuer
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+// Scan implements sql.Scanner
+func (s *Scopes) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case string:
+		*s = strings.Fields(value)
+	case []byte:
+		*s = strings.Fields(string(value))
+	case nil:
+		*s = nil
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", value)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReactionLike is the reaction type behind the like endpoints
+const ReactionLike = "like"
+
+// Reaction is a user's reaction to a post, or to a comment when CommentID is set.
+// A user has at most one reaction per post or comment; reacting again changes its type.
+type Reaction struct {
+	ReactionID string         `gorm:"type:varchar(75);primaryKey" json:"reaction_id"`
+	PostID     string         `gorm:"type:varchar(75);not null;uniqueIndex:idx_reactions_target_user,priority:1;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"post_id"`
+	CommentID  string         `gorm:"type:varchar(75);not null;default:'';index;uniqueIndex:idx_reactions_target_user,priority:2" json:"comment_id,omitempty"`
+	UserID     string         `gorm:"type:varchar(36);not null;index;uniqueIndex:idx_reactions_target_user,priority:3;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"user_id"`
+	Type       string         `gorm:"type:varchar(20);not null" json:"type"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// TableName specifies the table name for Reaction
+func (Reaction) TableName() string {
+	return "reactions"
+}
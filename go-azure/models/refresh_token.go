@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RefreshToken is a persisted refresh token. Only a hash of the token is stored. Each login starts
+// a family, one per device; every refresh uses up the token and adds the next one to the family.
+type RefreshToken struct {
+	TokenID    string     `gorm:"type:varchar(36);primaryKey" json:"-"`
+	FamilyID   string     `gorm:"type:varchar(36);not null;index" json:"-"`
+	UserID     string     `gorm:"type:varchar(36);not null;index" json:"-"`
+	TokenHash  string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"`
+	UserAgent  string     `gorm:"type:varchar(255);not null;default:''" json:"-"` // the device the family was issued to
+	ReplacedBy string     `gorm:"type:varchar(36);not null;default:''" json:"-"`
+	UsedAt     *time.Time `json:"-"`
+	RevokedAt  *time.Time `gorm:"index" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"-"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"-"`
+}
+
+// TableName specifies the table name for RefreshToken
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
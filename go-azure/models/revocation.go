@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// RevokedToken is an access token revoked before it expires, keyed by its jti claim
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;type:varchar(36);primaryKey"`
+	UserID    string    `gorm:"type:varchar(36);not null;index"`
+	ExpiresAt time.Time `gorm:"not null;index"` // the token's expiry, after which the entry can be pruned
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for RevokedToken
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
+
+// UserTokenRevocation revokes every access token of a user issued at or before RevokedBefore
+type UserTokenRevocation struct {
+	UserID        string    `gorm:"type:varchar(36);primaryKey"`
+	RevokedBefore time.Time `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null;index"` // when every token issued before RevokedBefore has expired
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for UserTokenRevocation
+func (UserTokenRevocation) TableName() string {
+	return "user_token_revocations"
+}
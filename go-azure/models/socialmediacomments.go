@@ -2,16 +2,31 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
+// DeletedCommentText replaces the text of a deleted comment that still has replies
+const DeletedCommentText = "[deleted]"
+
 // Social Media Post represents a task in the system
 type SocialMediaComments struct {
-	CommentID   string    `gorm:"type:varchar(75);primaryKey" json:"comment_id"`
-	PostID      string    `gorm:"type:varchar(75);not null;index;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"post_id"`
-	UserID      string    `gorm:"type:varchar(36);not null;index;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"user_id"`
-	CommentText string    `gorm:"type:text;not null;" json:"comment_text"`
-	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	CommentID       string         `gorm:"type:varchar(75);primaryKey" json:"comment_id"`
+	PostID          string         `gorm:"type:varchar(75);not null;index;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"post_id"`
+	UserID          string         `gorm:"type:varchar(36);not null;index;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"user_id"`
+	ParentCommentID *string        `gorm:"type:varchar(75);index" json:"parent_comment_id"`
+	Path            string         `gorm:"type:varchar(500);not null;default:'';index" json:"-"` // ancestor comment IDs and this one, joined by "/"
+	Depth           int            `gorm:"not null;default:0" json:"depth"`
+	CommentText     string         `gorm:"type:text;not null;" json:"comment_text" binding:"required"`
+	IsDeleted       bool           `gorm:"not null;default:false" json:"is_deleted"`
+	CreatedAt       time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Computed from reactions for the user reading the comment
+	Reactions     map[string]int64 `gorm:"-" json:"reactions,omitempty"`
+	ReactionCount int64            `gorm:"-" json:"reaction_count"`
+	MyReaction    string           `gorm:"-" json:"my_reaction,omitempty"`
 }
 
 // TableName specifies the table name for Task
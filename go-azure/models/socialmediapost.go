@@ -2,18 +2,32 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Social Media Post represents a task in the system
 type SocialMediaPost struct {
-	PostID    string    `gorm:"type:varchar(75);primaryKey" json:"post_id"`
-	UserID    string    `gorm:"type:varchar(36);not null;index;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"user_id"`
-	PostText  string    `gorm:"type:text;not null;" json:"post_text"`
-	PostImage string    `gorm:"type:text;not null;" json:"post_image"`
-	Likes     int       `gorm:"type:int;not null" json:"likes"`
-	IsLiked   bool      `gorm:"type:bool;not null" json:"is_liked"`
-	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	PostID    string         `gorm:"type:varchar(75);primaryKey;index:idx_social_media_posts_created_post,priority:2;index:idx_social_media_posts_user_created,priority:3" json:"post_id"`
+	UserID    string         `gorm:"type:varchar(36);not null;index;index:idx_social_media_posts_user_created,priority:1;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"user_id"`
+	PostText  string         `gorm:"type:text;not null;" json:"post_text"`
+	PostImage string         `gorm:"type:text;not null;" json:"post_image"`
+	MediaID   string         `gorm:"type:varchar(36);index" json:"media_id,omitempty"`
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime;index:idx_social_media_posts_created_post,priority:1;index:idx_social_media_posts_user_created,priority:2"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	DeletedBy string         `json:"deleted_by,omitempty" gorm:"type:varchar(36)"`
+
+	// Computed from reactions for the user reading the post. Reactions counts each
+	// reaction type used on the post; LikeCount and IsLiked cover the "like" type.
+	Reactions     map[string]int64 `gorm:"-" json:"reactions,omitempty"`
+	ReactionCount int64            `gorm:"-" json:"reaction_count"`
+	MyReaction    string           `gorm:"-" json:"my_reaction,omitempty"`
+	LikeCount     int64            `gorm:"-" json:"like_count"`
+	IsLiked       bool             `gorm:"-" json:"is_liked"`
+
+	// Resized variants of the uploaded image, filled in from media and media_variants
+	Image *ImageSet `gorm:"-" json:"image,omitempty"`
 }
 
 // TableName specifies the table name for Task
@@ -1,11 +1,22 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Task priorities
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
 // Task represents a task in the system
 type Task struct {
 	ID          string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
@@ -16,9 +27,68 @@ type Task struct {
 	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	// ParentTaskID is the task this is a subtask of; subtasks cannot have subtasks of their own
+	ParentTaskID *string    `json:"parent_task_id" gorm:"type:varchar(36);index"`
+	DueDate      *time.Time `json:"due_date"`
+	Priority     string     `json:"priority" gorm:"type:varchar(10);not null;default:medium"`
+	Position     int        `json:"position" gorm:"not null;default:0"` // order among the tasks with the same parent, from 0
+	Labels       Labels     `json:"labels" gorm:"type:json"`
+
+	// Filled in on top-level tasks, ordered by position
+	Subtasks []*Task `json:"subtasks,omitempty" gorm:"-"`
 }
 
 // TableName specifies the table name for Task
 func (Task) TableName() string {
 	return "tasks"
 }
+
+// IsValidPriority reports whether priority is one of the known task priorities
+func IsValidPriority(priority string) bool {
+	switch priority {
+	case PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent:
+		return true
+	}
+	return false
+}
+
+// Labels is a list of free-form task labels, stored as a JSON array
+type Labels []string
+
+// Value implements driver.Valuer
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		l = Labels{}
+	}
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner. Tasks created before labels existed have none.
+func (l *Labels) Scan(value interface{}) error {
+	var data []byte
+	switch value := value.(type) {
+	case string:
+		data = []byte(value)
+	case []byte:
+		data = value
+	case nil:
+		*l = Labels{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Labels", value)
+	}
+
+	labels := Labels{}
+	if err := json.Unmarshal(data, (*[]string)(&labels)); err != nil {
+		return err
+	}
+	if labels == nil {
+		labels = Labels{}
+	}
+	*l = labels
+	return nil
+}
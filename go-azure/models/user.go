@@ -1,20 +1,47 @@
 package models
 
 import (
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 // User represents a user in the system
 type User struct {
-	ID        string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
-	Email     string         `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
-	Name      string         `json:"name" gorm:"type:varchar(255);not null"`
-	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
-	Tasks     []Task         `json:"tasks,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	ID            string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	Email         *string        `json:"email" gorm:"type:varchar(255);uniqueIndex"` // nil until a provider verified the user's address
+	Name          string         `json:"name" gorm:"type:varchar(255);not null"`
+	NameEdited    bool           `json:"-" gorm:"not null;default:false"` // the user set Name, so logins no longer sync it from Microsoft
+	Username      string         `json:"username" gorm:"type:varchar(30);uniqueIndex;not null"`
+	Role          string         `json:"role" gorm:"type:varchar(20);not null;default:user"`
+	RoleEdited    bool           `json:"-" gorm:"not null;default:false"` // an admin set Role, so ADMIN_EMAILS no longer promotes the user
+	Bio           string         `json:"bio" gorm:"type:varchar(500);not null;default:''"`
+	AvatarMediaID string         `json:"avatar_media_id,omitempty" gorm:"type:varchar(36)"`
+	CreatedAt     time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+	Tasks         []Task         `json:"tasks,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+
+	// Filled in on the user's own profile
+	AvatarURL string     `json:"avatar_url,omitempty" gorm:"-"`
+	Stats     *UserStats `json:"stats,omitempty" gorm:"-"`
+}
+
+// UserStats counts a user's posts and follows
+type UserStats struct {
+	PostsCount     int64 `json:"posts_count"`
+	FollowersCount int64 `json:"followers_count"`
+	FollowingCount int64 `json:"following_count"`
 }
 
 // TableName specifies the table name for User
@@ -22,11 +49,101 @@ func (User) TableName() string {
 	return "users"
 }
 
+// usernamePattern is the shape of a handle that can be @mentioned
+var usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,29}$`)
+
+// IsValidUsername reports whether username is a valid lowercase handle
+func IsValidUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+// EmailAddress returns the user's verified email address, or "" when they have none
+func (u *User) EmailAddress() string {
+	if u.Email == nil {
+		return ""
+	}
+	return *u.Email
+}
+
+// BeforeCreate gives new users a unique username derived from their email address, or their name
+// when they have none
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.Username != "" {
+		return nil
+	}
+	source := u.EmailAddress()
+	if source == "" {
+		source = strings.ReplaceAll(u.Name, " ", ".")
+	}
+	username, err := UniqueUsername(tx, source)
+	if err != nil {
+		return err
+	}
+	u.Username = username
+	return nil
+}
+
+// UniqueUsername derives a valid handle from the local part of an email address,
+// adding a number when the handle is already taken. Handles that would not start with a
+// letter are prefixed with "user".
+func UniqueUsername(tx *gorm.DB, email string) (string, error) {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+
+	var builder strings.Builder
+	for _, r := range local {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			builder.WriteRune(r)
+		case r == '.' || r == '-' || r == '+':
+			builder.WriteRune('_')
+		}
+	}
+	base := strings.Trim(builder.String(), "_")
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if len(base) < 3 || base[0] < 'a' || base[0] > 'z' {
+		base = "user" + base
+	}
+
+	var taken []string
+	if err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&User{}).
+		Where("username LIKE ?", base+"%").
+		Pluck("username", &taken).Error; err != nil {
+		return "", err
+	}
+	takenSet := make(map[string]bool, len(taken))
+	for _, username := range taken {
+		takenSet[username] = true
+	}
+
+	username := base
+	for n := 2; takenSet[username]; n++ {
+		username = base + strconv.Itoa(n)
+	}
+	return username, nil
+}
+
+// IsValidRole reports whether role is one of the known user roles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// CanModerate reports whether the role may edit or remove other users' content
+func CanModerate(role string) bool {
+	return role == RoleModerator || role == RoleAdmin
+}
+
 // TokenDetails contains the JWT token details
 type TokenDetails struct {
-	AccessToken  string    `json:"access_token"`
-	RefreshToken string    `json:"refresh_token,omitempty"`
-	TokenType    string    `json:"token_type"`
-	ExpiresIn    int64     `json:"expires_in"`
-	ExpiresAt    time.Time `json:"-"`
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token,omitempty"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int64     `json:"expires_in"`
+	ExpiresAt        time.Time `json:"-"`
+	RefreshExpiresIn int64     `json:"refresh_expires_in,omitempty"`
 }
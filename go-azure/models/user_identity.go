@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// UserIdentity links an account at an identity provider to a user. A user can sign in with every
+// identity linked to them.
+type UserIdentity struct {
+	Provider    string    `gorm:"type:varchar(30);primaryKey" json:"provider"`
+	Subject     string    `gorm:"type:varchar(255);primaryKey" json:"-"` // the provider's stable ID for the account
+	UserID      string    `gorm:"type:varchar(36);not null;index" json:"-"`
+	Email       string    `gorm:"type:varchar(255);not null;default:''" json:"email"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"linked_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// TableName specifies the table name for UserIdentity
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -6,7 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"net/http"
+	"sort"
 	"time"
 
 	"go-azure/config"
@@ -16,35 +16,101 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/microsoft"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	// ErrInvalidRefreshToken is returned for refresh tokens that are unknown, expired or revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a used refresh token is presented again. The token
+	// may have been stolen, so every token of its family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token already used")
+	// ErrTokenRevoked is returned for access tokens revoked by signing out
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrInvalidOAuthState is returned when a login callback's state is unknown, expired or already used
+	ErrInvalidOAuthState = errors.New("invalid oauth state")
+	// ErrInvalidIDToken is returned when the ID token of a login is missing, expired, for another
+	// client or does not carry the nonce of the login
+	ErrInvalidIDToken = errors.New("invalid id token")
+	// ErrInvalidLoginCode is returned for login codes that are unknown, expired or already exchanged
+	ErrInvalidLoginCode = errors.New("invalid login code")
+	// ErrIdentityLinked is returned when linking an identity that is already linked to another user
+	ErrIdentityLinked = errors.New("identity is linked to another user")
+	// ErrInvalidStreamTicket is returned for stream tickets that are unknown, expired or already used
+	ErrInvalidStreamTicket = errors.New("invalid stream ticket")
+	// ErrEmailNotVerified is returned when a new identity has the email address of an existing user
+	// but the identity provider did not verify it
+	ErrEmailNotVerified = errors.New("email address not verified by the identity provider")
+)
+
+const (
+	// maxUserAgentLength is the longest user agent stored with a refresh token
+	maxUserAgentLength = 255
+	// oauthLoginTTL is how long a user has to complete a login after starting it
+	oauthLoginTTL = 10 * time.Minute
+	// oauthLoginKeyPrefix prefixes the cache keys of logins in progress, followed by the state
+	oauthLoginKeyPrefix = "oauth_login:"
+	// loginCodeTTL is how long the frontend has to exchange the code it was redirected with
+	loginCodeTTL = time.Minute
+	// loginCodeKeyPrefix prefixes the cache keys of login codes, followed by the code's hash
+	loginCodeKeyPrefix = "login_code:"
+	// StreamTicketTTL is how long a client has to open a stream with a ticket
+	StreamTicketTTL = 30 * time.Second
+	// streamTicketKeyPrefix prefixes the cache keys of stream tickets, followed by the ticket's hash
+	streamTicketKeyPrefix = "stream_ticket:"
+)
+
+// oauthLogin holds the secrets of a login in progress until its callback
+type oauthLogin struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	LinkUserID   string `json:"link_user_id,omitempty"` // the signed-in user linking another identity
+}
+
 // AuthService handles authentication operations
 type AuthService struct {
-	config *config.Config
-	logger *logrus.Logger
-	db     *gorm.DB
+	config      *config.Config
+	logger      *logrus.Logger
+	db          *gorm.DB
+	cache       utils.Cache
+	revocations utils.RevocationStore
+	keys        *utils.KeyRing
+	providers   map[string]IdentityProvider
 }
 
-// NewAuthService creates a new AuthService
-func NewAuthService(config *config.Config) *AuthService {
+// NewAuthService creates a new AuthService. Users sign in with the identity providers, keyed by
+// name. Access tokens are signed with keys and those revoked by signing out are kept in revocations.
+func NewAuthService(config *config.Config, revocations utils.RevocationStore, keys *utils.KeyRing, providers map[string]IdentityProvider) *AuthService {
 	return &AuthService{
-		config: config,
-		logger: utils.GetLogger(),
-		db:     utils.GetDB(),
+		config:      config,
+		logger:      utils.GetLogger(),
+		db:          utils.GetDB(),
+		cache:       utils.GetCache(),
+		revocations: revocations,
+		keys:        keys,
+		providers:   providers,
 	}
 }
 
-// GetMicrosoftOAuthConfig returns the OAuth2 config for Microsoft
-func (s *AuthService) GetMicrosoftOAuthConfig() *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     s.config.MicrosoftClientID,
-		ClientSecret: s.config.MicrosoftClientSecret,
-		RedirectURL:  s.config.MicrosoftRedirectURI,
-		Scopes:       []string{"openid", "profile", "email", "offline_access", "User.Read"},
-		Endpoint:     microsoft.AzureADEndpoint(s.config.MicrosoftTenantID),
+// Providers returns the names of the configured identity providers
+func (s *AuthService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
+
+// Provider returns the configured identity provider with the name
+func (s *AuthService) Provider(name string) (IdentityProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
 }
 
 // GenerateState generates a random state string for OAuth
@@ -54,129 +120,570 @@ func (s *AuthService) GenerateState() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(b), nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-// GetMicrosoftLoginURL returns the URL for Microsoft login
-func (s *AuthService) GetMicrosoftLoginURL(state string) string {
-	return s.GetMicrosoftOAuthConfig().AuthCodeURL(state)
+// StartLogin starts a login with the identity provider and returns its state and the login URL.
+// The PKCE code verifier and the OpenID Connect nonce are kept until the callback presents the
+// state. When linkUserID is set, the identity the user logs in with is linked to that user.
+func (s *AuthService) StartLogin(providerName string, loginHint string, linkUserID string) (string, string, error) {
+	provider, err := s.Provider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := s.GenerateState()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := s.GenerateState()
+	if err != nil {
+		return "", "", err
+	}
+	login := oauthLogin{
+		Provider:     providerName,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+	}
+
+	loginURL, err := provider.LoginURL(context.Background(), LoginRequest{
+		State:        state,
+		CodeVerifier: login.CodeVerifier,
+		Nonce:        login.Nonce,
+		LoginHint:    loginHint,
+	})
+	if err != nil {
+		s.logger.WithError(err).WithField("provider", providerName).Error("Failed to build login URL")
+		return "", "", err
+	}
+
+	data, err := json.Marshal(login)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.cache.Set(context.Background(), oauthLoginKeyPrefix+state, string(data), oauthLoginTTL); err != nil {
+		s.logger.WithError(err).Error("Failed to store login state")
+		return "", "", err
+	}
+
+	return state, loginURL, nil
 }
 
-// HandleMicrosoftCallback handles the callback from Microsoft OAuth
-func (s *AuthService) HandleMicrosoftCallback(code string) (*models.TokenDetails, *models.User, error) {
-	// Exchange code for token
-	oauth2Config := s.GetMicrosoftOAuthConfig()
-	token, err := oauth2Config.Exchange(context.Background(), code)
+// HandleCallback handles the callback from an identity provider. The state must come from
+// StartLogin for the same provider and can be used once. The tokens start a new refresh token
+// family for the device identified by userAgent.
+func (s *AuthService) HandleCallback(providerName string, code string, state string, userAgent string) (*models.TokenDetails, *models.User, error) {
+	provider, err := s.Provider(providerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := s.cache.GetDel(context.Background(), oauthLoginKeyPrefix+state)
+	if errors.Is(err, utils.ErrCacheMiss) {
+		return nil, nil, ErrInvalidOAuthState
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get login state")
+		return nil, nil, err
+	}
+	var login oauthLogin
+	if err := json.Unmarshal([]byte(data), &login); err != nil {
+		return nil, nil, err
+	}
+	if login.Provider != providerName {
+		return nil, nil, ErrInvalidOAuthState
+	}
+
+	// Exchange code for the user's identity
+	identity, err := provider.Authenticate(context.Background(), code, LoginRequest{
+		State:        state,
+		CodeVerifier: login.CodeVerifier,
+		Nonce:        login.Nonce,
+	})
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to exchange code for token")
+		s.logger.WithError(err).WithField("provider", providerName).Error("Failed to authenticate with identity provider")
+		if errors.Is(err, ErrInvalidIDToken) {
+			return nil, nil, ErrInvalidIDToken
+		}
 		return nil, nil, err
 	}
 
-	// Get user info
-	userInfo, err := s.getUserInfo(token.AccessToken)
+	user, err := s.signInIdentity(providerName, identity, login.LinkUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Users listed in ADMIN_EMAILS are promoted to admin so the first admin can be bootstrapped.
+	// Only an address the provider verified on this login proves the user owns it. Once an admin
+	// has set the user's role, for example to demote them, logging in again does not undo it.
+	if identity.EmailVerified && s.config.IsAdminEmail(identity.Email) && user.Role != models.RoleAdmin && !user.RoleEdited {
+		if err := s.db.Model(user).Update("role", models.RoleAdmin).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to promote admin user")
+			return nil, nil, errors.New("failed to update user")
+		}
+		user.Role = models.RoleAdmin
+		s.logger.WithField("user_id", user.ID).Info("User promoted to admin from configuration")
+	}
+
+	// Generate JWT token
+	tokenDetails, refreshToken, err := s.generateTokens(user, uuid.New().String(), userAgent)
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to get user info")
 		return nil, nil, err
 	}
+	if err := s.db.Create(refreshToken).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to store refresh token")
+		return nil, nil, errors.New("failed to store refresh token")
+	}
+
+	return tokenDetails, user, nil
+}
 
-	// Check if user exists in database
+// signInIdentity returns the user an identity is linked to. An identity seen for the first time
+// is linked to linkUserID when set, otherwise to the user with its email address if the provider
+// verified it, otherwise to a new user.
+func (s *AuthService) signInIdentity(providerName string, identity *ExternalIdentity, linkUserID string) (*models.User, error) {
 	var user models.User
 
-	result := s.db.Where("email = ?", userInfo["userPrincipalName"].(string)).First(&user)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var linked models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", providerName, identity.Subject).First(&linked).Error
+		switch {
+		case err == nil:
+			if linkUserID != "" && linked.UserID != linkUserID {
+				return ErrIdentityLinked
+			}
+			if err := tx.Where("id = ?", linked.UserID).First(&user).Error; err != nil {
+				return err
+			}
 
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			// Create new user
-			user = models.User{
-				ID:        uuid.New().String(),
-				Email:     userInfo["userPrincipalName"].(string),
-				Name:      userInfo["displayName"].(string),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.findOrCreateUser(tx, identity, linkUserID, &user); err != nil {
+				return err
+			}
+			linked = models.UserIdentity{
+				Provider: providerName,
+				Subject:  identity.Subject,
+				UserID:   user.ID,
 			}
+			if err := tx.Create(&linked).Error; err != nil {
+				return err
+			}
+
+			s.logger.WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"provider": providerName,
+			}).Info("Identity linked")
 
-			// Save user to database
-			if err := s.db.Create(&user).Error; err != nil {
-				s.logger.WithError(err).Error("Failed to create user")
-				return nil, nil, errors.New("failed to create user")
+		default:
+			return err
+		}
+
+		if err := tx.Model(&linked).Updates(map[string]any{
+			"email":         identity.Email,
+			"last_login_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		// Update user information; a name the user edited is kept
+		if !user.NameEdited && identity.Name != "" && identity.Name != user.Name {
+			if err := tx.Model(&user).Update("name", identity.Name).Error; err != nil {
+				return err
 			}
+			user.Name = identity.Name
 
 			s.logger.WithFields(logrus.Fields{
 				"user_id": user.ID,
-				"email":   user.Email,
-			}).Info("New user created")
-		} else {
-			s.logger.WithError(result.Error).Error("Failed to query user")
-			return nil, nil, errors.New("failed to query user")
-		}
-	} else {
-		// Update user information
-		user.Name = userInfo["displayName"].(string)
-		user.UpdatedAt = time.Now()
-
-		if err := s.db.Save(&user).Error; err != nil {
-			s.logger.WithError(err).Error("Failed to update user")
-			return nil, nil, errors.New("failed to update user")
+				"name":    user.Name,
+				"email":   user.EmailAddress(),
+			}).Info("Existing user updated")
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrIdentityLinked) || errors.Is(err, ErrEmailNotVerified) {
+			return nil, err
+		}
+		s.logger.WithError(err).Error("Failed to sign in identity")
+		return nil, errors.New("failed to sign in")
+	}
+
+	return &user, nil
+}
+
+// findOrCreateUser finds the user a new identity belongs to, creating one when nobody has its email
+func (s *AuthService) findOrCreateUser(tx *gorm.DB, identity *ExternalIdentity, linkUserID string, user *models.User) error {
+	if linkUserID != "" {
+		return tx.Where("id = ?", linkUserID).First(user).Error
+	}
+
+	err := tx.Where("email = ?", identity.Email).First(user).Error
+	if err == nil {
+		// Anyone can claim an unverified address, so it must not sign them in as its owner
+		if !identity.EmailVerified {
+			return ErrEmailNotVerified
 		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
 
-		s.logger.WithFields(logrus.Fields{
-			"user_id": user.ID,
-			"name":    user.Name,
-			"email":   user.Email,
-		}).Info("Existing user updated")
+	// Create new user. An unverified address stays on the identity only, so nobody can create an
+	// account with someone else's address before they sign up.
+	*user = models.User{
+		ID:        uuid.New().String(),
+		Name:      identity.Name,
+		Role:      models.RoleUser,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if identity.EmailVerified {
+		user.Email = &identity.Email
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
 	}
 
-	// Generate JWT token
-	tokenDetails, err := utils.GenerateToken(user.ID, user.Email, user.Name, s.config.JWTSecret, s.config.JWTExpirationMinutes)
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"email":   user.EmailAddress(),
+	}).Info("New user created")
+	return nil
+}
+
+// GetIdentities returns the identities linked to the user
+func (s *AuthService) GetIdentities(userID string) ([]models.UserIdentity, error) {
+	identities := []models.UserIdentity{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get identities")
+		return nil, errors.New("failed to get identities")
+	}
+	return identities, nil
+}
+
+// LoginResult is what a login code is exchanged for
+type LoginResult struct {
+	Token *models.TokenDetails `json:"token"`
+	User  *models.User         `json:"user"`
+}
+
+// CreateLoginCode stores the result of a login under a new single-use code, which the frontend
+// exchanges for it instead of receiving the tokens in the redirect URL
+func (s *AuthService) CreateLoginCode(tokenDetails *models.TokenDetails, user *models.User) (string, error) {
+	data, err := json.Marshal(LoginResult{Token: tokenDetails, User: user})
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to generate JWT token")
-		return nil, nil, err
+		return "", err
 	}
 
-	return tokenDetails, &user, nil
+	code := rand.Text()
+	if err := s.cache.Set(context.Background(), loginCodeKeyPrefix+utils.HashRefreshToken(code), string(data), loginCodeTTL); err != nil {
+		return "", err
+	}
+	return code, nil
 }
 
-// getUserInfo gets user information from Microsoft Graph API
-func (s *AuthService) getUserInfo(accessToken string) (map[string]interface{}, error) {
-	// Create request
-	req, err := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/me", nil)
+// ExchangeLoginCode returns the result of the login the code was created for. Each code can be
+// exchanged once.
+func (s *AuthService) ExchangeLoginCode(code string) (*LoginResult, error) {
+	data, err := s.cache.GetDel(context.Background(), loginCodeKeyPrefix+utils.HashRefreshToken(code))
+	if errors.Is(err, utils.ErrCacheMiss) {
+		return nil, ErrInvalidLoginCode
+	}
 	if err != nil {
+		s.logger.WithError(err).Error("Failed to get login code")
 		return nil, err
 	}
 
-	// Add authorization header
-	req.Header.Add("Authorization", "Bearer "+accessToken)
+	var result LoginResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
 
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// CreateStreamTicket returns a single-use ticket that opens a stream as the holder of the access
+// token, for EventSource and WebSocket clients that cannot send an Authorization header. Tickets
+// end up in URLs and access logs, so they expire after StreamTicketTTL and the token never does.
+func (s *AuthService) CreateStreamTicket(accessToken string) (string, error) {
+	ticket := rand.Text()
+	if err := s.cache.Set(context.Background(), streamTicketKeyPrefix+utils.HashRefreshToken(ticket), accessToken, StreamTicketTTL); err != nil {
+		s.logger.WithError(err).Error("Failed to store stream ticket")
+		return "", errors.New("failed to create stream ticket")
+	}
+	return ticket, nil
+}
+
+// RedeemStreamTicket returns the access token the stream ticket was created for. Each ticket can
+// be redeemed once.
+func (s *AuthService) RedeemStreamTicket(ticket string) (string, error) {
+	accessToken, err := s.cache.GetDel(context.Background(), streamTicketKeyPrefix+utils.HashRefreshToken(ticket))
+	if errors.Is(err, utils.ErrCacheMiss) {
+		return "", ErrInvalidStreamTicket
+	}
 	if err != nil {
-		return nil, err
+		s.logger.WithError(err).Error("Failed to get stream ticket")
+		return "", errors.New("failed to validate stream ticket")
+	}
+	return accessToken, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and refresh token. Each refresh
+// token can be used once; presenting a used one again revokes its whole family.
+func (s *AuthService) RefreshTokens(refreshToken string) (*models.TokenDetails, error) {
+	var tokenDetails *models.TokenDetails
+	reused := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the token so concurrent refreshes with it are serialized and only the first succeeds
+		var current models.RefreshToken
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashRefreshToken(refreshToken)).
+			First(&current)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if current.RevokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+		if current.UsedAt != nil {
+			reused = true
+			return nil
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		var user models.User
+		if err := tx.Where("id = ?", current.UserID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		// The new access token carries the user's current role and name
+		var next *models.RefreshToken
+		var err error
+		tokenDetails, next, err = s.generateTokens(&user, current.FamilyID, current.UserAgent)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&current).Updates(map[string]any{
+			"used_at":     time.Now(),
+			"replaced_by": next.TokenID,
+		}).Error
+	})
+
+	if reused {
+		s.revokeFamily(refreshToken)
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return nil, err
+		}
+		s.logger.WithError(err).Error("Failed to refresh tokens")
+		return nil, errors.New("failed to refresh tokens")
+	}
+
+	return tokenDetails, nil
+}
+
+// revokeFamily revokes every token in the family of a refresh token that was used twice
+func (s *AuthService) revokeFamily(refreshToken string) {
+	var token models.RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashRefreshToken(refreshToken)).First(&token).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get reused refresh token")
+		return
 	}
-	defer resp.Body.Close()
 
-	// Check response
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to get user info: " + resp.Status)
+	result := s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", token.FamilyID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to revoke refresh token family")
+		return
 	}
 
-	// Parse response
-	var userInfo map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&userInfo)
+	s.logger.WithFields(logrus.Fields{
+		"user_id":   token.UserID,
+		"family_id": token.FamilyID,
+		"revoked":   result.RowsAffected,
+	}).Warn("Refresh token reused, token family revoked")
+}
+
+// SignOut revokes the access token with the jti until it expires. When refreshToken is not empty,
+// the refresh token family it belongs to is revoked too, so the device cannot get new access tokens.
+func (s *AuthService) SignOut(userID string, jti string, expiresAt time.Time, refreshToken string) error {
+	if err := s.revocations.Revoke(context.Background(), jti, userID, expiresAt); err != nil {
+		s.logger.WithError(err).Error("Failed to revoke access token")
+		return errors.New("failed to sign out")
+	}
+
+	if refreshToken != "" {
+		var token models.RefreshToken
+		err := s.db.Where("token_hash = ? AND user_id = ?", utils.HashRefreshToken(refreshToken), userID).First(&token).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.WithError(err).Error("Failed to get refresh token")
+			return errors.New("failed to sign out")
+		}
+		if err == nil {
+			if err := s.db.Model(&models.RefreshToken{}).
+				Where("family_id = ? AND revoked_at IS NULL", token.FamilyID).
+				Update("revoked_at", time.Now()).Error; err != nil {
+				s.logger.WithError(err).Error("Failed to revoke refresh token family")
+				return errors.New("failed to sign out")
+			}
+		}
+	}
+
+	s.logger.WithField("user_id", userID).Info("User signed out")
+	return nil
+}
+
+// SignOutEverywhere revokes every access token and refresh token issued to the user at or before
+// the given time, which is capped at now. A zero time signs out every session. It returns the
+// cutoff that was applied.
+func (s *AuthService) SignOutEverywhere(userID string, before time.Time) (time.Time, error) {
+	now := time.Now()
+	if before.IsZero() || before.After(now) {
+		before = now
+	}
+
+	// Access tokens issued before the cutoff have all expired one lifetime after it
+	expiresAt := before.Add(time.Duration(s.config.JWTExpirationMinutes) * time.Minute)
+	if err := s.revocations.RevokeUser(context.Background(), userID, before, expiresAt); err != nil {
+		s.logger.WithError(err).Error("Failed to revoke access tokens")
+		return time.Time{}, errors.New("failed to sign out")
+	}
+
+	result := s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND created_at <= ? AND revoked_at IS NULL", userID, before).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to revoke refresh tokens")
+		return time.Time{}, errors.New("failed to sign out")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":        userID,
+		"revoked_before": before,
+		"refresh_tokens": result.RowsAffected,
+	}).Info("User signed out everywhere")
+	return before, nil
+}
+
+// StartRevocationPruner removes revocations of expired access tokens until ctx is cancelled
+func (s *AuthService) StartRevocationPruner(ctx context.Context) {
+	interval := time.Duration(s.config.TokenRevocationPruneIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := s.revocations.Prune(ctx, time.Now())
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to prune token revocations")
+		} else if pruned > 0 {
+			s.logger.WithField("count", pruned).Info("Expired token revocations pruned")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// JWKS returns the public keys access tokens are verified with
+func (s *AuthService) JWKS() utils.JWKS {
+	return s.keys.JWKS()
+}
+
+// StartKeyRotation rotates the keys access tokens are signed with until ctx is cancelled. Keys
+// loaded from JWT_KEYS_DIR are reloaded instead, so added keys start signing and removed ones retire.
+func (s *AuthService) StartKeyRotation(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.keys.Maintain(now); err != nil {
+				s.logger.WithError(err).Error("Failed to maintain JWT signing keys")
+			}
+		}
+	}
+}
+
+// generateTokens creates an access token for the user and the refresh token to store for it
+func (s *AuthService) generateTokens(user *models.User, familyID string, userAgent string) (*models.TokenDetails, *models.RefreshToken, error) {
+	tokenDetails, err := utils.GenerateToken(user.ID, user.EmailAddress(), user.Name, user.Role, s.keys, s.config.JWTExpirationMinutes)
 	if err != nil {
-		return nil, err
+		s.logger.WithError(err).Error("Failed to generate JWT token")
+		return nil, nil, err
 	}
 
-	return userInfo, nil
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	ttl := time.Duration(s.config.RefreshTokenExpirationDays) * 24 * time.Hour
+	tokenDetails.RefreshExpiresIn = int64(ttl.Seconds())
+
+	return tokenDetails, &models.RefreshToken{
+		TokenID:   uuid.New().String(),
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		TokenHash: utils.HashRefreshToken(tokenDetails.RefreshToken),
+		UserAgent: userAgent,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// IsTokenRevoked reports whether the access token with the ID, issued to the user at issuedAt,
+// was revoked by signing out. Connections that outlive a request check it again while open.
+func (s *AuthService) IsTokenRevoked(jti string, userID string, issuedAt time.Time) (bool, error) {
+	revoked, err := s.revocations.IsRevoked(context.Background(), jti, userID, issuedAt)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to check token revocation")
+		return false, errors.New("failed to validate token")
+	}
+	return revoked, nil
 }
 
-// ValidateToken validates a JWT token
+// ValidateToken validates a JWT token and checks that it has not been revoked
 func (s *AuthService) ValidateToken(tokenString string) (map[string]interface{}, error) {
-	claims, err := utils.ValidateToken(tokenString, s.config.JWTSecret)
+	claims, err := utils.ValidateToken(tokenString, s.keys)
 	if err != nil {
 		return nil, err
 	}
 
+	jti, _ := claims["jti"].(string)
+	userID, _ := claims["user_id"].(string)
+	issuedAt, _ := claims["iat"].(int64)
+	revoked, err := s.IsTokenRevoked(jti, userID, time.Unix(issuedAt, 0))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
 	// Convert claims to map
 	result := make(map[string]interface{})
 	for key, value := range claims {
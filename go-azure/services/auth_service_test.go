@@ -0,0 +1,227 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/testutil"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newTestAuthService creates an AuthService signing with HS256 that keeps revocations in store
+func newTestAuthService(t *testing.T, store utils.RevocationStore) *AuthService {
+	t.Helper()
+
+	cfg := &config.Config{
+		JWTSigningAlgorithm:        "HS256",
+		JWTSecret:                  "test-secret",
+		JWTExpirationMinutes:       15,
+		RefreshTokenExpirationDays: 30,
+	}
+	keys, err := utils.NewKeyRing(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthService(cfg, store, keys, nil)
+}
+
+// signIn issues tokens to the user as a login does, starting a new refresh token family
+func signIn(t *testing.T, s *AuthService, user *models.User) *models.TokenDetails {
+	t.Helper()
+
+	tokenDetails, refreshToken, err := s.generateTokens(user, uuid.New().String(), "test-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(refreshToken).Error; err != nil {
+		t.Fatal(err)
+	}
+	return tokenDetails
+}
+
+func TestRefreshTokensRotatesTheToken(t *testing.T) {
+	db := testutil.OpenDB(t)
+	user := testutil.CreateUser(t, db, "alice")
+	s := newTestAuthService(t, utils.NewMemoryRevocationStore())
+
+	first := signIn(t, s, user)
+	second, err := s.RefreshTokens(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+	claims, err := s.ValidateToken(second.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken of the new access token: %v", err)
+	}
+	if claims["user_id"] != user.ID {
+		t.Errorf("user_id = %v, want %s", claims["user_id"], user.ID)
+	}
+
+	third, err := s.RefreshTokens(second.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokens with the rotated token: %v", err)
+	}
+
+	var tokens []models.RefreshToken
+	if err := db.Order("created_at").Find(&tokens).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 3 {
+		t.Fatalf("got %d refresh tokens, want 3", len(tokens))
+	}
+	byHash := make(map[string]models.RefreshToken, len(tokens))
+	for _, token := range tokens {
+		if token.FamilyID != tokens[0].FamilyID {
+			t.Error("rotated token started a new family")
+		}
+		byHash[token.TokenHash] = token
+	}
+	used := byHash[utils.HashRefreshToken(second.RefreshToken)]
+	if used.UsedAt == nil || used.ReplacedBy != byHash[utils.HashRefreshToken(third.RefreshToken)].TokenID {
+		t.Errorf("used token = %+v, want it used and replaced by the next one", used)
+	}
+}
+
+func TestRefreshTokensReuseRevokesFamily(t *testing.T) {
+	db := testutil.OpenDB(t)
+	user := testutil.CreateUser(t, db, "alice")
+	s := newTestAuthService(t, utils.NewMemoryRevocationStore())
+
+	first := signIn(t, s, user)
+	other := signIn(t, s, user)
+	second, err := s.RefreshTokens(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RefreshTokens(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("RefreshTokens with a used token = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	// The token it was replaced with is revoked along with the rest of the family
+	if _, err := s.RefreshTokens(second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshTokens after reuse = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	// Families of other devices are left alone
+	if _, err := s.RefreshTokens(other.RefreshToken); err != nil {
+		t.Errorf("RefreshTokens of another family: %v", err)
+	}
+}
+
+func TestRefreshTokensRejectsInvalidTokens(t *testing.T) {
+	db := testutil.OpenDB(t)
+	user := testutil.CreateUser(t, db, "alice")
+	s := newTestAuthService(t, utils.NewMemoryRevocationStore())
+
+	tests := []struct {
+		name   string
+		update func(tx *gorm.DB) *gorm.DB
+	}{
+		{name: "expired", update: func(tx *gorm.DB) *gorm.DB { return tx.Update("expires_at", time.Now().Add(-time.Minute)) }},
+		{name: "revoked", update: func(tx *gorm.DB) *gorm.DB { return tx.Update("revoked_at", time.Now()) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenDetails := signIn(t, s, user)
+			tx := db.Model(&models.RefreshToken{}).Where("token_hash = ?", utils.HashRefreshToken(tokenDetails.RefreshToken))
+			if err := test.update(tx).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.RefreshTokens(tokenDetails.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Errorf("RefreshTokens = %v, want %v", err, ErrInvalidRefreshToken)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := s.RefreshTokens("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("RefreshTokens = %v, want %v", err, ErrInvalidRefreshToken)
+		}
+	})
+}
+
+// revocationStores creates each RevocationStore on the test database
+var revocationStores = map[string]func(db *gorm.DB) utils.RevocationStore{
+	"memory":   func(db *gorm.DB) utils.RevocationStore { return utils.NewMemoryRevocationStore() },
+	"database": func(db *gorm.DB) utils.RevocationStore { return utils.NewDBRevocationStore(db) },
+}
+
+func TestSignOutRevokesTheToken(t *testing.T) {
+	for name, newStore := range revocationStores {
+		t.Run(name, func(t *testing.T) {
+			db := testutil.OpenDB(t)
+			user := testutil.CreateUser(t, db, "alice")
+			s := newTestAuthService(t, newStore(db))
+
+			signedOut := signIn(t, s, user)
+			other := signIn(t, s, user)
+			claims, err := s.ValidateToken(signedOut.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SignOut(user.ID, claims["jti"].(string), signedOut.ExpiresAt, signedOut.RefreshToken); err != nil {
+				t.Fatalf("SignOut: %v", err)
+			}
+
+			if _, err := s.ValidateToken(signedOut.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+				t.Errorf("ValidateToken of the signed out token = %v, want %v", err, ErrTokenRevoked)
+			}
+			if _, err := s.RefreshTokens(signedOut.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Errorf("RefreshTokens of the signed out device = %v, want %v", err, ErrInvalidRefreshToken)
+			}
+			// Other devices stay signed in
+			if _, err := s.ValidateToken(other.AccessToken); err != nil {
+				t.Errorf("ValidateToken of another device: %v", err)
+			}
+			if _, err := s.RefreshTokens(other.RefreshToken); err != nil {
+				t.Errorf("RefreshTokens of another device: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignOutEverywhereRevokesEarlierTokens(t *testing.T) {
+	for name, newStore := range revocationStores {
+		t.Run(name, func(t *testing.T) {
+			db := testutil.OpenDB(t)
+			user := testutil.CreateUser(t, db, "alice")
+			otherUser := testutil.CreateUser(t, db, "bob")
+			s := newTestAuthService(t, newStore(db))
+
+			first := signIn(t, s, user)
+			second := signIn(t, s, user)
+			unrelated := signIn(t, s, otherUser)
+			if _, err := s.SignOutEverywhere(user.ID, time.Time{}); err != nil {
+				t.Fatalf("SignOutEverywhere: %v", err)
+			}
+
+			for _, tokenDetails := range []*models.TokenDetails{first, second} {
+				if _, err := s.ValidateToken(tokenDetails.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+					t.Errorf("ValidateToken of an earlier token = %v, want %v", err, ErrTokenRevoked)
+				}
+				if _, err := s.RefreshTokens(tokenDetails.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+					t.Errorf("RefreshTokens of an earlier token = %v, want %v", err, ErrInvalidRefreshToken)
+				}
+			}
+			if _, err := s.ValidateToken(unrelated.AccessToken); err != nil {
+				t.Errorf("ValidateToken of another user: %v", err)
+			}
+
+			// Tokens are issued in whole seconds, so a login in the cutoff's second is revoked too
+			time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+			later := signIn(t, s, user)
+			if _, err := s.ValidateToken(later.AccessToken); err != nil {
+				t.Errorf("ValidateToken of a later login: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCommentNotFound is returned when a comment does not exist on the given post
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrCommentForbidden is returned when a user tries to modify someone else's comment
+	ErrCommentForbidden = errors.New("only the comment author or a moderator can modify this comment")
+	// ErrParentCommentNotFound is returned when replying to a comment that is not on the post or was deleted
+	ErrParentCommentNotFound = errors.New("parent comment not found")
+	// ErrCommentTooDeep is returned when replying to a comment at MaxCommentDepth
+	ErrCommentTooDeep = errors.New("replies cannot be nested any deeper")
+)
+
+const (
+	// MaxCommentDepth is the deepest a reply can be nested; top-level comments have depth 0
+	MaxCommentDepth = 5
+	// commentPreviewDepth is how many levels of replies are returned below each listed comment
+	commentPreviewDepth = 2
+	// commentPreviewReplies is how many replies are returned per comment in those levels
+	commentPreviewReplies = 3
+)
+
+// CommentThread is a comment with the first of its replies. When has_more_replies is set the
+// rest are fetched from the replies endpoint, starting after replies_cursor if there is one.
+type CommentThread struct {
+	models.SocialMediaComments
+	ReplyCount     int64            `json:"reply_count"`
+	Replies        []*CommentThread `json:"replies"`
+	HasMoreReplies bool             `json:"has_more_replies"`
+	RepliesCursor  string           `json:"replies_cursor,omitempty"`
+}
+
+// CommentRepliesPage is a page of the direct replies to a comment, oldest first
+type CommentRepliesPage struct {
+	Replies    []*CommentThread `json:"replies"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	HasMore    bool             `json:"has_more"`
+}
+
+// CommentService handles comment operations
+type CommentService struct {
+	db            *gorm.DB
+	logger        *logrus.Logger
+	notifications *NotificationService
+	stream        *StreamHub
+}
+
+// NewCommentService creates a new CommentService
+func NewCommentService(notifications *NotificationService, stream *StreamHub) *CommentService {
+	return &CommentService{
+		db:            utils.GetDB(),
+		logger:        utils.GetLogger(),
+		notifications: notifications,
+		stream:        stream,
+	}
+}
+
+// GetCommentsByPostID returns the top-level comments of a post with pagination, oldest first.
+// Each comment comes with a preview of its reply tree; deeper replies are loaded with GetReplies.
+func (s *CommentService) GetCommentsByPostID(postID string, page int, pageSize int, viewerID string) (map[string]any, error) {
+	var comments []models.SocialMediaComments
+	var totalCount int64
+
+	// Defaults
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	if err := s.ensurePostExists(postID); err != nil {
+		return nil, err
+	}
+
+	offset := (page - 1) * pageSize
+
+	query := s.db.Model(&models.SocialMediaComments{}).Where("post_id = ? AND parent_comment_id IS NULL", postID)
+
+	// Count total
+	if err := query.Count(&totalCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count comments")
+		return nil, err
+	}
+
+	// Fetch paginated comments
+	if err := query.
+		Order("created_at asc, comment_id asc").
+		Limit(pageSize).
+		Offset(offset).
+		Find(&comments).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get comments")
+		return nil, err
+	}
+
+	threads := newCommentThreads(comments)
+	if err := s.loadReplies(threads, commentPreviewDepth, viewerID); err != nil {
+		s.logger.WithError(err).Error("Failed to get replies")
+		return nil, err
+	}
+
+	totalPages := (totalCount + int64(pageSize) - 1) / int64(pageSize)
+
+	return map[string]any{
+		"comments":     threads,
+		"total_count":  totalCount,
+		"current_page": page,
+		"total_pages":  totalPages,
+	}, nil
+}
+
+// GetReplies returns the direct replies to a comment using keyset pagination on (created_at, comment_id),
+// each with a preview of its own replies
+func (s *CommentService) GetReplies(postID string, commentID string, cursor string, limit int, viewerID string) (*CommentRepliesPage, error) {
+	var replies []models.SocialMediaComments
+
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	var count int64
+	if err := s.db.Model(&models.SocialMediaComments{}).Where("comment_id = ? AND post_id = ?", commentID, postID).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to check comment")
+		return nil, errors.New("failed to get comment")
+	}
+	if count == 0 {
+		return nil, ErrCommentNotFound
+	}
+
+	query := s.db.Where("parent_comment_id = ?", commentID)
+	if cursor != "" {
+		position, err := utils.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at > ? OR (created_at = ? AND comment_id > ?)", position.CreatedAt, position.CreatedAt, position.ID)
+	}
+
+	hasMore, err := utils.FindPage(query.Order("created_at asc, comment_id asc"), limit, &replies)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get replies")
+		return nil, err
+	}
+
+	page := &CommentRepliesPage{HasMore: hasMore}
+	if page.HasMore {
+		last := replies[len(replies)-1]
+		page.NextCursor = utils.EncodeCursor(last.CreatedAt, last.CommentID)
+	}
+
+	page.Replies = newCommentThreads(replies)
+	if err := s.loadReplies(page.Replies, commentPreviewDepth, viewerID); err != nil {
+		s.logger.WithError(err).Error("Failed to get replies")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// loadReplies fills in the reactions and reply counts of threads and attaches up to commentPreviewReplies
+// replies to each, recursing levels deep. Each level is one ranked query for all its parents.
+func (s *CommentService) loadReplies(threads []*CommentThread, levels int, viewerID string) error {
+	for level := 0; len(threads) > 0; level++ {
+		byID := make(map[string]*CommentThread, len(threads))
+		ids := make([]string, 0, len(threads))
+		comments := make([]*models.SocialMediaComments, 0, len(threads))
+		for _, thread := range threads {
+			byID[thread.CommentID] = thread
+			ids = append(ids, thread.CommentID)
+			comments = append(comments, &thread.SocialMediaComments)
+		}
+
+		if err := attachCommentReactions(s.db, comments, viewerID); err != nil {
+			return err
+		}
+
+		var counts []struct {
+			ParentCommentID string
+			Count           int64
+		}
+		if err := s.db.Model(&models.SocialMediaComments{}).
+			Select("parent_comment_id, COUNT(*) AS count").
+			Where("parent_comment_id IN ?", ids).
+			Group("parent_comment_id").
+			Scan(&counts).Error; err != nil {
+			return err
+		}
+
+		parentIDs := make([]string, 0, len(counts))
+		for _, count := range counts {
+			byID[count.ParentCommentID].ReplyCount = count.Count
+			byID[count.ParentCommentID].HasMoreReplies = true
+			parentIDs = append(parentIDs, count.ParentCommentID)
+		}
+		if level == levels || len(parentIDs) == 0 {
+			return nil
+		}
+
+		// Number the replies of each parent and keep the first few
+		var replies []models.SocialMediaComments
+		ranked := s.db.Model(&models.SocialMediaComments{}).
+			Select("social_media_comments.*, ROW_NUMBER() OVER (PARTITION BY parent_comment_id ORDER BY created_at, comment_id) AS reply_rank").
+			Where("parent_comment_id IN ?", parentIDs)
+		if err := s.db.Table("(?) AS replies", ranked).
+			Where("reply_rank <= ?", commentPreviewReplies).
+			Order("created_at asc, comment_id asc").
+			Find(&replies).Error; err != nil {
+			return err
+		}
+
+		next := newCommentThreads(replies)
+		for _, reply := range next {
+			parent := byID[*reply.ParentCommentID]
+			parent.Replies = append(parent.Replies, reply)
+		}
+		for _, parentID := range parentIDs {
+			parent := byID[parentID]
+			parent.HasMoreReplies = parent.ReplyCount > int64(len(parent.Replies))
+			if parent.HasMoreReplies && len(parent.Replies) > 0 {
+				last := parent.Replies[len(parent.Replies)-1]
+				parent.RepliesCursor = utils.EncodeCursor(last.CreatedAt, last.CommentID)
+			}
+		}
+		threads = next
+	}
+	return nil
+}
+
+// newCommentThreads wraps comments in threads, hiding the author of deleted placeholders
+func newCommentThreads(comments []models.SocialMediaComments) []*CommentThread {
+	threads := make([]*CommentThread, 0, len(comments))
+	for _, comment := range comments {
+		if comment.IsDeleted {
+			comment.UserID = ""
+		}
+		threads = append(threads, &CommentThread{SocialMediaComments: comment, Replies: []*CommentThread{}})
+	}
+	return threads
+}
+
+// CreateComment adds a comment to a post
+func (s *CommentService) CreateComment(postID string, comment *models.SocialMediaComments, userID string) (*models.SocialMediaComments, error) {
+	var post models.SocialMediaPost
+	if err := s.db.Select("post_id, user_id").Where("post_id = ?", postID).First(&post).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
+		}
+		s.logger.WithError(err).Error("Failed to get social media post")
+		return nil, errors.New("failed to get social media post")
+	}
+
+	// Set comment ID, post ID and user ID
+	comment.CommentID = uuid.New().String()
+	comment.PostID = postID
+	comment.UserID = userID
+	comment.IsDeleted = false
+
+	// Place the comment in its thread
+	comment.Depth = 0
+	comment.Path = comment.CommentID
+	if comment.ParentCommentID != nil && *comment.ParentCommentID == "" {
+		comment.ParentCommentID = nil
+	}
+	var parent models.SocialMediaComments
+	if comment.ParentCommentID != nil {
+		result := s.db.Where("comment_id = ? AND post_id = ?", *comment.ParentCommentID, postID).First(&parent)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return nil, ErrParentCommentNotFound
+			}
+			s.logger.WithError(result.Error).Error("Failed to get parent comment")
+			return nil, errors.New("failed to get parent comment")
+		}
+		if parent.IsDeleted {
+			return nil, ErrParentCommentNotFound
+		}
+		if parent.Depth >= MaxCommentDepth {
+			return nil, ErrCommentTooDeep
+		}
+		comment.Depth = parent.Depth + 1
+		comment.Path = parent.Path + "/" + comment.CommentID
+	}
+
+	// Create comment in database
+	result := s.db.Create(comment)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to create comment")
+		return nil, errors.New("failed to create comment")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"comment_id": comment.CommentID,
+		"post_id":    postID,
+		"user_id":    userID,
+	}).Info("Comment created")
+
+	s.stream.Broadcast(StreamEvent{
+		Type: StreamEventCommentCreated,
+		Data: CommentCreatedEvent{PostID: postID, Comment: comment},
+	})
+
+	// A reply notifies the parent's author; the post author hears about it unless that is the same person
+	if comment.ParentCommentID != nil {
+		s.notifications.Notify(NotificationEvent{
+			RecipientID: parent.UserID,
+			ActorID:     userID,
+			Type:        models.NotificationReply,
+			PostID:      postID,
+			CommentID:   parent.CommentID,
+		})
+	}
+	if comment.ParentCommentID == nil || parent.UserID != post.UserID {
+		s.notifications.Notify(NotificationEvent{
+			RecipientID: post.UserID,
+			ActorID:     userID,
+			Type:        models.NotificationComment,
+			PostID:      postID,
+		})
+	}
+
+	return comment, nil
+}
+
+// UpdateComment edits the text of a comment. The author or a moderator may edit it.
+func (s *CommentService) UpdateComment(postID string, commentID string, updatedComment *models.SocialMediaComments, userID string, role string) (*models.SocialMediaComments, error) {
+	existingComment, err := s.getModifiableComment(postID, commentID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update comment fields
+	existingComment.CommentText = updatedComment.CommentText
+
+	// Save changes to database
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(existingComment).Error; err != nil {
+			return err
+		}
+		return recordModerationAction(tx, userID, models.ModerationTargetComment, commentID, existingComment.UserID, models.ModerationActionUpdate, "")
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to update comment")
+		return nil, errors.New("failed to update comment")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"comment_id": commentID,
+		"post_id":    postID,
+		"user_id":    userID,
+	}).Info("Comment updated")
+
+	return existingComment, nil
+}
+
+// DeleteComment deletes a comment. The author or a moderator may delete it;
+// a moderator removing someone else's comment must give a reason, which is logged.
+// A comment with replies is replaced by a "[deleted]" placeholder so its replies stay
+// in place; the placeholder goes away once the last of those replies is deleted.
+func (s *CommentService) DeleteComment(postID string, commentID string, userID string, role string, reason string) error {
+	comment, err := s.getModifiableComment(postID, commentID, userID, role)
+	if err != nil {
+		return err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if comment.UserID != userID && reason == "" {
+		return ErrModerationReasonRequired
+	}
+
+	// Delete comment
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := recordModerationAction(tx, userID, models.ModerationTargetComment, commentID, comment.UserID, models.ModerationActionDelete, reason); err != nil {
+			return err
+		}
+
+		var replyCount int64
+		if err := tx.Model(&models.SocialMediaComments{}).Where("post_id = ? AND path LIKE ?", postID, comment.Path+"/%").Count(&replyCount).Error; err != nil {
+			return err
+		}
+		if replyCount > 0 {
+			return tx.Model(comment).Updates(map[string]any{
+				"comment_text": models.DeletedCommentText,
+				"is_deleted":   true,
+			}).Error
+		}
+
+		if err := tx.Delete(comment).Error; err != nil {
+			return err
+		}
+		return pruneDeletedAncestors(tx, comment)
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to delete comment")
+		return errors.New("failed to delete comment")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"comment_id": commentID,
+		"post_id":    postID,
+		"user_id":    userID,
+	}).Info("Comment deleted")
+
+	return nil
+}
+
+// pruneDeletedAncestors removes the "[deleted]" placeholders above comment that no longer have any replies
+func pruneDeletedAncestors(tx *gorm.DB, comment *models.SocialMediaComments) error {
+	for comment.ParentCommentID != nil {
+		var parent models.SocialMediaComments
+		if err := tx.Where("comment_id = ?", *comment.ParentCommentID).First(&parent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if !parent.IsDeleted {
+			return nil
+		}
+
+		var replyCount int64
+		if err := tx.Model(&models.SocialMediaComments{}).Where("post_id = ? AND path LIKE ?", parent.PostID, parent.Path+"/%").Count(&replyCount).Error; err != nil {
+			return err
+		}
+		if replyCount > 0 {
+			return nil
+		}
+		if err := tx.Delete(&parent).Error; err != nil {
+			return err
+		}
+		comment = &parent
+	}
+	return nil
+}
+
+// getModifiableComment loads a comment of a post and checks that userID is its author or a moderator
+func (s *CommentService) getModifiableComment(postID string, commentID string, userID string, role string) (*models.SocialMediaComments, error) {
+	var comment models.SocialMediaComments
+
+	result := s.db.Where("comment_id = ? AND post_id = ?", commentID, postID).First(&comment)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get comment")
+		return nil, errors.New("failed to get comment")
+	}
+
+	// Deleted placeholders cannot be edited or deleted again
+	if comment.IsDeleted {
+		return nil, ErrCommentNotFound
+	}
+
+	if !canModify(comment.UserID, userID, role) {
+		s.logger.WithFields(logrus.Fields{
+			"comment_id": commentID,
+			"user_id":    userID,
+		}).Warn("User is not allowed to modify the comment")
+		return nil, ErrCommentForbidden
+	}
+
+	return &comment, nil
+}
+
+// ensurePostExists returns ErrPostNotFound if the post does not exist
+func (s *CommentService) ensurePostExists(postID string) error {
+	var count int64
+
+	if err := s.db.Model(&models.SocialMediaPost{}).Where("post_id = ?", postID).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to check post")
+		return errors.New("failed to get social media post")
+	}
+	if count == 0 {
+		return ErrPostNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-azure/models"
+	"go-azure/testutil"
+)
+
+// newTestCommentService creates a CommentService whose notifications are queued but never recorded
+func newTestCommentService() *CommentService {
+	stream := NewStreamHub()
+	return NewCommentService(NewNotificationService(stream), stream)
+}
+
+// createComment adds a comment to the post, replying to parentID unless it is empty
+func createComment(t *testing.T, s *CommentService, postID string, parentID string, userID string) *models.SocialMediaComments {
+	t.Helper()
+
+	comment := &models.SocialMediaComments{CommentText: "comment"}
+	if parentID != "" {
+		comment.ParentCommentID = &parentID
+	}
+	created, err := s.CreateComment(postID, comment, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Comments are ordered by their creation time
+	time.Sleep(2 * time.Millisecond)
+	return created
+}
+
+func TestCommentThreads(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	post := createPost(t, db, ada.ID, 0)
+	s := newTestCommentService()
+
+	top := createComment(t, s, post.PostID, "", ada.ID)
+	var replies []*models.SocialMediaComments
+	for range commentPreviewReplies + 1 {
+		replies = append(replies, createComment(t, s, post.PostID, top.CommentID, ada.ID))
+	}
+	nested := createComment(t, s, post.PostID, replies[0].CommentID, ada.ID)
+	if nested.Depth != 2 || nested.Path != top.CommentID+"/"+replies[0].CommentID+"/"+nested.CommentID {
+		t.Errorf("nested reply at depth %d with path %s", nested.Depth, nested.Path)
+	}
+
+	result, err := s.GetCommentsByPostID(post.PostID, 1, 20, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	threads := result["comments"].([]*CommentThread)
+	if len(threads) != 1 || result["total_count"].(int64) != 1 {
+		t.Fatalf("got %d top-level comments of %v, want 1", len(threads), result["total_count"])
+	}
+	thread := threads[0]
+	if thread.ReplyCount != int64(len(replies)) || len(thread.Replies) != commentPreviewReplies || !thread.HasMoreReplies {
+		t.Fatalf("thread has %d of %d replies, more %v", len(thread.Replies), thread.ReplyCount, thread.HasMoreReplies)
+	}
+	for i, reply := range thread.Replies {
+		if reply.CommentID != replies[i].CommentID {
+			t.Errorf("reply %d is %s, want %s", i, reply.CommentID, replies[i].CommentID)
+		}
+	}
+	if first := thread.Replies[0]; len(first.Replies) != 1 || first.Replies[0].CommentID != nested.CommentID || first.HasMoreReplies {
+		t.Errorf("first reply previews %d replies, more %v; want the nested one", len(first.Replies), first.HasMoreReplies)
+	}
+
+	// The rest of the replies continue after the preview
+	page, err := s.GetReplies(post.PostID, top.CommentID, thread.RepliesCursor, 20, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Replies) != 1 || page.Replies[0].CommentID != replies[len(replies)-1].CommentID || page.HasMore {
+		t.Errorf("replies after the preview = %d, more %v; want the last reply", len(page.Replies), page.HasMore)
+	}
+}
+
+func TestCreateCommentRejectsInvalidParents(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	post := createPost(t, db, ada.ID, 0)
+	otherPost := createPost(t, db, ada.ID, 0)
+	s := newTestCommentService()
+
+	parent := createComment(t, s, post.PostID, "", ada.ID)
+	for range MaxCommentDepth {
+		parent = createComment(t, s, post.PostID, parent.CommentID, ada.ID)
+	}
+	elsewhere := createComment(t, s, otherPost.PostID, "", ada.ID)
+
+	tests := []struct {
+		name     string
+		parentID string
+		want     error
+	}{
+		{name: "too deep", parentID: parent.CommentID, want: ErrCommentTooDeep},
+		{name: "on another post", parentID: elsewhere.CommentID, want: ErrParentCommentNotFound},
+		{name: "unknown", parentID: "unknown", want: ErrParentCommentNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parentID := test.parentID
+			_, err := s.CreateComment(post.PostID, &models.SocialMediaComments{CommentText: "reply", ParentCommentID: &parentID}, ada.ID)
+			if !errors.Is(err, test.want) {
+				t.Errorf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestDeleteCommentKeepsPlaceholdersWhileRepliesRemain(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	grace := testutil.CreateUser(t, db, "Grace")
+	post := createPost(t, db, ada.ID, 0)
+	s := newTestCommentService()
+
+	top := createComment(t, s, post.PostID, "", ada.ID)
+	middle := createComment(t, s, post.PostID, top.CommentID, grace.ID)
+	reply := createComment(t, s, post.PostID, middle.CommentID, ada.ID)
+
+	for _, comment := range []*models.SocialMediaComments{top, middle} {
+		if err := s.DeleteComment(post.PostID, comment.CommentID, comment.UserID, models.RoleUser, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := s.GetCommentsByPostID(post.PostID, 1, 20, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	threads := result["comments"].([]*CommentThread)
+	if len(threads) != 1 {
+		t.Fatalf("got %d top-level comments, want the placeholder", len(threads))
+	}
+	placeholder := threads[0]
+	if !placeholder.IsDeleted || placeholder.CommentText != models.DeletedCommentText || placeholder.UserID != "" {
+		t.Errorf("placeholder = %+v, want a deleted comment without its author", placeholder.SocialMediaComments)
+	}
+	if len(placeholder.Replies) != 1 || len(placeholder.Replies[0].Replies) != 1 {
+		t.Fatal("replies below the placeholders are gone")
+	}
+
+	// Placeholders take no replies and cannot be deleted again
+	parentID := middle.CommentID
+	if _, err := s.CreateComment(post.PostID, &models.SocialMediaComments{CommentText: "reply", ParentCommentID: &parentID}, ada.ID); !errors.Is(err, ErrParentCommentNotFound) {
+		t.Errorf("replying to a placeholder = %v, want %v", err, ErrParentCommentNotFound)
+	}
+	if err := s.DeleteComment(post.PostID, middle.CommentID, grace.ID, models.RoleUser, ""); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("deleting a placeholder = %v, want %v", err, ErrCommentNotFound)
+	}
+
+	// Deleting the last reply prunes every placeholder above it
+	if err := s.DeleteComment(post.PostID, reply.CommentID, ada.ID, models.RoleUser, ""); err != nil {
+		t.Fatal(err)
+	}
+	var left int64
+	if err := db.Model(&models.SocialMediaComments{}).Where("post_id = ?", post.PostID).Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d comments left, want the placeholders pruned", left)
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCannotFollowSelf is returned when a user tries to follow themselves
+var ErrCannotFollowSelf = errors.New("you cannot follow yourself")
+
+// FollowService handles the follow graph
+type FollowService struct {
+	db            *gorm.DB
+	logger        *logrus.Logger
+	timeline      *TimelineService
+	notifications *NotificationService
+}
+
+// NewFollowService creates a new FollowService
+func NewFollowService(timeline *TimelineService, notifications *NotificationService) *FollowService {
+	return &FollowService{
+		db:            utils.GetDB(),
+		logger:        utils.GetLogger(),
+		timeline:      timeline,
+		notifications: notifications,
+	}
+}
+
+// FollowCounts holds the follower and followee counts of a user
+type FollowCounts struct {
+	UserID         string `json:"user_id"`
+	FollowersCount int64  `json:"followers_count"`
+	FollowingCount int64  `json:"following_count"`
+	IsFollowing    bool   `json:"is_following"`
+}
+
+// Follow makes followerID follow followeeID. Following twice is a no-op.
+func (s *FollowService) Follow(followerID string, followeeID string) (*FollowCounts, error) {
+	if followerID == followeeID {
+		return nil, ErrCannotFollowSelf
+	}
+	if err := s.ensureUserExists(followeeID); err != nil {
+		return nil, err
+	}
+
+	follow := models.Follow{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to follow user")
+		return nil, errors.New("failed to follow user")
+	}
+
+	// Only a new follow is news to the followee
+	if result.RowsAffected > 0 {
+		s.notifications.Notify(NotificationEvent{
+			RecipientID: followeeID,
+			ActorID:     followerID,
+			Type:        models.NotificationFollow,
+		})
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"follower_id": followerID,
+		"followee_id": followeeID,
+	}).Info("User followed")
+
+	return s.followChanged(followerID, followeeID)
+}
+
+// Unfollow makes followerID stop following followeeID. Unfollowing twice is a no-op.
+func (s *FollowService) Unfollow(followerID string, followeeID string) (*FollowCounts, error) {
+	if err := s.ensureUserExists(followeeID); err != nil {
+		return nil, err
+	}
+
+	result := s.db.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&models.Follow{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to unfollow user")
+		return nil, errors.New("failed to unfollow user")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"follower_id": followerID,
+		"followee_id": followeeID,
+	}).Info("User unfollowed")
+
+	return s.followChanged(followerID, followeeID)
+}
+
+// followChanged updates the home timeline of the follower and returns the new follow counts
+func (s *FollowService) followChanged(followerID string, followeeID string) (*FollowCounts, error) {
+	counts, err := s.GetFollowCounts(followeeID, followerID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.timeline.FollowersChanged(followerID, followeeID, counts.FollowersCount)
+
+	return counts, nil
+}
+
+// GetFollowCounts returns how many followers and followees a user has and whether the viewer follows them
+func (s *FollowService) GetFollowCounts(userID string, viewerID string) (*FollowCounts, error) {
+	if err := s.ensureUserExists(userID); err != nil {
+		return nil, err
+	}
+
+	counts := FollowCounts{UserID: userID}
+
+	if err := s.db.Model(&models.Follow{}).Where("followee_id = ?", userID).Count(&counts.FollowersCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count followers")
+		return nil, errors.New("failed to count followers")
+	}
+	if err := s.db.Model(&models.Follow{}).Where("follower_id = ?", userID).Count(&counts.FollowingCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count followees")
+		return nil, errors.New("failed to count followees")
+	}
+
+	if viewerID != "" && viewerID != userID {
+		var following int64
+		if err := s.db.Model(&models.Follow{}).Where("follower_id = ? AND followee_id = ?", viewerID, userID).Count(&following).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to check follow")
+			return nil, errors.New("failed to check follow")
+		}
+		counts.IsFollowing = following > 0
+	}
+
+	return &counts, nil
+}
+
+// GetFollowers returns the users following userID, most recent first
+func (s *FollowService) GetFollowers(userID string, page int, pageSize int) (map[string]any, error) {
+	return s.listUsers(userID, "follows.follower_id = users.id", "follows.followee_id = ?", page, pageSize)
+}
+
+// GetFollowing returns the users userID follows, most recent first
+func (s *FollowService) GetFollowing(userID string, page int, pageSize int) (map[string]any, error) {
+	return s.listUsers(userID, "follows.followee_id = users.id", "follows.follower_id = ?", page, pageSize)
+}
+
+// listUsers pages through the users on one side of the follow graph of userID
+func (s *FollowService) listUsers(userID string, joinOn string, where string, page int, pageSize int) (map[string]any, error) {
+	var users []models.User
+	var totalCount int64
+
+	// Defaults
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	if err := s.ensureUserExists(userID); err != nil {
+		return nil, err
+	}
+
+	offset := (page - 1) * pageSize
+
+	if err := s.db.Model(&models.Follow{}).Where(where, userID).Count(&totalCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count follows")
+		return nil, err
+	}
+
+	if err := s.db.
+		Joins("JOIN follows ON "+joinOn).
+		Where(where, userID).
+		Order("follows.created_at desc").
+		Limit(pageSize).
+		Offset(offset).
+		Find(&users).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get follows")
+		return nil, err
+	}
+
+	totalPages := (totalCount + int64(pageSize) - 1) / int64(pageSize)
+
+	return map[string]any{
+		"users":        users,
+		"total_count":  totalCount,
+		"current_page": page,
+		"total_pages":  totalPages,
+	}, nil
+}
+
+// ensureUserExists returns ErrUserNotFound if the user does not exist
+func (s *FollowService) ensureUserExists(userID string) error {
+	var count int64
+
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to check user")
+		return errors.New("failed to get user")
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"go-azure/config"
+)
+
+// ErrUnknownProvider is returned for an identity provider that is not configured
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// LoginRequest holds the secrets of a login in progress, passed to the provider when the login
+// starts and again when its callback arrives
+type LoginRequest struct {
+	State        string
+	CodeVerifier string // PKCE code verifier
+	Nonce        string // bound into the ID token
+	LoginHint    string // email address the user wants to sign in with, if known
+}
+
+// ExternalIdentity is an account authenticated by an identity provider
+type ExternalIdentity struct {
+	Subject       string // the provider's stable ID for the account
+	Email         string
+	EmailVerified bool // the provider vouches for the email, so it may be linked to an existing user
+	Name          string
+}
+
+// IdentityProvider signs users in with an OAuth 2.0 authorization code flow
+type IdentityProvider interface {
+	// Name identifies the provider in URLs and linked identities
+	Name() string
+	// RedirectURL is the callback URL the provider sends the user back to
+	RedirectURL() string
+	// LoginURL returns the URL that starts a login at the provider
+	LoginURL(ctx context.Context, login LoginRequest) (string, error)
+	// Authenticate exchanges the code from the callback for the identity of the user who logged in
+	Authenticate(ctx context.Context, code string, login LoginRequest) (*ExternalIdentity, error)
+}
+
+// NewIdentityProviders creates the identity providers enabled in cfg, keyed by name
+func NewIdentityProviders(cfg *config.Config) map[string]IdentityProvider {
+	providers := make(map[string]IdentityProvider)
+
+	if cfg.MicrosoftClientID != "" {
+		providers[ProviderMicrosoft] = NewMicrosoftProvider(cfg)
+	}
+	if cfg.OIDCIssuerURL != "" {
+		providers[ProviderOIDC] = NewOIDCProvider(cfg)
+	}
+	if cfg.DevLoginEnabled && !cfg.IsProduction() {
+		providers[ProviderDev] = NewDevProvider(cfg)
+	}
+
+	return providers
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxImagePixels rejects images that would take too much memory to decode
+	maxImagePixels = 40_000_000
+	// variantJPEGQuality is the quality of resized JPEG variants
+	variantJPEGQuality = 82
+	// blurhashWidth is the width images are shrunk to before computing their blurhash
+	blurhashWidth = 32
+	// staleProcessingAfter is when media stuck in processing, for example after a crash, is retried
+	staleProcessingAfter = 10 * time.Minute
+)
+
+// variantWidths are the widths of the resized copies made of each image. Only widths
+// smaller than the original are generated.
+var variantWidths = []int{320, 640, 1280}
+
+var (
+	// ErrMediaNotFound is returned when media does not exist or belongs to someone else
+	ErrMediaNotFound = errors.New("media not found")
+	// ErrMediaTooLarge is returned when an upload exceeds the configured size limit
+	ErrMediaTooLarge = errors.New("file is too large")
+	// ErrUnsupportedMediaType is returned when an upload is not an allowed image type
+	ErrUnsupportedMediaType = errors.New("only JPEG, PNG and GIF images are allowed")
+)
+
+// allowedMediaTypes are the image types accepted for upload, detected from the file contents
+var allowedMediaTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// MediaService handles image uploads
+type MediaService struct {
+	config *config.Config
+	db     *gorm.DB
+	store  utils.BlobStore
+	logger *logrus.Logger
+
+	// IDs of uploaded media waiting for their variants
+	variantJobs chan string
+}
+
+// NewMediaService creates a new MediaService
+func NewMediaService(config *config.Config, store utils.BlobStore) *MediaService {
+	return &MediaService{
+		config: config,
+		db:     utils.GetDB(),
+		store:  store,
+		logger: utils.GetLogger(),
+
+		variantJobs: make(chan string, 100),
+	}
+}
+
+// MaxUploadBytes is the largest file that can be uploaded
+func (s *MediaService) MaxUploadBytes() int64 {
+	return int64(s.config.MediaMaxUploadMB) << 20
+}
+
+// UploadMedia validates an image, strips its metadata and stores it for userID.
+// The type is detected from the contents; the name and type sent by the client are ignored.
+func (s *MediaService) UploadMedia(file io.Reader, userID string) (*models.Media, error) {
+	// Read one byte past the limit to detect oversized files
+	data, err := io.ReadAll(io.LimitReader(file, s.MaxUploadBytes()+1))
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to read upload")
+		return nil, errors.New("failed to read upload")
+	}
+	if int64(len(data)) > s.MaxUploadBytes() {
+		return nil, ErrMediaTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedMediaTypes[contentType] {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	imageConfig, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != contentType {
+		return nil, ErrUnsupportedMediaType
+	}
+	if imageConfig.Width*imageConfig.Height > maxImagePixels {
+		return nil, fmt.Errorf("%w: images may have at most %d pixels", ErrMediaTooLarge, maxImagePixels)
+	}
+
+	data, err = utils.StripImageMetadata(contentType, data)
+	if err != nil {
+		if errors.Is(err, utils.ErrUnsupportedImage) {
+			return nil, ErrUnsupportedMediaType
+		}
+		if errors.Is(err, utils.ErrImageTooLarge) {
+			return nil, fmt.Errorf("%w: %v", ErrMediaTooLarge, err)
+		}
+		s.logger.WithError(err).Error("Failed to strip image metadata")
+		return nil, errors.New("failed to process image")
+	}
+
+	// Dimensions after a JPEG was rotated upright
+	if imageConfig, _, err = image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	checksum := sha256.Sum256(data)
+	mediaID := uuid.New().String()
+	media := &models.Media{
+		MediaID:     mediaID,
+		UserID:      userID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       imageConfig.Width,
+		Height:      imageConfig.Height,
+		Checksum:    hex.EncodeToString(checksum[:]),
+		StorageKey:  mediaID + "/original",
+	}
+
+	ctx := context.Background()
+	if err := s.store.Put(ctx, media.StorageKey, bytes.NewReader(data), media.Size, contentType); err != nil {
+		s.logger.WithError(err).Error("Failed to store media")
+		return nil, errors.New("failed to store media")
+	}
+
+	if err := s.db.Create(media).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to save media")
+		if err := s.store.Delete(ctx, media.StorageKey); err != nil {
+			s.logger.WithError(err).Error("Failed to remove orphaned media")
+		}
+		return nil, errors.New("failed to save media")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"media_id":     mediaID,
+		"user_id":      userID,
+		"content_type": contentType,
+		"size":         media.Size,
+	}).Info("Media uploaded")
+
+	// Generate variants in the background; if the queue is full the periodic sweep picks it up
+	select {
+	case s.variantJobs <- mediaID:
+	default:
+	}
+
+	media.Status = models.MediaStatusPending
+	media.URL = models.MediaURL(mediaID)
+	return media, nil
+}
+
+// MediaFile describes a stored image file: an original upload or one of its variants
+type MediaFile struct {
+	ContentType string
+	Checksum    string
+	CreatedAt   time.Time
+}
+
+// OpenMedia returns an image and a seekable reader over it. A width of 0 opens the original,
+// otherwise the variant of that width. The caller closes the reader.
+func (s *MediaService) OpenMedia(mediaID string, width int) (*MediaFile, io.ReadSeekCloser, error) {
+	var file MediaFile
+	var storageKey string
+
+	if width == 0 {
+		var media models.Media
+		result := s.db.Where("media_id = ?", mediaID).First(&media)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return nil, nil, ErrMediaNotFound
+			}
+			s.logger.WithError(result.Error).Error("Failed to get media")
+			return nil, nil, errors.New("failed to get media")
+		}
+		file = MediaFile{ContentType: media.ContentType, Checksum: media.Checksum, CreatedAt: media.CreatedAt}
+		storageKey = media.StorageKey
+	} else {
+		var variant models.MediaVariant
+		result := s.db.Where("media_id = ? AND width = ?", mediaID, width).First(&variant)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return nil, nil, ErrMediaNotFound
+			}
+			s.logger.WithError(result.Error).Error("Failed to get media variant")
+			return nil, nil, errors.New("failed to get media")
+		}
+		file = MediaFile{ContentType: variant.ContentType, Checksum: variant.Checksum, CreatedAt: variant.CreatedAt}
+		storageKey = variant.StorageKey
+	}
+
+	reader, err := s.store.Open(context.Background(), storageKey)
+	if err != nil {
+		if errors.Is(err, utils.ErrBlobNotFound) {
+			return nil, nil, ErrMediaNotFound
+		}
+		s.logger.WithError(err).Error("Failed to open media")
+		return nil, nil, errors.New("failed to open media")
+	}
+
+	return &file, reader, nil
+}
+
+// StartVariantWorker generates resized variants and blurhashes of uploaded images until ctx
+// is cancelled. Media left pending, for example because the queue was full or the server
+// restarted, is picked up by a sweep every minute.
+func (s *MediaService) StartVariantWorker(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	s.sweepPendingMedia()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case mediaID := <-s.variantJobs:
+			s.processMedia(mediaID)
+		case <-ticker.C:
+			s.sweepPendingMedia()
+		}
+	}
+}
+
+// sweepPendingMedia processes media still waiting for variants
+func (s *MediaService) sweepPendingMedia() {
+	var mediaIDs []string
+	if err := s.db.Model(&models.Media{}).
+		Where("status = ? OR (status = ? AND updated_at < ?)", models.MediaStatusPending, models.MediaStatusProcessing, time.Now().Add(-staleProcessingAfter)).
+		Order("created_at").
+		Limit(100).
+		Pluck("media_id", &mediaIDs).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to find pending media")
+		return
+	}
+
+	for _, mediaID := range mediaIDs {
+		s.processMedia(mediaID)
+	}
+}
+
+// processMedia generates the variants and blurhash of one image
+func (s *MediaService) processMedia(mediaID string) {
+	// Claim the media so several workers never process it at once
+	claim := s.db.Model(&models.Media{}).
+		Where("media_id = ? AND (status = ? OR (status = ? AND updated_at < ?))", mediaID, models.MediaStatusPending, models.MediaStatusProcessing, time.Now().Add(-staleProcessingAfter)).
+		Updates(map[string]any{"status": models.MediaStatusProcessing, "updated_at": time.Now()})
+	if claim.Error != nil {
+		s.logger.WithError(claim.Error).Error("Failed to claim media")
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return
+	}
+
+	status := models.MediaStatusReady
+	blurhash, err := s.generateVariants(mediaID)
+	if err != nil {
+		s.logger.WithError(err).WithField("media_id", mediaID).Error("Failed to generate media variants")
+		status = models.MediaStatusFailed
+	}
+
+	if err := s.db.Model(&models.Media{}).Where("media_id = ?", mediaID).
+		Updates(map[string]any{"status": status, "blurhash": blurhash}).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to update media status")
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"media_id": mediaID,
+		"status":   status,
+	}).Info("Media processed")
+}
+
+// generateVariants stores a resized copy of the image for every variant width smaller than
+// the original and returns the blurhash of the image
+func (s *MediaService) generateVariants(mediaID string) (string, error) {
+	var media models.Media
+	if err := s.db.Where("media_id = ?", mediaID).First(&media).Error; err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	reader, err := s.store.Open(ctx, media.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return "", err
+	}
+
+	// For animated GIFs this is the first frame
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	bounds := img.Bounds()
+
+	// JPEGs stay JPEG; PNGs and GIFs become PNG to keep transparency
+	contentType := "image/png"
+	if media.ContentType == "image/jpeg" {
+		contentType = "image/jpeg"
+	}
+
+	for _, width := range variantWidths {
+		if width >= bounds.Dx() {
+			break
+		}
+		height := utils.FitWidth(bounds.Dx(), bounds.Dy(), width)
+		resized := utils.ResizeImage(img, width, height)
+
+		var encoded bytes.Buffer
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&encoded, resized, &jpeg.Options{Quality: variantJPEGQuality})
+		} else {
+			err = png.Encode(&encoded, resized)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		checksum := sha256.Sum256(encoded.Bytes())
+		variant := models.MediaVariant{
+			MediaID:     mediaID,
+			Width:       width,
+			Height:      height,
+			ContentType: contentType,
+			Size:        int64(encoded.Len()),
+			Checksum:    hex.EncodeToString(checksum[:]),
+			StorageKey:  fmt.Sprintf("%s/w%d", mediaID, width),
+		}
+
+		if err := s.store.Put(ctx, variant.StorageKey, bytes.NewReader(encoded.Bytes()), variant.Size, contentType); err != nil {
+			return "", err
+		}
+		// A retried job overwrites the variants of the failed attempt
+		if err := s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&variant).Error; err != nil {
+			return "", err
+		}
+	}
+
+	small := utils.ResizeImage(img, blurhashWidth, utils.FitWidth(bounds.Dx(), bounds.Dy(), blurhashWidth))
+	return utils.EncodeBlurhash(small, 4, 3), nil
+}
+
+// attachImageSets fills the Image of posts that have uploaded media. Variants that are not
+// generated yet are simply missing, so the srcset only lists the original until they are.
+func attachImageSets(db *gorm.DB, posts []*models.SocialMediaPost) error {
+	mediaIDs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		if post.MediaID != "" {
+			mediaIDs = append(mediaIDs, post.MediaID)
+		}
+	}
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+
+	var media []models.Media
+	if err := db.Where("media_id IN ?", mediaIDs).Find(&media).Error; err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to get media")
+		return errors.New("failed to get media")
+	}
+
+	var variants []models.MediaVariant
+	if err := db.Where("media_id IN ?", mediaIDs).Order("width").Find(&variants).Error; err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to get media variants")
+		return errors.New("failed to get media")
+	}
+
+	imageSets := make(map[string]*models.ImageSet, len(media))
+	for _, item := range media {
+		imageSets[item.MediaID] = &models.ImageSet{
+			URL:      models.MediaURL(item.MediaID),
+			Width:    item.Width,
+			Height:   item.Height,
+			Blurhash: item.Blurhash,
+		}
+	}
+	for _, variant := range variants {
+		if imageSet, ok := imageSets[variant.MediaID]; ok {
+			imageSet.Variants = append(imageSet.Variants, models.ImageVariant{
+				URL:    models.MediaVariantURL(variant.MediaID, variant.Width),
+				Width:  variant.Width,
+				Height: variant.Height,
+			})
+		}
+	}
+
+	for _, imageSet := range imageSets {
+		imageSet.Variants = append(imageSet.Variants, models.ImageVariant{URL: imageSet.URL, Width: imageSet.Width, Height: imageSet.Height})
+
+		candidates := make([]string, 0, len(imageSet.Variants))
+		for _, variant := range imageSet.Variants {
+			candidates = append(candidates, fmt.Sprintf("%s %dw", variant.URL, variant.Width))
+		}
+		imageSet.Srcset = strings.Join(candidates, ", ")
+	}
+
+	for _, post := range posts {
+		post.Image = imageSets[post.MediaID]
+	}
+
+	return nil
+}
+
+// attachMedia points the post image at its uploaded media, which must belong to ownerID
+func attachMedia(db *gorm.DB, post *models.SocialMediaPost, ownerID string) error {
+	post.PostImage = ""
+	if post.MediaID == "" {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.Media{}).Where("media_id = ? AND user_id = ?", post.MediaID, ownerID).Count(&count).Error; err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to check media")
+		return errors.New("failed to get media")
+	}
+	if count == 0 {
+		return ErrMediaNotFound
+	}
+
+	post.PostImage = models.MediaURL(post.MediaID)
+	return nil
+}
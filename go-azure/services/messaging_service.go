@@ -0,0 +1,520 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrConversationNotFound is returned when a conversation does not exist or the user is not one of its participants
+	ErrConversationNotFound = errors.New("conversation not found")
+	// ErrInvalidParticipants is returned when a conversation would have no one else or too many participants
+	ErrInvalidParticipants = errors.New("a conversation needs 1 to 19 other participants")
+	// ErrUnknownParticipant is returned when a participant is not a user
+	ErrUnknownParticipant = errors.New("participant not found")
+	// ErrInvalidMessage is returned for blank or overlong messages
+	ErrInvalidMessage = errors.New("message must be between 1 and 5000 characters")
+	// ErrMessageNotFound is returned when a message does not belong to the conversation
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+const (
+	// MaxConversationParticipants caps group conversations, including their creator
+	MaxConversationParticipants = 20
+	// MaxMessageLength is the longest message body in characters
+	MaxMessageLength = 5000
+)
+
+// ConversationPage is a page of a user's conversations, most recently active first
+type ConversationPage struct {
+	Conversations []models.Conversation `json:"conversations"`
+	NextCursor    string                `json:"next_cursor,omitempty"`
+	HasMore       bool                  `json:"has_more"`
+}
+
+// MessagePage is a page of a conversation's messages, newest first
+type MessagePage struct {
+	Messages   []models.Message `json:"messages"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	HasMore    bool             `json:"has_more"`
+}
+
+// ConversationReadEvent tells participants how far a user has read a conversation
+type ConversationReadEvent struct {
+	ConversationID    string    `json:"conversation_id"`
+	UserID            string    `json:"user_id"`
+	LastReadMessageID string    `json:"last_read_message_id"`
+	LastReadAt        time.Time `json:"last_read_at"`
+}
+
+// MessagingService handles private conversations between users
+type MessagingService struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+	stream *StreamHub
+}
+
+// NewMessagingService creates a new MessagingService
+func NewMessagingService(stream *StreamHub) *MessagingService {
+	return &MessagingService{
+		db:     utils.GetDB(),
+		logger: utils.GetLogger(),
+		stream: stream,
+	}
+}
+
+// StartConversation starts a conversation between the user and the participants. With one other
+// participant it is a 1:1 conversation, and the existing one is returned if there is one; created
+// reports whether a new conversation was made.
+func (s *MessagingService) StartConversation(userID string, participantIDs []string, title string) (conversation *models.Conversation, created bool, err error) {
+	others := make([]string, 0, len(participantIDs))
+	for _, participantID := range participantIDs {
+		participantID = strings.TrimSpace(participantID)
+		if participantID != "" && participantID != userID && !slices.Contains(others, participantID) {
+			others = append(others, participantID)
+		}
+	}
+	if len(others) == 0 || len(others) >= MaxConversationParticipants {
+		return nil, false, ErrInvalidParticipants
+	}
+
+	var known int64
+	if err := s.db.Model(&models.User{}).Where("id IN ?", others).Count(&known).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to check participants")
+		return nil, false, errors.New("failed to start conversation")
+	}
+	if known != int64(len(others)) {
+		return nil, false, ErrUnknownParticipant
+	}
+
+	members := append([]string{userID}, others...)
+	now := time.Now().Truncate(time.Millisecond)
+	conversation = &models.Conversation{
+		ConversationID: uuid.New().String(),
+		IsGroup:        len(others) > 1,
+		CreatedBy:      userID,
+		LastMessageAt:  now,
+	}
+	if conversation.IsGroup {
+		conversation.Title = strings.TrimSpace(title)
+	} else {
+		directKey := directConversationKey(userID, others[0])
+		conversation.DirectKey = &directKey
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// The unique direct key makes a concurrent start of the same 1:1 conversation a no-op
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(conversation)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		created = true
+
+		participants := make([]models.ConversationParticipant, 0, len(members))
+		for _, memberID := range members {
+			participants = append(participants, models.ConversationParticipant{
+				ConversationID: conversation.ConversationID,
+				UserID:         memberID,
+			})
+		}
+		return tx.Create(&participants).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to start conversation")
+		return nil, false, errors.New("failed to start conversation")
+	}
+
+	if !created {
+		conversation = &models.Conversation{}
+		if err := s.db.Where("direct_key = ?", directConversationKey(userID, others[0])).First(conversation).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to get conversation")
+			return nil, false, errors.New("failed to start conversation")
+		}
+	} else {
+		s.logger.WithFields(logrus.Fields{
+			"conversation_id": conversation.ConversationID,
+			"user_id":         userID,
+			"participants":    len(members),
+		}).Info("Conversation started")
+	}
+
+	if err := s.attachConversationDetails([]*models.Conversation{conversation}, userID); err != nil {
+		return nil, false, err
+	}
+
+	return conversation, created, nil
+}
+
+// GetConversations returns the user's conversations, most recently active first, using keyset
+// pagination on (last_message_at, conversation_id)
+func (s *MessagingService) GetConversations(userID string, cursor string, limit int) (*ConversationPage, error) {
+	var conversations []models.Conversation
+
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	query := s.db.Model(&models.Conversation{}).
+		Select("conversations.*").
+		Joins("JOIN conversation_participants ON conversation_participants.conversation_id = conversations.conversation_id").
+		Where("conversation_participants.user_id = ?", userID)
+
+	if cursor != "" {
+		position, err := utils.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("conversations.last_message_at < ? OR (conversations.last_message_at = ? AND conversations.conversation_id < ?)",
+			position.CreatedAt, position.CreatedAt, position.ID)
+	}
+
+	hasMore, err := utils.FindPage(query.Order("conversations.last_message_at desc, conversations.conversation_id desc"), limit, &conversations)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get conversations")
+		return nil, err
+	}
+
+	page := &ConversationPage{HasMore: hasMore}
+	if page.HasMore {
+		last := conversations[len(conversations)-1]
+		page.NextCursor = utils.EncodeCursor(last.LastMessageAt, last.ConversationID)
+	}
+
+	pointers := make([]*models.Conversation, len(conversations))
+	for i := range conversations {
+		pointers[i] = &conversations[i]
+	}
+	if err := s.attachConversationDetails(pointers, userID); err != nil {
+		return nil, err
+	}
+	page.Conversations = conversations
+
+	return page, nil
+}
+
+// GetConversation returns a conversation the user participates in
+func (s *MessagingService) GetConversation(conversationID string, userID string) (*models.Conversation, error) {
+	conversation, err := s.getConversation(conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachConversationDetails([]*models.Conversation{conversation}, userID); err != nil {
+		return nil, err
+	}
+
+	return conversation, nil
+}
+
+// GetMessages returns the messages of a conversation the user participates in, newest first,
+// using keyset pagination on (created_at, message_id)
+func (s *MessagingService) GetMessages(conversationID string, userID string, cursor string, limit int) (*MessagePage, error) {
+	var messages []models.Message
+
+	if _, err := s.getConversation(conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	query := s.db.Where("conversation_id = ?", conversationID)
+	if cursor != "" {
+		position, err := utils.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ? OR (created_at = ? AND message_id < ?)", position.CreatedAt, position.CreatedAt, position.ID)
+	}
+
+	hasMore, err := utils.FindPage(query.Order("created_at desc, message_id desc"), limit, &messages)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get messages")
+		return nil, err
+	}
+
+	page := &MessagePage{HasMore: hasMore}
+	if page.HasMore {
+		last := messages[len(messages)-1]
+		page.NextCursor = utils.EncodeCursor(last.CreatedAt, last.MessageID)
+	}
+
+	participants, err := s.getParticipants([]string{conversationID})
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].ReadBy = readBy(&messages[i], participants[conversationID])
+	}
+	page.Messages = messages
+
+	return page, nil
+}
+
+// SendMessage adds a message to a conversation the user participates in
+func (s *MessagingService) SendMessage(conversationID string, userID string, message *models.Message) (*models.Message, error) {
+	message.Body = strings.TrimSpace(message.Body)
+	if message.Body == "" || utf8.RuneCountInString(message.Body) > MaxMessageLength {
+		return nil, ErrInvalidMessage
+	}
+
+	if _, err := s.getConversation(conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	message.MessageID = uuid.New().String()
+	message.ConversationID = conversationID
+	message.SenderID = userID
+	// Millisecond precision, as stored, so the message's cursor and read receipts match it
+	message.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Conversation{}).
+			Where("conversation_id = ?", conversationID).
+			Updates(map[string]any{"last_message_id": message.MessageID, "last_message_at": message.CreatedAt}).Error; err != nil {
+			return err
+		}
+		// Senders have read their own messages
+		return tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Updates(map[string]any{"last_read_message_id": message.MessageID, "last_read_at": message.CreatedAt}).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to send message")
+		return nil, errors.New("failed to send message")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"conversation_id": conversationID,
+		"message_id":      message.MessageID,
+		"user_id":         userID,
+	}).Info("Message sent")
+
+	s.publish(conversationID, StreamEvent{Type: StreamEventMessageCreated, Data: message})
+
+	return message, nil
+}
+
+// MarkRead records that the user has read the conversation up to the message, or up to its latest
+// message when messageID is empty. Read receipts never move backwards.
+func (s *MessagingService) MarkRead(conversationID string, userID string, messageID string) (*ConversationReadEvent, error) {
+	conversation, err := s.getConversation(conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageID == "" {
+		messageID = conversation.LastMessageID
+	}
+	if messageID == "" {
+		// Nothing has been sent yet
+		return &ConversationReadEvent{ConversationID: conversationID, UserID: userID}, nil
+	}
+
+	var message models.Message
+	if err := s.db.Where("message_id = ? AND conversation_id = ?", messageID, conversationID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		s.logger.WithError(err).Error("Failed to get message")
+		return nil, errors.New("failed to mark conversation as read")
+	}
+
+	result := s.db.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Where("last_read_at IS NULL OR last_read_at < ?", message.CreatedAt).
+		Updates(map[string]any{"last_read_message_id": message.MessageID, "last_read_at": message.CreatedAt})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to mark conversation as read")
+		return nil, errors.New("failed to mark conversation as read")
+	}
+
+	// Report the receipt as stored, which may be further than the message
+	var participant models.ConversationParticipant
+	if err := s.db.Where("conversation_id = ? AND user_id = ?", conversationID, userID).First(&participant).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get participant")
+		return nil, errors.New("failed to mark conversation as read")
+	}
+	receipt := &ConversationReadEvent{
+		ConversationID:    conversationID,
+		UserID:            userID,
+		LastReadMessageID: participant.LastReadMessageID,
+	}
+	if participant.LastReadAt != nil {
+		receipt.LastReadAt = *participant.LastReadAt
+	}
+
+	if result.RowsAffected > 0 {
+		s.publish(conversationID, StreamEvent{Type: StreamEventConversationRead, Data: receipt})
+	}
+
+	return receipt, nil
+}
+
+// getConversation loads a conversation, returning ErrConversationNotFound unless the user participates in it
+func (s *MessagingService) getConversation(conversationID string, userID string) (*models.Conversation, error) {
+	var conversation models.Conversation
+
+	result := s.db.Model(&models.Conversation{}).
+		Select("conversations.*").
+		Joins("JOIN conversation_participants ON conversation_participants.conversation_id = conversations.conversation_id").
+		Where("conversations.conversation_id = ? AND conversation_participants.user_id = ?", conversationID, userID).
+		First(&conversation)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get conversation")
+		return nil, errors.New("failed to get conversation")
+	}
+
+	return &conversation, nil
+}
+
+// getParticipants returns the participants of the conversations with their names and read receipts
+func (s *MessagingService) getParticipants(conversationIDs []string) (map[string][]models.ParticipantSummary, error) {
+	var rows []struct {
+		ConversationID string
+		models.ParticipantSummary
+	}
+	if err := s.db.Model(&models.ConversationParticipant{}).
+		Select("conversation_participants.conversation_id, conversation_participants.user_id, users.name, users.username, "+
+			"conversation_participants.last_read_message_id, conversation_participants.last_read_at").
+		Joins("JOIN users ON users.id = conversation_participants.user_id").
+		Where("conversation_participants.conversation_id IN ?", conversationIDs).
+		Order("conversation_participants.joined_at, conversation_participants.user_id").
+		Scan(&rows).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get participants")
+		return nil, errors.New("failed to get participants")
+	}
+
+	participants := make(map[string][]models.ParticipantSummary, len(conversationIDs))
+	for _, row := range rows {
+		participants[row.ConversationID] = append(participants[row.ConversationID], row.ParticipantSummary)
+	}
+	return participants, nil
+}
+
+// attachConversationDetails fills the participants, last message and unread count of the conversations for userID
+func (s *MessagingService) attachConversationDetails(conversations []*models.Conversation, userID string) error {
+	if len(conversations) == 0 {
+		return nil
+	}
+
+	conversationIDs := make([]string, 0, len(conversations))
+	messageIDs := make([]string, 0, len(conversations))
+	for _, conversation := range conversations {
+		conversationIDs = append(conversationIDs, conversation.ConversationID)
+		if conversation.LastMessageID != "" {
+			messageIDs = append(messageIDs, conversation.LastMessageID)
+		}
+	}
+
+	participants, err := s.getParticipants(conversationIDs)
+	if err != nil {
+		return err
+	}
+
+	var lastMessages []models.Message
+	if len(messageIDs) > 0 {
+		if err := s.db.Where("message_id IN ?", messageIDs).Find(&lastMessages).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to get last messages")
+			return errors.New("failed to get conversations")
+		}
+	}
+	lastMessageByID := make(map[string]*models.Message, len(lastMessages))
+	for i := range lastMessages {
+		lastMessageByID[lastMessages[i].MessageID] = &lastMessages[i]
+	}
+
+	// Messages from others after the user's read receipt
+	var unread []struct {
+		ConversationID string
+		Total          int64
+	}
+	if err := s.db.Model(&models.Message{}).
+		Select("messages.conversation_id, COUNT(*) AS total").
+		Joins("JOIN conversation_participants ON conversation_participants.conversation_id = messages.conversation_id AND conversation_participants.user_id = ?", userID).
+		Where("messages.conversation_id IN ? AND messages.sender_id <> ?", conversationIDs, userID).
+		Where("conversation_participants.last_read_at IS NULL OR messages.created_at > conversation_participants.last_read_at").
+		Group("messages.conversation_id").
+		Scan(&unread).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count unread messages")
+		return errors.New("failed to get conversations")
+	}
+	unreadCounts := make(map[string]int64, len(unread))
+	for _, row := range unread {
+		unreadCounts[row.ConversationID] = row.Total
+	}
+
+	for _, conversation := range conversations {
+		conversation.Participants = participants[conversation.ConversationID]
+		conversation.UnreadCount = unreadCounts[conversation.ConversationID]
+		if lastMessage, ok := lastMessageByID[conversation.LastMessageID]; ok {
+			lastMessage.ReadBy = readBy(lastMessage, conversation.Participants)
+			conversation.LastMessage = lastMessage
+		}
+	}
+
+	return nil
+}
+
+// publish sends the event to the open streams of every participant of the conversation
+func (s *MessagingService) publish(conversationID string, event StreamEvent) {
+	var userIDs []string
+	if err := s.db.Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ?", conversationID).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		s.logger.WithError(err).Warn("Failed to get participants for the stream")
+		return
+	}
+	for _, userID := range userIDs {
+		s.stream.Publish(userID, event)
+	}
+}
+
+// readBy returns the participants other than the sender whose read receipt covers the message
+func readBy(message *models.Message, participants []models.ParticipantSummary) []string {
+	var readers []string
+	for _, participant := range participants {
+		if participant.UserID == message.SenderID || participant.LastReadAt == nil {
+			continue
+		}
+		if !participant.LastReadAt.Before(message.CreatedAt) {
+			readers = append(readers, participant.UserID)
+		}
+	}
+	return readers
+}
+
+// directConversationKey identifies the 1:1 conversation of two users regardless of who started it
+func directConversationKey(userA string, userB string) string {
+	if userB < userA {
+		userA, userB = userB, userA
+	}
+	return userA + ":" + userB
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go-azure/models"
+	"go-azure/testutil"
+)
+
+func TestConversationIsPrivateToParticipants(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	grace := testutil.CreateUser(t, db, "Grace")
+	bob := testutil.CreateUser(t, db, "Bob")
+	s := NewMessagingService(NewStreamHub())
+
+	conversation, _, err := s.StartConversation(ada.ID, []string{grace.ID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := s.SendMessage(conversation.ConversationID, ada.ID, &models.Message{Body: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "get conversation", call: func() error {
+			_, err := s.GetConversation(conversation.ConversationID, bob.ID)
+			return err
+		}},
+		{name: "get messages", call: func() error {
+			_, err := s.GetMessages(conversation.ConversationID, bob.ID, "", 20)
+			return err
+		}},
+		{name: "send message", call: func() error {
+			_, err := s.SendMessage(conversation.ConversationID, bob.ID, &models.Message{Body: "hello?"})
+			return err
+		}},
+		{name: "mark read", call: func() error {
+			_, err := s.MarkRead(conversation.ConversationID, bob.ID, message.MessageID)
+			return err
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(); !errors.Is(err, ErrConversationNotFound) {
+				t.Errorf("err = %v, want %v", err, ErrConversationNotFound)
+			}
+		})
+	}
+
+	page, err := s.GetConversations(bob.ID, "", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Conversations) != 0 {
+		t.Errorf("non-participant lists %d conversations, want 0", len(page.Conversations))
+	}
+}
+
+func TestStartConversationReusesDirectConversation(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	grace := testutil.CreateUser(t, db, "Grace")
+	s := NewMessagingService(NewStreamHub())
+
+	first, created, err := s.StartConversation(ada.ID, []string{grace.ID}, "")
+	if err != nil || !created {
+		t.Fatalf("StartConversation = %v, created %v", err, created)
+	}
+	second, created, err := s.StartConversation(grace.ID, []string{ada.ID, grace.ID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || second.ConversationID != first.ConversationID {
+		t.Errorf("second start created %v conversation %s, want the existing %s", created, second.ConversationID, first.ConversationID)
+	}
+}
+
+func TestMarkReadNeverMovesBackwards(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	grace := testutil.CreateUser(t, db, "Grace")
+	s := NewMessagingService(NewStreamHub())
+
+	conversation, _, err := s.StartConversation(ada.ID, []string{grace.ID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []*models.Message
+	for _, body := range []string{"one", "two"} {
+		message, err := s.SendMessage(conversation.ConversationID, ada.ID, &models.Message{Body: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, message)
+		// Messages are ordered by their millisecond timestamps
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	unread := func() int64 {
+		t.Helper()
+		got, err := s.GetConversation(conversation.ConversationID, grace.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.UnreadCount
+	}
+	if got := unread(); got != 2 {
+		t.Fatalf("unread = %d, want 2", got)
+	}
+
+	receipt, err := s.MarkRead(conversation.ConversationID, grace.ID, messages[1].MessageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.LastReadMessageID != messages[1].MessageID {
+		t.Errorf("receipt at %s, want %s", receipt.LastReadMessageID, messages[1].MessageID)
+	}
+	receipt, err = s.MarkRead(conversation.ConversationID, grace.ID, messages[0].MessageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.LastReadMessageID != messages[1].MessageID {
+		t.Errorf("receipt moved back to %s", receipt.LastReadMessageID)
+	}
+	if got := unread(); got != 0 {
+		t.Errorf("unread = %d, want 0", got)
+	}
+
+	page, err := s.GetMessages(conversation.ConversationID, ada.ID, "", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range page.Messages {
+		if !slices.Equal(message.ReadBy, []string{grace.ID}) {
+			t.Errorf("message %q read by %v, want Grace", message.Body, message.ReadBy)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-azure/config"
+	"go-azure/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// ProviderMicrosoft is the name of the Microsoft identity provider
+const ProviderMicrosoft = "microsoft"
+
+// MicrosoftProvider signs users in with their Microsoft work, school or personal account and
+// reads their profile from Microsoft Graph. MICROSOFT_TENANT_ID is common, organizations,
+// consumers or the ID of a single tenant whose users may sign in.
+type MicrosoftProvider struct {
+	config *config.Config
+	client *http.Client
+
+	mu            sync.Mutex
+	jwks          *utils.JWKS
+	jwksFetchedAt time.Time
+}
+
+// microsoftClaims are the ID token claims the provider checks
+type microsoftClaims struct {
+	Nonce    string `json:"nonce"`
+	TenantID string `json:"tid"`
+	jwt.RegisteredClaims
+}
+
+// NewMicrosoftProvider creates a new MicrosoftProvider
+func NewMicrosoftProvider(config *config.Config) *MicrosoftProvider {
+	return &MicrosoftProvider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name implements IdentityProvider
+func (p *MicrosoftProvider) Name() string {
+	return ProviderMicrosoft
+}
+
+// RedirectURL implements IdentityProvider
+func (p *MicrosoftProvider) RedirectURL() string {
+	return p.config.MicrosoftRedirectURI
+}
+
+// oauthConfig returns the OAuth2 config for Microsoft
+func (p *MicrosoftProvider) oauthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.MicrosoftClientID,
+		ClientSecret: p.config.MicrosoftClientSecret,
+		RedirectURL:  p.config.MicrosoftRedirectURI,
+		Scopes:       []string{"openid", "profile", "email", "offline_access", "User.Read"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  fmt.Sprintf("%s/%s/oauth2/v2.0/authorize", p.config.MicrosoftAuthorityURL, p.config.MicrosoftTenantID),
+			TokenURL: fmt.Sprintf("%s/%s/oauth2/v2.0/token", p.config.MicrosoftAuthorityURL, p.config.MicrosoftTenantID),
+		},
+	}
+}
+
+// LoginURL implements IdentityProvider
+func (p *MicrosoftProvider) LoginURL(ctx context.Context, login LoginRequest) (string, error) {
+	options := []oauth2.AuthCodeOption{
+		oauth2.S256ChallengeOption(login.CodeVerifier),
+		oauth2.SetAuthURLParam("nonce", login.Nonce),
+	}
+	if login.LoginHint != "" {
+		options = append(options, oauth2.SetAuthURLParam("login_hint", login.LoginHint))
+	}
+	return p.oauthConfig().AuthCodeURL(login.State, options...), nil
+}
+
+// Authenticate implements IdentityProvider
+func (p *MicrosoftProvider) Authenticate(ctx context.Context, code string, login LoginRequest) (*ExternalIdentity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauthConfig().Exchange(ctx, code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
+	}
+
+	if err := p.validateIDToken(ctx, token, login.Nonce); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	userInfo, err := p.getUserInfo(ctx, token.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+
+	// The user principal name is the sign-in address Microsoft verified
+	identity := &ExternalIdentity{EmailVerified: true}
+	identity.Subject, _ = userInfo["id"].(string)
+	identity.Email, _ = userInfo["userPrincipalName"].(string)
+	identity.Name, _ = userInfo["displayName"].(string)
+	if identity.Subject == "" || identity.Email == "" {
+		return nil, errors.New("user info is missing id or userPrincipalName")
+	}
+	return identity, nil
+}
+
+// validateIDToken checks the ID token returned with the access token: its signature against the
+// tenant's published keys, that a tenant this app accepts issued it to this client, its expiry,
+// and that it is for the login with the nonce
+func (p *MicrosoftProvider) validateIDToken(ctx context.Context, token *oauth2.Token, nonce string) error {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return errors.New("id_token missing from token response")
+	}
+
+	var claims microsoftClaims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		key, err := p.signingKey(ctx, keyID)
+		if err != nil {
+			return nil, err
+		}
+		return key.PublicKey()
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(p.config.MicrosoftClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(maxIDTokenClockSkew),
+	)
+	if err != nil {
+		return err
+	}
+
+	// The multi-tenant endpoints sign for every tenant, so the issuer must name the token's tenant
+	// and, for a single tenant app, be that tenant
+	switch p.config.MicrosoftTenantID {
+	case "common", "organizations", "consumers":
+	default:
+		if !strings.EqualFold(claims.TenantID, p.config.MicrosoftTenantID) {
+			return errors.New("id_token tenant mismatch")
+		}
+	}
+	if claims.TenantID == "" || claims.Issuer != fmt.Sprintf("%s/%s/v2.0", p.config.MicrosoftAuthorityURL, claims.TenantID) {
+		return errors.New("id_token issuer mismatch")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return errors.New("id_token nonce mismatch")
+	}
+	return nil
+}
+
+// signingKey returns the tenant's key with the key ID, fetching the keys again when it is unknown
+// so keys Microsoft rotated in are picked up
+func (p *MicrosoftProvider) signingKey(ctx context.Context, keyID string) (utils.JWK, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.jwks != nil {
+		if key, ok := p.jwks.Key(keyID); ok {
+			return key, nil
+		}
+		if time.Since(p.jwksFetchedAt) < jwksRefreshInterval {
+			return utils.JWK{}, fmt.Errorf("unknown signing key %q", keyID)
+		}
+	}
+
+	url := fmt.Sprintf("%s/%s/discovery/v2.0/keys", p.config.MicrosoftAuthorityURL, p.config.MicrosoftTenantID)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return utils.JWK{}, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return utils.JWK{}, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return utils.JWK{}, errors.New("failed to fetch signing keys: " + resp.Status)
+	}
+
+	var jwks utils.JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return utils.JWK{}, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	p.jwks = &jwks
+	p.jwksFetchedAt = time.Now()
+
+	if key, ok := p.jwks.Key(keyID); ok {
+		return key, nil
+	}
+	return utils.JWK{}, fmt.Errorf("unknown signing key %q", keyID)
+}
+
+// getUserInfo gets user information from Microsoft Graph API
+func (p *MicrosoftProvider) getUserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	// Create request
+	req, err := http.NewRequestWithContext(ctx, "GET", p.config.MicrosoftGraphURL+"/v1.0/me", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add authorization header
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	// Send request
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Check response
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("failed to get user info: " + resp.Status)
+	}
+
+	// Parse response
+	var userInfo map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&userInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return userInfo, nil
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-azure/config"
+	"go-azure/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testTenantID = "11111111-2222-3333-4444-555555555555"
+	testClientID = "test-client"
+)
+
+// fakeMicrosoft is a Microsoft identity platform and Graph API serving one tenant. It checks the
+// PKCE verifier at the token endpoint and signs ID tokens with its own key.
+type fakeMicrosoft struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	keyID  string
+
+	mu            sync.Mutex
+	logins        map[string]fakeLogin // by code
+	tokenRequests int
+	// idTokenClaims changes the claims of the ID tokens issued
+	idTokenClaims func(claims jwt.MapClaims)
+}
+
+// fakeLogin is what the authorize endpoint was sent, kept until its code is redeemed
+type fakeLogin struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeMicrosoft(t *testing.T) *fakeMicrosoft {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := utils.NewJWK(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeMicrosoft{key: key, keyID: jwk.KeyID, logins: make(map[string]fakeLogin)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{tenant}/oauth2/v2.0/authorize", fake.authorize)
+	mux.HandleFunc("POST /{tenant}/oauth2/v2.0/token", fake.token)
+	mux.HandleFunc("GET /{tenant}/discovery/v2.0/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(utils.JWKS{Keys: []utils.JWK{jwk}})
+	})
+	mux.HandleFunc("GET /v1.0/me", fake.me)
+	fake.server = httptest.NewServer(mux)
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+// config returns the configuration of an app signing in users of tenant
+func (f *fakeMicrosoft) config(tenant string) *config.Config {
+	return &config.Config{
+		MicrosoftClientID:     testClientID,
+		MicrosoftClientSecret: "test-secret",
+		MicrosoftRedirectURI:  "http://localhost/auth/microsoft/callback",
+		MicrosoftTenantID:     tenant,
+		MicrosoftAuthorityURL: f.server.URL,
+		MicrosoftGraphURL:     f.server.URL,
+	}
+}
+
+func (f *fakeMicrosoft) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE is required", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	f.mu.Lock()
+	f.logins[code] = fakeLogin{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	f.mu.Unlock()
+
+	redirectURL, _ := url.Parse(query.Get("redirect_uri"))
+	redirectURL.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+func (f *fakeMicrosoft) token(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokenRequests++
+
+	login, ok := f.logins[r.FormValue("code")]
+	delete(f.logins, r.FormValue("code"))
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != login.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   f.server.URL + "/" + testTenantID + "/v2.0",
+		"aud":   testClientID,
+		"sub":   "subject",
+		"tid":   testTenantID,
+		"nonce": login.nonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	if f.idTokenClaims != nil {
+		f.idTokenClaims(claims)
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = f.keyID
+	signed, err := idToken.SignedString(f.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "graph-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func (f *fakeMicrosoft) me(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer graph-token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":                "graph-id",
+		"userPrincipalName": "ada@example.com",
+		"displayName":       "Ada Lovelace",
+	})
+}
+
+// authorizeCode follows a login URL to the fake's authorize endpoint and returns the code it
+// redirects back with
+func authorizeCode(t *testing.T, loginURL string) string {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %s", resp.Status)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code")
+}
+
+// login starts a login with the provider and returns its request and the authorization code
+func login(t *testing.T, provider *MicrosoftProvider) (LoginRequest, string) {
+	t.Helper()
+
+	request := LoginRequest{State: rand.Text(), CodeVerifier: oauth2.GenerateVerifier(), Nonce: rand.Text()}
+	loginURL, err := provider.LoginURL(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request, authorizeCode(t, loginURL)
+}
+
+func TestMicrosoftProviderSendsPKCEVerifier(t *testing.T) {
+	fake := newFakeMicrosoft(t)
+	provider := NewMicrosoftProvider(fake.config("common"))
+
+	request, code := login(t, provider)
+	identity, err := provider.Authenticate(context.Background(), code, request)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if identity.Subject != "graph-id" || identity.Email != "ada@example.com" || !identity.EmailVerified {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	request, code = login(t, provider)
+	request.CodeVerifier = oauth2.GenerateVerifier()
+	if _, err := provider.Authenticate(context.Background(), code, request); err == nil {
+		t.Error("Authenticate with another code verifier succeeded")
+	}
+}
+
+func TestMicrosoftProviderRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		tenant        string
+		idTokenClaims func(jwt.MapClaims)
+		nonce         string
+	}{
+		{name: "nonce mismatch", tenant: "common", nonce: "another-nonce"},
+		{name: "expired", tenant: "common", idTokenClaims: func(claims jwt.MapClaims) {
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		}},
+		{name: "another audience", tenant: "common", idTokenClaims: func(claims jwt.MapClaims) {
+			claims["aud"] = "another-client"
+		}},
+		{name: "another authority", tenant: "common", idTokenClaims: func(claims jwt.MapClaims) {
+			claims["iss"] = "https://attacker.example/" + testTenantID + "/v2.0"
+		}},
+		{name: "another tenant", tenant: "99999999-2222-3333-4444-555555555555"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeMicrosoft(t)
+			fake.idTokenClaims = test.idTokenClaims
+			provider := NewMicrosoftProvider(fake.config(test.tenant))
+
+			request, code := login(t, provider)
+			if test.nonce != "" {
+				request.Nonce = test.nonce
+			}
+			_, err := provider.Authenticate(context.Background(), code, request)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Authenticate error = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestMicrosoftProviderRejectsUnsignedIDToken(t *testing.T) {
+	fake := newFakeMicrosoft(t)
+	provider := NewMicrosoftProvider(fake.config("common"))
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sign with a key the tenant does not publish, under the kid of one it does
+	fake.key = other
+
+	request, code := login(t, provider)
+	if _, err := provider.Authenticate(context.Background(), code, request); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Authenticate error = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestHandleCallbackRejectsReusedState(t *testing.T) {
+	utils.InitCache()
+	fake := newFakeMicrosoft(t)
+	provider := NewMicrosoftProvider(fake.config("common"))
+	authService := NewAuthService(fake.config("common"), nil, nil, map[string]IdentityProvider{ProviderMicrosoft: provider})
+
+	state, loginURL, err := authService.StartLogin(ProviderMicrosoft, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(loginURL, "state="+url.QueryEscape(state)) {
+		t.Fatalf("login URL %q does not carry the state", loginURL)
+	}
+	code := authorizeCode(t, loginURL)
+
+	// The first callback redeems the state even when the login then fails
+	fake.idTokenClaims = func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }
+	if _, _, err := authService.HandleCallback(ProviderMicrosoft, code, state, ""); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("HandleCallback error = %v, want %v", err, ErrInvalidIDToken)
+	}
+	if _, _, err := authService.HandleCallback(ProviderMicrosoft, code, state, ""); !errors.Is(err, ErrInvalidOAuthState) {
+		t.Errorf("HandleCallback with a used state error = %v, want %v", err, ErrInvalidOAuthState)
+	}
+	if fake.tokenRequests != 1 {
+		t.Errorf("token endpoint was called %d times, want 1", fake.tokenRequests)
+	}
+}
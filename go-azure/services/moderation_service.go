@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRole is returned when a role is not one of the known user roles
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrUserNotFound is returned when a user does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrModerationReasonRequired is returned when a moderator removes someone else's content without a reason
+	ErrModerationReasonRequired = errors.New("a reason is required when removing another user's content")
+)
+
+// ModerationService handles roles and the moderation log
+type ModerationService struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewModerationService creates a new ModerationService
+func NewModerationService() *ModerationService {
+	return &ModerationService{
+		db:     utils.GetDB(),
+		logger: utils.GetLogger(),
+	}
+}
+
+// SetUserRole changes the role of a user. The new role is carried by tokens issued after the change.
+// A role set here is kept even if the user's email is listed in ADMIN_EMAILS.
+func (s *ModerationService) SetUserRole(userID string, role string, adminID string) (*models.User, error) {
+	if !models.IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	var user models.User
+	result := s.db.Where("id = ?", userID).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get user")
+		return nil, errors.New("failed to get user")
+	}
+
+	if err := s.db.Model(&user).Updates(map[string]any{"role": role, "role_edited": true}).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to update user role")
+		return nil, errors.New("failed to update user role")
+	}
+	user.Role = role
+	user.RoleEdited = true
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"role":     role,
+		"admin_id": adminID,
+	}).Info("User role updated")
+
+	return &user, nil
+}
+
+// GetModerationActions returns the moderation log, newest first
+func (s *ModerationService) GetModerationActions(page int, pageSize int) (map[string]any, error) {
+	var actions []models.ModerationAction
+	var totalCount int64
+
+	// Defaults
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	offset := (page - 1) * pageSize
+
+	if err := s.db.Model(&models.ModerationAction{}).Count(&totalCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count moderation actions")
+		return nil, err
+	}
+
+	if err := s.db.
+		Order("created_at desc").
+		Limit(pageSize).
+		Offset(offset).
+		Find(&actions).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get moderation actions")
+		return nil, err
+	}
+
+	totalPages := (totalCount + int64(pageSize) - 1) / int64(pageSize)
+
+	return map[string]any{
+		"actions":      actions,
+		"total_count":  totalCount,
+		"current_page": page,
+		"total_pages":  totalPages,
+	}, nil
+}
+
+// canModify reports whether a user with the given role may change content owned by ownerID
+func canModify(ownerID string, userID string, role string) bool {
+	return ownerID == userID || models.CanModerate(role)
+}
+
+// recordModerationAction writes an entry to the moderation log when a moderator
+// acts on content owned by another user. Owners acting on their own content are not logged.
+func recordModerationAction(tx *gorm.DB, moderatorID string, targetType string, targetID string, targetUserID string, action string, reason string) error {
+	if moderatorID == targetUserID {
+		return nil
+	}
+
+	entry := models.ModerationAction{
+		ID:           uuid.New().String(),
+		ModeratorID:  moderatorID,
+		TargetType:   targetType,
+		TargetID:     targetID,
+		TargetUserID: targetUserID,
+		Action:       action,
+		Reason:       reason,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	utils.GetLogger().WithFields(logrus.Fields{
+		"moderator_id": moderatorID,
+		"target_type":  targetType,
+		"target_id":    targetID,
+		"action":       action,
+	}).Info("Moderation action recorded")
+
+	return nil
+}
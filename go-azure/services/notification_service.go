@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotificationNotFound is returned when a notification does not exist for the user
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// notificationActorsShown is how many of the latest actors are listed on a notification
+const notificationActorsShown = 2
+
+// NotificationEvent is something a user did that the recipient should hear about
+type NotificationEvent struct {
+	RecipientID string
+	ActorID     string
+	Type        string
+	PostID      string
+	CommentID   string
+}
+
+// groupKey identifies the notification that events of the same kind on the same target fold into
+func (e NotificationEvent) groupKey() string {
+	switch {
+	case e.CommentID != "":
+		return e.Type + ":" + e.CommentID
+	case e.PostID != "":
+		return e.Type + ":" + e.PostID
+	default:
+		return e.Type
+	}
+}
+
+// NotificationPage is a page of a user's notifications, most recently updated first
+type NotificationPage struct {
+	Notifications []models.Notification `json:"notifications"`
+	NextCursor    string                `json:"next_cursor,omitempty"`
+	HasMore       bool                  `json:"has_more"`
+	UnreadCount   int64                 `json:"unread_count"`
+}
+
+// NotificationService records and lists in-app notifications
+type NotificationService struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+	stream *StreamHub
+
+	// Events waiting to be recorded by the worker
+	events chan NotificationEvent
+}
+
+// NewNotificationService creates a new NotificationService
+func NewNotificationService(stream *StreamHub) *NotificationService {
+	return &NotificationService{
+		db:     utils.GetDB(),
+		logger: utils.GetLogger(),
+		stream: stream,
+		events: make(chan NotificationEvent, 1000),
+	}
+}
+
+// Notify queues an event for the worker and returns immediately, so notifying never slows
+// down or fails the request that caused it. Events are dropped when the queue is full and
+// events where users act on their own content are ignored.
+func (s *NotificationService) Notify(event NotificationEvent) {
+	if event.RecipientID == "" || event.RecipientID == event.ActorID {
+		return
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		s.logger.WithFields(logrus.Fields{
+			"type":         event.Type,
+			"recipient_id": event.RecipientID,
+		}).Warn("Notification queue is full, dropping notification")
+	}
+}
+
+// StartWorker records queued notifications until ctx is cancelled. Events are recorded one
+// at a time so concurrent events for the same group cannot create duplicate notifications.
+func (s *NotificationService) StartWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.events:
+			notificationID, err := s.record(event)
+			if err != nil {
+				s.logger.WithError(err).WithFields(logrus.Fields{
+					"type":         event.Type,
+					"recipient_id": event.RecipientID,
+				}).Error("Failed to record notification")
+				continue
+			}
+			if notificationID != "" {
+				s.push(event.RecipientID, notificationID)
+			}
+		}
+	}
+}
+
+// record folds the event into the recipient's unread notification of the same group, or starts a new one.
+// It returns the ID of the changed notification, or "" when an actor already counted in the group
+// left it unchanged.
+func (s *NotificationService) record(event NotificationEvent) (string, error) {
+	var changedID string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var notification models.Notification
+		err := tx.Where("user_id = ? AND group_key = ? AND is_read = ?", event.RecipientID, event.groupKey(), false).
+			Order("updated_at desc").
+			First(&notification).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			notification = models.Notification{
+				NotificationID: uuid.New().String(),
+				UserID:         event.RecipientID,
+				Type:           event.Type,
+				GroupKey:       event.groupKey(),
+				PostID:         event.PostID,
+				CommentID:      event.CommentID,
+			}
+			if err := tx.Create(&notification).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		actor := models.NotificationActor{NotificationID: notification.NotificationID, ActorID: event.ActorID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&actor)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		changedID = notification.NotificationID
+		return tx.Model(&notification).Updates(map[string]any{
+			"actor_count":   gorm.Expr("actor_count + 1"),
+			"last_actor_id": event.ActorID,
+			"updated_at":    time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return changedID, nil
+}
+
+// push sends the changed notification and the unread count to the recipient's open streams
+func (s *NotificationService) push(userID string, notificationID string) {
+	notifications := make([]models.Notification, 1)
+	if err := s.db.Where("notification_id = ?", notificationID).First(&notifications[0]).Error; err != nil {
+		s.logger.WithError(err).Warn("Failed to load notification for the stream")
+		return
+	}
+	if err := s.attachActors(notifications); err != nil {
+		s.logger.WithError(err).Warn("Failed to load notification actors for the stream")
+		return
+	}
+	unreadCount, err := s.GetUnreadCount(userID)
+	if err != nil {
+		return
+	}
+
+	s.stream.Publish(userID, StreamEvent{
+		Type: StreamEventNotification,
+		Data: NotificationEventData{Notification: notifications[0], UnreadCount: unreadCount},
+	})
+}
+
+// GetNotifications returns the user's notifications, most recently updated first, using keyset
+// pagination on (updated_at, notification_id). With unreadOnly only unread ones are listed.
+func (s *NotificationService) GetNotifications(userID string, cursor string, limit int, unreadOnly bool) (*NotificationPage, error) {
+	var notifications []models.Notification
+
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	query := s.db.Where("user_id = ? AND actor_count > 0", userID)
+	if unreadOnly {
+		query = query.Where("is_read = ?", false)
+	}
+	if cursor != "" {
+		position, err := utils.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("updated_at < ? OR (updated_at = ? AND notification_id < ?)", position.CreatedAt, position.CreatedAt, position.ID)
+	}
+
+	hasMore, err := utils.FindPage(query.Order("updated_at desc, notification_id desc"), limit, &notifications)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get notifications")
+		return nil, err
+	}
+
+	page := &NotificationPage{HasMore: hasMore}
+	if page.HasMore {
+		last := notifications[len(notifications)-1]
+		page.NextCursor = utils.EncodeCursor(last.UpdatedAt, last.NotificationID)
+	}
+
+	if err := s.attachActors(notifications); err != nil {
+		s.logger.WithError(err).Error("Failed to get notification actors")
+		return nil, err
+	}
+	page.Notifications = notifications
+
+	unreadCount, err := s.GetUnreadCount(userID)
+	if err != nil {
+		return nil, err
+	}
+	page.UnreadCount = unreadCount
+
+	return page, nil
+}
+
+// GetUnreadCount returns the number of unread notifications of the user
+func (s *NotificationService) GetUnreadCount(userID string) (int64, error) {
+	var count int64
+	if err := s.db.Model(&models.Notification{}).
+		Where("user_id = ? AND is_read = ? AND actor_count > 0", userID, false).
+		Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count unread notifications")
+		return 0, err
+	}
+	return count, nil
+}
+
+// MarkRead marks one of the user's notifications as read
+func (s *NotificationService) MarkRead(userID string, notificationID string) error {
+	// UpdateColumns keeps updated_at, which orders the list, unchanged
+	result := s.db.Model(&models.Notification{}).
+		Where("notification_id = ? AND user_id = ?", notificationID, userID).
+		UpdateColumns(map[string]any{"is_read": true, "read_at": gorm.Expr("COALESCE(read_at, ?)", time.Now())})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to mark notification as read")
+		return errors.New("failed to mark notification as read")
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := s.db.Model(&models.Notification{}).Where("notification_id = ? AND user_id = ?", notificationID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotificationNotFound
+		}
+	}
+	return nil
+}
+
+// MarkAllRead marks all of the user's notifications as read and returns how many were unread
+func (s *NotificationService) MarkAllRead(userID string) (int64, error) {
+	result := s.db.Model(&models.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		UpdateColumns(map[string]any{"is_read": true, "read_at": time.Now()})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to mark notifications as read")
+		return 0, errors.New("failed to mark notifications as read")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+		"count":   result.RowsAffected,
+	}).Info("Notifications marked as read")
+
+	return result.RowsAffected, nil
+}
+
+// attachActors fills in the latest actors and the message of each notification
+func (s *NotificationService) attachActors(notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		ids = append(ids, notification.NotificationID)
+	}
+
+	// Keep the latest few actors of each notification
+	var actors []struct {
+		NotificationID string
+		models.NotificationActorSummary
+	}
+	ranked := s.db.Model(&models.NotificationActor{}).
+		Select("notification_actors.notification_id, notification_actors.actor_id, notification_actors.created_at, "+
+			"ROW_NUMBER() OVER (PARTITION BY notification_actors.notification_id ORDER BY notification_actors.created_at desc) AS actor_rank").
+		Where("notification_actors.notification_id IN ?", ids)
+	if err := s.db.Table("(?) AS actors", ranked).
+		Select("actors.notification_id, users.id, users.name, users.username").
+		Joins("JOIN users ON users.id = actors.actor_id").
+		Where("actors.actor_rank <= ?", notificationActorsShown).
+		Order("actors.created_at desc").
+		Scan(&actors).Error; err != nil {
+		return err
+	}
+
+	byNotification := make(map[string][]models.NotificationActorSummary)
+	for _, actor := range actors {
+		byNotification[actor.NotificationID] = append(byNotification[actor.NotificationID], actor.NotificationActorSummary)
+	}
+
+	for i := range notifications {
+		notifications[i].Actors = byNotification[notifications[i].NotificationID]
+		notifications[i].Message = notificationMessage(&notifications[i])
+	}
+	return nil
+}
+
+// notificationMessage describes a notification, such as "Ana and 12 others liked your post"
+func notificationMessage(notification *models.Notification) string {
+	actors := "Someone"
+	if len(notification.Actors) > 0 {
+		actors = notification.Actors[0].Name
+		switch {
+		case notification.ActorCount == 2 && len(notification.Actors) > 1:
+			actors += " and " + notification.Actors[1].Name
+		case notification.ActorCount == 2:
+			actors += " and 1 other"
+		case notification.ActorCount > 2:
+			actors += " and " + strconv.FormatInt(notification.ActorCount-1, 10) + " others"
+		}
+	}
+
+	target := "your post"
+	if notification.CommentID != "" {
+		target = "your comment"
+	}
+
+	switch notification.Type {
+	case models.NotificationComment:
+		return actors + " commented on your post"
+	case models.NotificationReply:
+		return actors + " replied to your comment"
+	case models.NotificationLike:
+		return actors + " liked " + target
+	case models.NotificationReaction:
+		return actors + " reacted to " + target
+	case models.NotificationMention:
+		return actors + " mentioned you in a post"
+	case models.NotificationFollow:
+		return actors + " followed you"
+	default:
+		return actors + " interacted with you"
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-azure/models"
+	"go-azure/testutil"
+)
+
+func TestNotificationWorkerSkipsRepeatedActors(t *testing.T) {
+	db := testutil.OpenDB(t)
+	author := testutil.CreateUser(t, db, "Ada")
+	grace := testutil.CreateUser(t, db, "Grace")
+	bob := testutil.CreateUser(t, db, "Bob")
+	post := createPost(t, db, author.ID, 0)
+
+	stream := NewStreamHub()
+	sub := stream.Subscribe(author.ID)
+	s := NewNotificationService(stream)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.StartWorker(ctx)
+
+	// Events are recorded in order, so the push for Bob comes after Grace's repeat was handled
+	for _, actorID := range []string{grace.ID, grace.ID, bob.ID} {
+		s.Notify(NotificationEvent{RecipientID: author.ID, ActorID: actorID, Type: models.NotificationLike, PostID: post.PostID})
+	}
+	for _, want := range []int64{1, 2} {
+		select {
+		case event := <-sub.events:
+			data := event.Data.(NotificationEventData)
+			if data.Notification.ActorCount != want {
+				t.Errorf("pushed actor_count = %d, want %d", data.Notification.ActorCount, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification was not pushed")
+		}
+	}
+
+	var notifications []models.Notification
+	if err := db.Where("user_id = ?", author.ID).Find(&notifications).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || notifications[0].ActorCount != 2 {
+		t.Errorf("notifications = %+v, want one with 2 actors", notifications)
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-azure/config"
+	"go-azure/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// ProviderOIDC is the name of the generic OpenID Connect identity provider
+const ProviderOIDC = "oidc"
+
+const (
+	// jwksRefreshInterval is the least time between fetches of the signing keys, which are fetched
+	// again when an ID token is signed with a key that is not known yet
+	jwksRefreshInterval = time.Minute
+	// maxIDTokenClockSkew is how far the provider's clock may be ahead or behind
+	maxIDTokenClockSkew = time.Minute
+)
+
+// idTokenSigningMethods are the asymmetric algorithms accepted for ID tokens
+var idTokenSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// oidcDiscovery is the part of the issuer's OpenID Provider Metadata the provider uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClaims are the ID token claims the provider reads
+type oidcClaims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"` // a boolean, or a string with some providers
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// OIDCProvider signs users in with any OpenID Connect provider. The endpoints are discovered from
+// the issuer on first use and ID tokens are verified against the issuer's published keys.
+type OIDCProvider struct {
+	config *config.Config
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	jwks          *utils.JWKS
+	jwksFetchedAt time.Time
+}
+
+// NewOIDCProvider creates a new OIDCProvider
+func NewOIDCProvider(config *config.Config) *OIDCProvider {
+	return &OIDCProvider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name implements IdentityProvider
+func (p *OIDCProvider) Name() string {
+	return ProviderOIDC
+}
+
+// RedirectURL implements IdentityProvider
+func (p *OIDCProvider) RedirectURL() string {
+	return p.config.OIDCRedirectURI
+}
+
+// LoginURL implements IdentityProvider
+func (p *OIDCProvider) LoginURL(ctx context.Context, login LoginRequest) (string, error) {
+	oauthConfig, err := p.oauthConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	options := []oauth2.AuthCodeOption{
+		oauth2.S256ChallengeOption(login.CodeVerifier),
+		oauth2.SetAuthURLParam("nonce", login.Nonce),
+	}
+	if login.LoginHint != "" {
+		options = append(options, oauth2.SetAuthURLParam("login_hint", login.LoginHint))
+	}
+	return oauthConfig.AuthCodeURL(login.State, options...), nil
+}
+
+// Authenticate implements IdentityProvider
+func (p *OIDCProvider) Authenticate(ctx context.Context, code string, login LoginRequest) (*ExternalIdentity, error) {
+	oauthConfig, err := p.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: id_token missing from token response", ErrInvalidIDToken)
+	}
+	claims, err := p.verifyIDToken(ctx, rawIDToken, login.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Email == "" {
+		return nil, errors.New("id_token has no email; the email scope is required")
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
+	}
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+
+	return &ExternalIdentity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          name,
+	}, nil
+}
+
+// verifyIDToken checks the ID token's signature against the issuer's keys, its issuer, audience,
+// expiry and nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*oidcClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims oidcClaims
+	_, err = jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		key, err := p.signingKey(ctx, keyID)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm != "" && key.Algorithm != token.Method.Alg() {
+			return nil, fmt.Errorf("key %q is not for %s", keyID, token.Method.Alg())
+		}
+		return key.PublicKey()
+	},
+		jwt.WithValidMethods(idTokenSigningMethods),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.OIDCClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(maxIDTokenClockSkew),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+	return &claims, nil
+}
+
+// oauthConfig returns the OAuth2 config for the discovered endpoints
+func (p *OIDCProvider) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.config.OIDCClientID,
+		ClientSecret: p.config.OIDCClientSecret,
+		RedirectURL:  p.config.OIDCRedirectURI,
+		Scopes:       p.config.OIDCScopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}, nil
+}
+
+// discover fetches the issuer's OpenID Provider Metadata once
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, p.config.OIDCIssuerURL+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover OpenID provider: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.OIDCIssuerURL {
+		return nil, fmt.Errorf("discovered issuer %q does not match %q", discovery.Issuer, p.config.OIDCIssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OpenID provider metadata is missing endpoints")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// signingKey returns the issuer's key with the key ID, fetching the keys again when it is unknown
+// so keys the issuer rotated in are picked up
+func (p *OIDCProvider) signingKey(ctx context.Context, keyID string) (utils.JWK, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.jwks != nil {
+		if key, ok := p.jwks.Key(keyID); ok {
+			return key, nil
+		}
+		if time.Since(p.jwksFetchedAt) < jwksRefreshInterval {
+			return utils.JWK{}, fmt.Errorf("unknown signing key %q", keyID)
+		}
+	}
+
+	var jwks utils.JWKS
+	if err := p.getJSON(ctx, p.discovery.JWKSURI, &jwks); err != nil {
+		return utils.JWK{}, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	p.jwks = &jwks
+	p.jwksFetchedAt = time.Now()
+
+	if key, ok := p.jwks.Key(keyID); ok {
+		return key, nil
+	}
+	return utils.JWK{}, fmt.Errorf("unknown signing key %q", keyID)
+}
+
+// getJSON fetches a JSON document from the provider
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("unexpected response: " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPersonalAccessTokenNotFound is returned when a user has no personal access token with the ID
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+	// ErrInvalidPersonalAccessToken is returned for personal access tokens that are unknown, revoked
+	// or expired, or whose user was deleted
+	ErrInvalidPersonalAccessToken = errors.New("invalid personal access token")
+	// ErrInvalidTokenName is returned for an empty or overlong token name
+	ErrInvalidTokenName = errors.New("name must be between 1 and 100 characters")
+	// ErrInvalidScopes is returned when a token is created without scopes or with an unknown one
+	ErrInvalidScopes = errors.New("scopes must be one or more of posts:read, posts:write, posts:*, tasks:read, tasks:write, tasks:*")
+	// ErrInvalidTokenExpiry is returned for an expiry that is not in the future
+	ErrInvalidTokenExpiry = errors.New("expires_at must be in the future")
+	// ErrTooManyTokens is returned when a user already has MaxPersonalAccessTokens tokens
+	ErrTooManyTokens = errors.New("too many personal access tokens")
+)
+
+const (
+	// MaxPersonalAccessTokens is how many personal access tokens a user can have
+	MaxPersonalAccessTokens = 50
+	// maxTokenNameLength is the longest name a personal access token can have
+	maxTokenNameLength = 100
+	// lastUsedInterval is how stale last_used_at may get before a use of the token updates it, so
+	// busy scripts do not write on every request
+	lastUsedInterval = time.Minute
+)
+
+// CreatedPersonalAccessToken is a new personal access token with the token itself, which is not
+// stored and cannot be shown again
+type CreatedPersonalAccessToken struct {
+	models.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// PersonalAccessTokenService manages the personal access tokens scripts and integrations
+// authenticate with
+type PersonalAccessTokenService struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewPersonalAccessTokenService creates a new PersonalAccessTokenService
+func NewPersonalAccessTokenService() *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{
+		db:     utils.GetDB(),
+		logger: utils.GetLogger(),
+	}
+}
+
+// CreateToken creates a personal access token for the user with the scopes. Tokens without
+// expiresAt never expire.
+func (s *PersonalAccessTokenService) CreateToken(userID string, name string, scopes []string, expiresAt *time.Time) (*CreatedPersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTokenNameLength {
+		return nil, ErrInvalidTokenName
+	}
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScopes
+	}
+	scopeSet := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		if !models.IsValidScope(scope) {
+			return nil, ErrInvalidScopes
+		}
+		scopeSet[scope] = true
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidTokenExpiry
+	}
+
+	var count int64
+	if err := s.db.Model(&models.PersonalAccessToken{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count personal access tokens")
+		return nil, errors.New("failed to create personal access token")
+	}
+	if count >= MaxPersonalAccessTokens {
+		return nil, ErrTooManyTokens
+	}
+
+	token := &CreatedPersonalAccessToken{
+		PersonalAccessToken: models.PersonalAccessToken{
+			TokenID:   uuid.New().String(),
+			UserID:    userID,
+			Name:      name,
+			Scopes:    make(models.Scopes, 0, len(scopeSet)),
+			ExpiresAt: expiresAt,
+		},
+		Token: models.PersonalAccessTokenPrefix + rand.Text(),
+	}
+	for scope := range scopeSet {
+		token.Scopes = append(token.Scopes, scope)
+	}
+	sort.Strings(token.Scopes)
+	token.TokenHash = utils.HashRefreshToken(token.Token)
+
+	if err := s.db.Create(&token.PersonalAccessToken).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to create personal access token")
+		return nil, errors.New("failed to create personal access token")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"token_id": token.TokenID,
+		"scopes":   token.Scopes,
+	}).Info("Personal access token created")
+	return token, nil
+}
+
+// GetTokens returns the user's personal access tokens, newest first
+func (s *PersonalAccessTokenService) GetTokens(userID string) ([]models.PersonalAccessToken, error) {
+	tokens := []models.PersonalAccessToken{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get personal access tokens")
+		return nil, errors.New("failed to get personal access tokens")
+	}
+	return tokens, nil
+}
+
+// RevokeToken deletes one of the user's personal access tokens, which stops working immediately
+func (s *PersonalAccessTokenService) RevokeToken(userID string, tokenID string) error {
+	result := s.db.Where("token_id = ? AND user_id = ?", tokenID, userID).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to revoke personal access token")
+		return errors.New("failed to revoke personal access token")
+	}
+	if result.RowsAffected == 0 {
+		return ErrPersonalAccessTokenNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"token_id": tokenID,
+	}).Info("Personal access token revoked")
+	return nil
+}
+
+// Authenticate returns the personal access token and the user it belongs to, recording its use
+func (s *PersonalAccessTokenService) Authenticate(tokenString string) (*models.PersonalAccessToken, *models.User, error) {
+	var token models.PersonalAccessToken
+	if err := s.db.Where("token_hash = ?", utils.HashRefreshToken(tokenString)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidPersonalAccessToken
+		}
+		s.logger.WithError(err).Error("Failed to get personal access token")
+		return nil, nil, errors.New("failed to validate token")
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", token.UserID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidPersonalAccessToken
+		}
+		s.logger.WithError(err).Error("Failed to get user of personal access token")
+		return nil, nil, errors.New("failed to validate token")
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedInterval {
+		if err := s.db.Model(&models.PersonalAccessToken{}).Where("token_id = ?", token.TokenID).UpdateColumn("last_used_at", now).Error; err != nil {
+			s.logger.WithError(err).Warn("Failed to record personal access token use")
+		}
+	}
+	return &token, &user, nil
+}
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidReactionType is returned for reaction types that are not in REACTION_TYPES
+var ErrInvalidReactionType = errors.New("invalid reaction type")
+
+// ReactionService handles reactions to posts and comments
+type ReactionService struct {
+	db            *gorm.DB
+	logger        *logrus.Logger
+	types         []string
+	notifications *NotificationService
+	stream        *StreamHub
+}
+
+// NewReactionService creates a new ReactionService
+func NewReactionService(cfg *config.Config, notifications *NotificationService, stream *StreamHub) *ReactionService {
+	types := make([]string, 0, len(cfg.ReactionTypes))
+	for _, reactionType := range cfg.ReactionTypes {
+		types = append(types, strings.ToLower(reactionType))
+	}
+
+	return &ReactionService{
+		db:            utils.GetDB(),
+		logger:        utils.GetLogger(),
+		types:         types,
+		notifications: notifications,
+		stream:        stream,
+	}
+}
+
+// Types returns the reaction types users can pick from, in display order
+func (s *ReactionService) Types() []string {
+	return s.types
+}
+
+// ReactToPost sets the user's reaction to the post, replacing any reaction of another type
+func (s *ReactionService) ReactToPost(postID string, userID string, reactionType string) (*models.SocialMediaPost, error) {
+	post, err := s.getPost(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := s.react(postID, "", userID, reactionType)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		s.notifications.Notify(NotificationEvent{
+			RecipientID: post.UserID,
+			ActorID:     userID,
+			Type:        reactionNotificationType(reactionType),
+			PostID:      postID,
+		})
+	}
+
+	if err := attachPostDetails(s.db, []*models.SocialMediaPost{post}, userID); err != nil {
+		return nil, err
+	}
+	if changed {
+		s.broadcastPostReactions(post)
+	}
+
+	return post, nil
+}
+
+// RemovePostReaction removes the user's reaction to the post. When reactionType is set, only a
+// reaction of that type is removed. Removing a reaction that does not exist is a no-op.
+func (s *ReactionService) RemovePostReaction(postID string, userID string, reactionType string) (*models.SocialMediaPost, error) {
+	post, err := s.getPost(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.removeReaction(postID, "", userID, reactionType); err != nil {
+		return nil, err
+	}
+
+	if err := attachPostDetails(s.db, []*models.SocialMediaPost{post}, userID); err != nil {
+		return nil, err
+	}
+	s.broadcastPostReactions(post)
+
+	return post, nil
+}
+
+// ReactToComment sets the user's reaction to the comment, replacing any reaction of another type
+func (s *ReactionService) ReactToComment(postID string, commentID string, userID string, reactionType string) (*models.SocialMediaComments, error) {
+	comment, err := s.getComment(postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := s.react(postID, commentID, userID, reactionType)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		s.notifications.Notify(NotificationEvent{
+			RecipientID: comment.UserID,
+			ActorID:     userID,
+			Type:        reactionNotificationType(reactionType),
+			PostID:      postID,
+			CommentID:   commentID,
+		})
+	}
+
+	if err := attachCommentReactions(s.db, []*models.SocialMediaComments{comment}, userID); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// RemoveCommentReaction removes the user's reaction to the comment. Removing a reaction that does not exist is a no-op.
+func (s *ReactionService) RemoveCommentReaction(postID string, commentID string, userID string) (*models.SocialMediaComments, error) {
+	comment, err := s.getComment(postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.removeReaction(postID, commentID, userID, ""); err != nil {
+		return nil, err
+	}
+
+	if err := attachCommentReactions(s.db, []*models.SocialMediaComments{comment}, userID); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// react inserts the reaction or changes the type of the user's existing one. It reports whether
+// anything changed, which reacting again with the same type does not.
+func (s *ReactionService) react(postID string, commentID string, userID string, reactionType string) (bool, error) {
+	reactionType = strings.ToLower(strings.TrimSpace(reactionType))
+	if !slices.Contains(s.types, reactionType) {
+		return false, ErrInvalidReactionType
+	}
+
+	reaction := models.Reaction{
+		ReactionID: uuid.New().String(),
+		PostID:     postID,
+		CommentID:  commentID,
+		UserID:     userID,
+		Type:       reactionType,
+	}
+
+	// The unique (post_id, comment_id, user_id) index turns a second reaction into a type change
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to save reaction")
+		return false, errors.New("failed to save reaction")
+	}
+	if result.RowsAffected == 0 {
+		result = s.db.Model(&models.Reaction{}).
+			Where("post_id = ? AND comment_id = ? AND user_id = ? AND type <> ?", postID, commentID, userID, reactionType).
+			Update("type", reactionType)
+		if result.Error != nil {
+			s.logger.WithError(result.Error).Error("Failed to save reaction")
+			return false, errors.New("failed to save reaction")
+		}
+		if result.RowsAffected == 0 {
+			return false, nil
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"post_id":    postID,
+		"comment_id": commentID,
+		"user_id":    userID,
+		"type":       reactionType,
+	}).Info("Reaction saved")
+
+	return true, nil
+}
+
+// broadcastPostReactions pushes the post's new reaction counts to connected clients
+func (s *ReactionService) broadcastPostReactions(post *models.SocialMediaPost) {
+	s.stream.Broadcast(StreamEvent{
+		Type: StreamEventPostReactions,
+		Data: PostReactionsEvent{
+			PostID:        post.PostID,
+			Reactions:     post.Reactions,
+			ReactionCount: post.ReactionCount,
+			LikeCount:     post.LikeCount,
+		},
+	})
+}
+
+// reactionNotificationType reports likes as likes and any other reaction type as a reaction
+func reactionNotificationType(reactionType string) string {
+	if strings.EqualFold(strings.TrimSpace(reactionType), models.ReactionLike) {
+		return models.NotificationLike
+	}
+	return models.NotificationReaction
+}
+
+// removeReaction deletes the user's reaction, optionally only when it has the given type
+func (s *ReactionService) removeReaction(postID string, commentID string, userID string, reactionType string) error {
+	// Hard delete so the unique index allows reacting again later;
+	// reactions are only soft deleted together with their post
+	query := s.db.Unscoped().Where("post_id = ? AND comment_id = ? AND user_id = ?", postID, commentID, userID)
+	if reactionType != "" {
+		query = query.Where("type = ?", reactionType)
+	}
+	if err := query.Delete(&models.Reaction{}).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to remove reaction")
+		return errors.New("failed to remove reaction")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"post_id":    postID,
+		"comment_id": commentID,
+		"user_id":    userID,
+	}).Info("Reaction removed")
+
+	return nil
+}
+
+// getPost loads a post by ID
+func (s *ReactionService) getPost(postID string) (*models.SocialMediaPost, error) {
+	var post models.SocialMediaPost
+
+	result := s.db.Where("post_id = ?", postID).First(&post)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get social media post")
+		return nil, errors.New("failed to get social media post")
+	}
+
+	return &post, nil
+}
+
+// getComment loads a comment of a post; deleted placeholders cannot be reacted to
+func (s *ReactionService) getComment(postID string, commentID string) (*models.SocialMediaComments, error) {
+	var comment models.SocialMediaComments
+
+	result := s.db.Where("comment_id = ? AND post_id = ? AND is_deleted = ?", commentID, postID, false).First(&comment)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get comment")
+		return nil, errors.New("failed to get comment")
+	}
+
+	return &comment, nil
+}
+
+// reactionStats holds the reactions of a set of posts or comments
+type reactionStats struct {
+	counts map[string]map[string]int64 // target ID -> type -> count
+	mine   map[string]string           // target ID -> the viewer's reaction type
+}
+
+// loadReactionStats counts reactions per type for the targets and finds the viewer's own.
+// column is "post_id" for reactions to posts or "comment_id" for reactions to comments.
+// It runs at most two queries regardless of the number of targets.
+func loadReactionStats(db *gorm.DB, column string, targetIDs []string, viewerID string) (*reactionStats, error) {
+	stats := &reactionStats{
+		counts: make(map[string]map[string]int64),
+		mine:   make(map[string]string),
+	}
+	if len(targetIDs) == 0 {
+		return stats, nil
+	}
+
+	targets := func() *gorm.DB {
+		query := db.Model(&models.Reaction{}).Where(column+" IN ?", targetIDs)
+		if column == "post_id" {
+			query = query.Where("comment_id = ''")
+		}
+		return query
+	}
+
+	// Count reactions per target and type
+	var counts []struct {
+		TargetID string
+		Type     string
+		Total    int64
+	}
+	if err := targets().
+		Select(column + " AS target_id, type, COUNT(*) AS total").
+		Group(column + ", type").
+		Scan(&counts).Error; err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to count reactions")
+		return nil, errors.New("failed to count reactions")
+	}
+	for _, count := range counts {
+		if stats.counts[count.TargetID] == nil {
+			stats.counts[count.TargetID] = make(map[string]int64)
+		}
+		stats.counts[count.TargetID][count.Type] = count.Total
+	}
+
+	// Find the viewer's reactions
+	if viewerID != "" {
+		var mine []struct {
+			TargetID string
+			Type     string
+		}
+		if err := targets().
+			Select(column+" AS target_id, type").
+			Where("user_id = ?", viewerID).
+			Scan(&mine).Error; err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to get viewer reactions")
+			return nil, errors.New("failed to count reactions")
+		}
+		for _, reaction := range mine {
+			stats.mine[reaction.TargetID] = reaction.Type
+		}
+	}
+
+	return stats, nil
+}
+
+// total returns the number of reactions of any type to the target
+func (stats *reactionStats) total(targetID string) int64 {
+	var total int64
+	for _, count := range stats.counts[targetID] {
+		total += count
+	}
+	return total
+}
+
+// attachPostReactions fills the reaction fields of the posts for viewerID
+func attachPostReactions(db *gorm.DB, posts []*models.SocialMediaPost, viewerID string) error {
+	postIDs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.PostID)
+	}
+
+	stats, err := loadReactionStats(db, "post_id", postIDs, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Reactions = stats.counts[post.PostID]
+		post.ReactionCount = stats.total(post.PostID)
+		post.MyReaction = stats.mine[post.PostID]
+		post.LikeCount = post.Reactions[models.ReactionLike]
+		post.IsLiked = post.MyReaction == models.ReactionLike
+	}
+
+	return nil
+}
+
+// attachCommentReactions fills the reaction fields of the comments for viewerID.
+// Deleted placeholders are left without reactions.
+func attachCommentReactions(db *gorm.DB, comments []*models.SocialMediaComments, viewerID string) error {
+	commentIDs := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		if !comment.IsDeleted {
+			commentIDs = append(commentIDs, comment.CommentID)
+		}
+	}
+
+	stats, err := loadReactionStats(db, "comment_id", commentIDs, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		if comment.IsDeleted {
+			continue
+		}
+		comment.Reactions = stats.counts[comment.CommentID]
+		comment.ReactionCount = stats.total(comment.CommentID)
+		comment.MyReaction = stats.mine[comment.CommentID]
+	}
+
+	return nil
+}
+
+// attachPostDetails fills the computed fields of posts: reactions for viewerID and image variants
+func attachPostDetails(db *gorm.DB, posts []*models.SocialMediaPost, viewerID string) error {
+	if err := attachPostReactions(db, posts, viewerID); err != nil {
+		return err
+	}
+	return attachImageSets(db, posts)
+}
+
+// postPointers returns pointers to the elements of posts so they can be filled in place
+func postPointers(posts []models.SocialMediaPost) []*models.SocialMediaPost {
+	pointers := make([]*models.SocialMediaPost, len(posts))
+	for i := range posts {
+		pointers[i] = &posts[i]
+	}
+	return pointers
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/testutil"
+)
+
+func TestReactToPostNotifiesOnlyOnChange(t *testing.T) {
+	db := testutil.OpenDB(t)
+	author := testutil.CreateUser(t, db, "Ada")
+	reactor := testutil.CreateUser(t, db, "Grace")
+	post := createPost(t, db, author.ID, 0)
+
+	stream := NewStreamHub()
+	sub := stream.Subscribe(author.ID)
+	notifications := NewNotificationService(stream)
+	s := NewReactionService(&config.Config{ReactionTypes: []string{"like", "love"}}, notifications, stream)
+
+	tests := []struct {
+		name         string
+		reactionType string
+		changed      bool
+	}{
+		{name: "new reaction", reactionType: "like", changed: true},
+		{name: "same type again", reactionType: "like", changed: false},
+		{name: "same type in another case", reactionType: "LIKE", changed: false},
+		{name: "another type", reactionType: "love", changed: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queued, broadcast := len(notifications.events), len(sub.events)
+			reacted, err := s.ReactToPost(post.PostID, reactor.ID, test.reactionType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reacted.ReactionCount != 1 {
+				t.Errorf("reaction_count = %d, want 1", reacted.ReactionCount)
+			}
+
+			want := 0
+			if test.changed {
+				want = 1
+			}
+			if got := len(notifications.events) - queued; got != want {
+				t.Errorf("queued %d notifications, want %d", got, want)
+			}
+			if got := len(sub.events) - broadcast; got != want {
+				t.Errorf("broadcast %d events, want %d", got, want)
+			}
+		})
+	}
+
+	var reaction models.Reaction
+	if err := db.Where("post_id = ? AND user_id = ?", post.PostID, reactor.ID).First(&reaction).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reaction.Type != "love" {
+		t.Errorf("type = %q, want love", reaction.Type)
+	}
+}
@@ -1,10 +1,15 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
+	"go-azure/config"
 	"go-azure/models"
 	"go-azure/utils"
 
@@ -13,22 +18,61 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrPostNotFound is returned when a post does not exist
+	ErrPostNotFound = errors.New("post not found")
+	// ErrPostForbidden is returned when a user tries to modify a post they may not change
+	ErrPostForbidden = errors.New("only the post author or a moderator can modify this post")
+)
+
 // SocialMediaService handles task operations
 type SocialMediaService struct {
-	db     *gorm.DB
-	logger *logrus.Logger
+	config        *config.Config
+	db            *gorm.DB
+	logger        *logrus.Logger
+	timeline      *TimelineService
+	notifications *NotificationService
+	stream        *StreamHub
+
+	// FULLTEXT indexed columns of social_media_posts, loaded on first search
+	fullTextMu      sync.Mutex
+	fullTextColumns map[string]bool
 }
 
 // NewSocialMediaService creates a new SocialMediaService
-func NewSocialMediaService() *SocialMediaService {
+func NewSocialMediaService(config *config.Config, timeline *TimelineService, notifications *NotificationService, stream *StreamHub) *SocialMediaService {
 	return &SocialMediaService{
-		db:     utils.GetDB(),
-		logger: utils.GetLogger(),
+		config:        config,
+		db:            utils.GetDB(),
+		logger:        utils.GetLogger(),
+		timeline:      timeline,
+		notifications: notifications,
+		stream:        stream,
+	}
+}
+
+// postSortColumns is the allow-list of sort_by values, mapped to what posts are ordered by.
+// likes counts the like reactions on the post itself, not on its comments.
+var postSortColumns = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"post_text":  "post_text",
+	"likes": "(SELECT COUNT(*) FROM reactions WHERE reactions.post_id = social_media_posts.post_id" +
+		" AND reactions.comment_id = '' AND reactions.type = '" + models.ReactionLike + "' AND reactions.deleted_at IS NULL)",
+}
+
+// postOrder returns the ORDER BY clause for sortBy, which falls back to created_at when it is
+// not allow-listed. Ties are broken by post_id so pages do not overlap.
+func postOrder(sortBy, sortOrder string) string {
+	column, ok := postSortColumns[sortBy]
+	if !ok {
+		column = postSortColumns["created_at"]
 	}
+	return column + " " + sortOrder + ", post_id " + sortOrder
 }
 
 // GetAllSocialMediaPosts returns all posts with pagination and sorting
-func (s *SocialMediaService) GetAllSocialMediaPosts(page int, pageSize int, sortBy, sortOrder string) (map[string]interface{}, error) {
+func (s *SocialMediaService) GetAllSocialMediaPosts(page int, pageSize int, sortBy, sortOrder string, viewerID string) (map[string]interface{}, error) {
 	var posts []models.SocialMediaPost
 	var totalCount int64
 
@@ -39,9 +83,6 @@ func (s *SocialMediaService) GetAllSocialMediaPosts(page int, pageSize int, sort
 	if pageSize <= 0 {
 		pageSize = 10
 	}
-	if sortBy == "" {
-		sortBy = "created_at"
-	}
 	if sortOrder != "asc" && sortOrder != "desc" {
 		sortOrder = "desc"
 	}
@@ -49,7 +90,7 @@ func (s *SocialMediaService) GetAllSocialMediaPosts(page int, pageSize int, sort
 	offset := (page - 1) * pageSize
 
 	// Count total
-	if err := s.db.Raw("SELECT COUNT(post_id) FROM social_media_posts").Scan(&totalCount).Error; err != nil {
+	if err := s.db.Raw("SELECT COUNT(post_id) FROM social_media_posts WHERE deleted_at IS NULL").Scan(&totalCount).Error; err != nil {
 		s.logger.WithError(err).Error("Count failed")
 		return nil, err
 	}
@@ -57,7 +98,7 @@ func (s *SocialMediaService) GetAllSocialMediaPosts(page int, pageSize int, sort
 	// Fetch paginated posts
 	if err := s.db.
 		Select("post_id, post_text, post_image, user_id, created_at").
-		Order(sortBy + " " + sortOrder).
+		Order(postOrder(sortBy, sortOrder)).
 		Limit(pageSize).
 		Offset(offset).
 		Find(&posts).Error; err != nil {
@@ -65,6 +106,10 @@ func (s *SocialMediaService) GetAllSocialMediaPosts(page int, pageSize int, sort
 		return nil, err
 	}
 
+	if err := attachPostDetails(s.db, postPointers(posts), viewerID); err != nil {
+		return nil, err
+	}
+
 	totalPages := (totalCount + int64(pageSize) - 1) / int64(pageSize)
 
 	return map[string]any{
@@ -75,9 +120,142 @@ func (s *SocialMediaService) GetAllSocialMediaPosts(page int, pageSize int, sort
 	}, nil
 }
 
+// Feed directions for GetSocialMediaPostFeed
+const (
+	FeedDirectionNext = "next" // older posts
+	FeedDirectionPrev = "prev" // newer posts
+)
+
+// PostFeedPage is a page of the cursor-paginated post feed
+type PostFeedPage struct {
+	Posts      []models.SocialMediaPost `json:"posts"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	PrevCursor string                   `json:"prev_cursor,omitempty"`
+	HasMore    bool                     `json:"has_more"`
+	TotalCount *int64                   `json:"total_count,omitempty"`
+}
+
+// GetSocialMediaPostFeed returns posts newest first using keyset pagination on (created_at, post_id).
+// Unlike LIMIT/OFFSET, pages stay stable while new posts arrive: next_cursor walks towards older
+// posts and prev_cursor fetches posts newer than the first one on the page.
+// The total count is only computed when withCount is set because it scans the whole table.
+func (s *SocialMediaService) GetSocialMediaPostFeed(cursor string, direction string, limit int, withCount bool, viewerID string) (*PostFeedPage, error) {
+	var posts []models.SocialMediaPost
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if direction != FeedDirectionPrev {
+		direction = FeedDirectionNext
+	}
+
+	query := s.db.Select("post_id, post_text, post_image, user_id, created_at, updated_at")
+
+	var position *utils.Cursor
+	if cursor != "" {
+		var err error
+		position, err = utils.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if direction == FeedDirectionPrev && position != nil {
+		query = query.
+			Where("created_at > ? OR (created_at = ? AND post_id > ?)", position.CreatedAt, position.CreatedAt, position.ID).
+			Order("created_at asc, post_id asc")
+	} else {
+		if position != nil {
+			query = query.Where("created_at < ? OR (created_at = ? AND post_id < ?)", position.CreatedAt, position.CreatedAt, position.ID)
+		}
+		query = query.Order("created_at desc, post_id desc")
+	}
+
+	hasMore, err := utils.FindPage(query, limit, &posts)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to query post feed")
+		return nil, err
+	}
+
+	page := &PostFeedPage{Posts: posts}
+	if direction == FeedDirectionPrev && position != nil {
+		// Newer posts were read oldest first; flip them back to newest first
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+		// The cursor post itself is older than this page
+		page.HasMore = true
+	} else {
+		page.HasMore = hasMore
+	}
+
+	if len(posts) > 0 {
+		first, last := posts[0], posts[len(posts)-1]
+		page.PrevCursor = utils.EncodeCursor(first.CreatedAt, first.PostID)
+		if page.HasMore {
+			page.NextCursor = utils.EncodeCursor(last.CreatedAt, last.PostID)
+		}
+	} else if position != nil {
+		// Nothing new yet; keep handing back the same position so clients can poll
+		page.PrevCursor = cursor
+	}
+
+	if withCount {
+		var totalCount int64
+		if err := s.db.Model(&models.SocialMediaPost{}).Count(&totalCount).Error; err != nil {
+			s.logger.WithError(err).Error("Count failed")
+			return nil, err
+		}
+		page.TotalCount = &totalCount
+	}
+
+	if err := attachPostDetails(s.db, postPointers(page.Posts), viewerID); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// searchableColumns is the allow-list of post columns that can be searched.
+// The value tells whether the column can use a FULLTEXT index.
+var searchableColumns = map[string]bool{
+	"post_text":  true,
+	"post_image": false,
+	"user_id":    false,
+}
+
+// InvalidSearchColumnError is returned when a search targets a column that is not searchable
+type InvalidSearchColumnError struct {
+	Column string
+}
+
+func (e *InvalidSearchColumnError) Error() string {
+	return fmt.Sprintf("column %q is not searchable", e.Column)
+}
+
+// PostSearchResult is the response of QuerySocialMediaPost
+type PostSearchResult struct {
+	Posts         []models.SocialMediaPost `json:"posts"`
+	TotalCount    int64                    `json:"total_count"`
+	FilteredCount int64                    `json:"filtered_count"`
+	CurrentPage   int                      `json:"current_page"`
+	TotalPages    int64                    `json:"total_pages"`
+	SearchMode    string                   `json:"search_mode"`
+}
+
+// Search modes reported in PostSearchResult
+const (
+	SearchModeNone     = "none"
+	SearchModeFullText = "fulltext"
+	SearchModeLike     = "like"
+)
+
 // New query with optimized query tested on 500 thousand records
 //GUIDE FOR QUERY OPTIMIZATION ON mySQL table
-// --Add a FULLTEXT index on post_text:
+// --Add a FULLTEXT index on post_text (migrations.Migrate creates it when missing):
 
 // ALTER TABLE social_media_posts ADD FULLTEXT(post_text);
 
@@ -86,11 +264,11 @@ func (s *SocialMediaService) GetAllSocialMediaPosts(page int, pageSize int, sort
 // -- Ensure a FULLTEXT index exists on `post_text`
 // SELECT *
 // FROM social_media_posts
-// WHERE MATCH(post_text) AGAINST ('*test*' IN NATURAL LANGUAGE MODE)
+// WHERE MATCH(post_text) AGAINST ('test*' IN BOOLEAN MODE)
 // ORDER BY created_at DESC
 // LIMIT 10;
 // OFFSET 0;
-func (s *SocialMediaService) QuerySocialMediaPost(page, limit int, colName, searchText, sortBy, sortOrder string) (map[string]any, error) {
+func (s *SocialMediaService) QuerySocialMediaPost(page, limit int, colName, searchText, sortBy, sortOrder string, viewerID string) (*PostSearchResult, error) {
 	var posts []models.SocialMediaPost
 	var totalCount int64
 	var filteredCount int64
@@ -98,69 +276,86 @@ func (s *SocialMediaService) QuerySocialMediaPost(page, limit int, colName, sear
 	if page < 1 {
 		page = 1
 	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
 	offset := (page - 1) * limit
 
+	// Only allow-listed columns may be searched; post_text is the default
+	if colName == "" {
+		colName = "post_text"
+	}
+	fullTextCapable, ok := searchableColumns[colName]
+	if !ok {
+		return nil, &InvalidSearchColumnError{Column: colName}
+	}
+
 	// Validate sort order
 	validSortOrder := "asc"
 	if strings.ToLower(sortOrder) == "desc" {
 		validSortOrder = "desc"
 	}
 
-	// Restrict sortable columns
-	validSortBy := "created_at"
-	if sortBy != "" {
-		switch sortBy {
-		case "created_at", "updated_at", "likes", "post_text":
-			validSortBy = sortBy
-		}
-	}
-
 	// Base query
 	query := s.db.Model(&models.SocialMediaPost{})
 
 	// Total count before filtering
 	if err := query.Count(&totalCount).Error; err != nil {
+		s.logger.WithError(err).Error("Count failed")
 		return nil, err
 	}
 
-	// Apply full-text search filter if column name has value - Wilcard search supported
-	if colName == "post_text" && searchText != "" {
-		wildcardQuery := "*" + searchText + "*" // Apply wildcard full-text search (BOOLEAN MODE)
-		query = query.Where("MATCH("+colName+") AGAINST(? IN BOOLEAN MODE)", wildcardQuery)
-	} else {
-		query = query.Where(fmt.Sprintf("%s LIKE ?", colName), "%"+searchText+"%")
+	searchMode := SearchModeNone
+	searchText = strings.TrimSpace(searchText)
+	if searchText != "" {
+		fullTextQuery := buildFullTextQuery(searchText)
+		if fullTextCapable && fullTextQuery != "" && s.hasFullTextIndex(colName) {
+			// Prefix full-text search in BOOLEAN MODE; colName comes from the allow-list
+			searchMode = SearchModeFullText
+			query = query.Where("MATCH("+colName+") AGAINST(? IN BOOLEAN MODE)", fullTextQuery)
+		} else {
+			// LIKE fallback when the column has no FULLTEXT index
+			searchMode = SearchModeLike
+			query = query.Where(colName+" LIKE ?", "%"+escapeLike(searchText)+"%")
+		}
 	}
 
-	// Apply full-text search filter if post_text is searched not exact match
-	// if colName == "post_image" && searchText != "" {
-	// 	query = query.Where(fmt.Sprintf("%s LIKE ?", colName), "%"+searchText+"%")
-	// }
-
 	// Count after filtering
 	if err := query.Count(&filteredCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count filtered")
 		return nil, err
 	}
 
 	// Apply sort, limit, and offset
-	if err := query.Order(fmt.Sprintf("%s %s", validSortBy, validSortOrder)).
+	if err := query.Order(postOrder(sortBy, validSortOrder)).
 		Limit(limit).
 		Offset(offset).
 		Find(&posts).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to query posts")
+		return nil, err
+	}
+
+	if err := attachPostDetails(s.db, postPointers(posts), viewerID); err != nil {
 		return nil, err
 	}
 
 	totalPages := (filteredCount + int64(limit) - 1) / int64(limit)
 
-	return map[string]any{
-		"current_page":   page,
-		"filtered_count": filteredCount,
-		"posts":          posts,
-		"total_count":    totalCount,
-		"total_pages":    totalPages,
+	return &PostSearchResult{
+		Posts:         posts,
+		TotalCount:    totalCount,
+		FilteredCount: filteredCount,
+		CurrentPage:   page,
+		TotalPages:    totalPages,
+		SearchMode:    searchMode,
 	}, nil
 }
 
-// Old query with very slow performance tested on 500 thousand records
+// Old query with very slow performance tested on 500 thousand records. Kept to compare against
+// QuerySocialMediaPost; the column and sort are checked against the same allow-lists.
 func (s *SocialMediaService) QuerySocialMediaPost2(page, limit int, colName, searchText, sortBy, sortOrder string) (map[string]interface{}, error) {
 	var posts []models.SocialMediaPost
 	var totalCount, filteredCount int64
@@ -171,9 +366,6 @@ func (s *SocialMediaService) QuerySocialMediaPost2(page, limit int, colName, sea
 	if limit <= 0 {
 		limit = 10
 	}
-	if sortBy == "" {
-		sortBy = "created_at"
-	}
 	if sortOrder != "asc" && sortOrder != "desc" {
 		sortOrder = "asc"
 	}
@@ -189,7 +381,10 @@ func (s *SocialMediaService) QuerySocialMediaPost2(page, limit int, colName, sea
 
 	// Apply filter if applicable
 	if colName != "" && searchText != "" {
-		query = query.Where(colName+" LIKE ?", "%"+searchText+"%")
+		if _, ok := searchableColumns[colName]; !ok {
+			return nil, &InvalidSearchColumnError{Column: colName}
+		}
+		query = query.Where(colName+" LIKE ?", "%"+escapeLike(searchText)+"%")
 	}
 
 	// Count filtered
@@ -200,9 +395,7 @@ func (s *SocialMediaService) QuerySocialMediaPost2(page, limit int, colName, sea
 
 	// Fetch filtered and paginated posts
 	if err := query.
-		// Select("post_id, user_id, post_text, post_image, created_at").
-		// Where(colName+" LIKE ?", "%"+searchText+"%").
-		Order(sortBy + " " + sortOrder).
+		Order(postOrder(sortBy, sortOrder)).
 		Limit(limit).
 		Offset(offset).
 		Find(&posts).Error; err != nil {
@@ -221,21 +414,73 @@ func (s *SocialMediaService) QuerySocialMediaPost2(page, limit int, colName, sea
 	}, nil
 }
 
+// hasFullTextIndex reports whether a FULLTEXT index covers the column.
+// The lookup is cached once it succeeds; restart the API after adding the index by hand.
+func (s *SocialMediaService) hasFullTextIndex(column string) bool {
+	s.fullTextMu.Lock()
+	defer s.fullTextMu.Unlock()
+
+	if s.fullTextColumns == nil {
+		var columns []string
+		err := s.db.Raw(`SELECT column_name FROM information_schema.statistics
+			WHERE table_schema = DATABASE() AND table_name = ? AND index_type = 'FULLTEXT'`,
+			models.SocialMediaPost{}.TableName()).Scan(&columns).Error
+		if err != nil {
+			s.logger.WithError(err).Warn("Failed to look up FULLTEXT indexes, falling back to LIKE")
+			return false
+		}
+
+		s.fullTextColumns = make(map[string]bool, len(columns))
+		for _, c := range columns {
+			s.fullTextColumns[strings.ToLower(c)] = true
+		}
+	}
+
+	return s.fullTextColumns[column]
+}
+
+// buildFullTextQuery turns free text into a BOOLEAN MODE query that requires every word, each
+// prefix-matched ("+word*"). Boolean operators typed by the user are dropped so they cannot
+// produce a syntax error.
+func buildFullTextQuery(searchText string) string {
+	words := strings.FieldsFunc(searchText, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, "+"+word+"*")
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// escapeLike escapes the LIKE wildcards in a user supplied string
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
 // GetSocialMediaPostByID returns a post by PostID
-func (s *SocialMediaService) GetSocialMediaPostByPostID(PostID string) (*models.SocialMediaPost, error) {
+func (s *SocialMediaService) GetSocialMediaPostByPostID(PostID string, viewerID string) (*models.SocialMediaPost, error) {
 	var post models.SocialMediaPost
 
 	result := s.db.Where("post_id = ?", PostID).Find(&post)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to get social media post")
-		return nil, errors.New("post not found")
+		return nil, ErrPostNotFound
+	}
+
+	if post.PostID != "" {
+		if err := attachPostDetails(s.db, []*models.SocialMediaPost{&post}, viewerID); err != nil {
+			return nil, err
+		}
 	}
 
 	return &post, nil
 }
 
 // GetAllSocialMediaPost returns all post for a user
-func (s *SocialMediaService) GetAllSocialMediaPostByUserID(userID string) ([]*models.SocialMediaPost, error) {
+func (s *SocialMediaService) GetAllSocialMediaPostByUserID(userID string, viewerID string) ([]*models.SocialMediaPost, error) {
 	var posts []*models.SocialMediaPost
 
 	result := s.db.Where("user_id = ?", userID).Find(&posts)
@@ -244,6 +489,10 @@ func (s *SocialMediaService) GetAllSocialMediaPostByUserID(userID string) ([]*mo
 		return nil, errors.New("failed to get social media posts")
 	}
 
+	if err := attachPostDetails(s.db, posts, viewerID); err != nil {
+		return nil, err
+	}
+
 	return posts, nil
 }
 
@@ -254,7 +503,11 @@ func (s *SocialMediaService) GetSocialMediaPostByPostAndUserID(PostID string, us
 	result := s.db.Where("post_id = ? AND user_id = ?", PostID, userID).First(&post)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to get social media post")
-		return nil, errors.New("post not found")
+		return nil, ErrPostNotFound
+	}
+
+	if err := attachPostDetails(s.db, []*models.SocialMediaPost{&post}, userID); err != nil {
+		return nil, err
 	}
 
 	return &post, nil
@@ -265,11 +518,29 @@ func (s *SocialMediaService) CreateSocialMediaPost(post *models.SocialMediaPost,
 	// Set task ID and user ID
 	post.PostID = uuid.New().String()
 	post.UserID = userID
+	// Millisecond precision, as stored, so timeline entries match the post's cursor
+	post.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+	if err := attachMedia(s.db, post, userID); err != nil {
+		return nil, err
+	}
+
+	mentionedUserIDs, err := resolveMentions(s.db, post.PostText)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create task in database
-	result := s.db.Create(post)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to create task")
+	var newMentions []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(post).Error; err != nil {
+			return err
+		}
+		newMentions, err = syncPostEntities(tx, post, mentionedUserIDs)
+		return err
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to create task")
 		return nil, errors.New("failed to create task")
 	}
 
@@ -278,59 +549,363 @@ func (s *SocialMediaService) CreateSocialMediaPost(post *models.SocialMediaPost,
 		"user_id": userID,
 	}).Info("Post created")
 
+	s.timeline.FanOutPost(*post)
+	s.notifyMentions(post, newMentions)
+	s.stream.Broadcast(StreamEvent{Type: StreamEventPostCreated, Data: *post})
+
 	return post, nil
 }
 
-// UpdateSocialMediaPost updates an existing post
-func (s *SocialMediaService) UpdateSocialMediaPost(postID string, updatedSocialMediaPost *models.SocialMediaPost, userID string) (*models.SocialMediaPost, error) {
-	// Get existing task
+// PostUpdate holds the changes to a post
+type PostUpdate struct {
+	PostText string
+	// MediaID replaces the uploaded image of the post when set; null or empty removes it. Left
+	// unset, the post keeps its image, including a URL stored before uploads existed.
+	MediaID utils.Optional[string]
+}
+
+// UpdateSocialMediaPost updates an existing post. The author or a moderator may update it.
+func (s *SocialMediaService) UpdateSocialMediaPost(postID string, update PostUpdate, userID string, role string) (*models.SocialMediaPost, error) {
+	// Get existing post
 	var existingSocialMediaPost models.SocialMediaPost
-	result := s.db.Where("post_id = ? AND user_id = ?", postID, userID).First(&existingSocialMediaPost)
+	result := s.db.Where("post_id = ?", postID).First(&existingSocialMediaPost)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to get social media post for update")
-		return nil, errors.New("post not found")
+		return nil, ErrPostNotFound
+	}
+
+	if !canModify(existingSocialMediaPost.UserID, userID, role) {
+		s.logger.WithFields(logrus.Fields{
+			"post_id": postID,
+			"user_id": userID,
+		}).Warn("User is not allowed to update the post")
+		return nil, ErrPostForbidden
 	}
 
 	// Update post fields
-	existingSocialMediaPost.PostText = updatedSocialMediaPost.PostText
-	existingSocialMediaPost.PostImage = updatedSocialMediaPost.PostImage
+	existingSocialMediaPost.PostText = update.PostText
+	if update.MediaID.Set {
+		existingSocialMediaPost.MediaID = ""
+		if update.MediaID.Value != nil {
+			existingSocialMediaPost.MediaID = *update.MediaID.Value
+		}
+		if err := attachMedia(s.db, &existingSocialMediaPost, existingSocialMediaPost.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	mentionedUserIDs, err := resolveMentions(s.db, existingSocialMediaPost.PostText)
+	if err != nil {
+		return nil, err
+	}
 
 	// Save changes to database
-	result = s.db.Save(&existingSocialMediaPost)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to update social media post")
+	var newMentions []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingSocialMediaPost).Error; err != nil {
+			return err
+		}
+		if newMentions, err = syncPostEntities(tx, &existingSocialMediaPost, mentionedUserIDs); err != nil {
+			return err
+		}
+		return recordModerationAction(tx, userID, models.ModerationTargetPost, postID, existingSocialMediaPost.UserID, models.ModerationActionUpdate, "")
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to update social media post")
 		return nil, errors.New("failed to update social media post")
 	}
 
 	s.logger.WithFields(logrus.Fields{
 		"post_id": postID,
 		"user_id": userID,
-	}).Info("Task updated")
+	}).Info("Post updated")
+
+	// Only users added by the edit hear about it
+	s.notifyMentions(&existingSocialMediaPost, newMentions)
+
+	if err := attachPostDetails(s.db, []*models.SocialMediaPost{&existingSocialMediaPost}, userID); err != nil {
+		return nil, err
+	}
 
 	return &existingSocialMediaPost, nil
 }
 
-// DeleteSocialMediaPost deletes a post
-func (s *SocialMediaService) DeleteSocialMediaPost(postID string) error {
-	// Check if task exists and belongs to user
+// notifyMentions tells the users mentioned by the post; the actor is the post's author
+func (s *SocialMediaService) notifyMentions(post *models.SocialMediaPost, userIDs []string) {
+	for _, userID := range userIDs {
+		s.notifications.Notify(NotificationEvent{
+			RecipientID: userID,
+			ActorID:     post.UserID,
+			Type:        models.NotificationMention,
+			PostID:      post.PostID,
+		})
+	}
+}
+
+// DeleteSocialMediaPost moves a post and its comments and reactions to the trash. The author or a
+// moderator may delete it; a moderator removing someone else's post must give a reason, which is logged.
+func (s *SocialMediaService) DeleteSocialMediaPost(postID string, userID string, role string, reason string) error {
+	// Check if post exists
 	var post models.SocialMediaPost
 	result := s.db.Where("post_id = ?", postID).First(&post)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to get social media post for deletion")
-		return errors.New("post not found")
+		return ErrPostNotFound
 	}
 
-	// Delete post
-	result = s.db.Delete(&post)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to delete social media post")
+	if !canModify(post.UserID, userID, role) {
+		s.logger.WithFields(logrus.Fields{
+			"post_id": postID,
+			"user_id": userID,
+		}).Warn("User is not allowed to delete the post")
+		return ErrPostForbidden
+	}
+
+	reason = strings.TrimSpace(reason)
+	if post.UserID != userID && reason == "" {
+		return ErrModerationReasonRequired
+	}
+
+	// Soft delete the post and its children with the same timestamp so a restore
+	// brings back exactly what this delete removed
+	deletedAt := time.Now().Truncate(time.Millisecond)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := recordModerationAction(tx, userID, models.ModerationTargetPost, postID, post.UserID, models.ModerationActionDelete, reason); err != nil {
+			return err
+		}
+		if err := tx.Model(&post).Updates(map[string]any{"deleted_at": deletedAt, "deleted_by": userID}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.SocialMediaComments{}).Where("post_id = ?", postID).Update("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Reaction{}).Where("post_id = ?", postID).Update("deleted_at", deletedAt).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to delete social media post")
 		return errors.New("failed to delete social media post")
 	}
 
 	s.logger.WithFields(logrus.Fields{
 		"post_id": postID,
-		// "user_id": userID,
-	}).Info("Post deleted")
+		"user_id": userID,
+	}).Info("Post moved to trash")
 
 	return nil
 }
+
+// TrashedPost is a deleted post as shown in its author's trash
+type TrashedPost struct {
+	models.SocialMediaPost
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// GetTrashedSocialMediaPosts returns the posts the user deleted and can still restore, most recently deleted first.
+// Posts removed by a moderator are not listed.
+func (s *SocialMediaService) GetTrashedSocialMediaPosts(userID string, page int, pageSize int) (map[string]any, error) {
+	var posts []models.SocialMediaPost
+	var totalCount int64
+
+	// Defaults
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+
+	offset := (page - 1) * pageSize
+
+	query := s.db.Unscoped().Model(&models.SocialMediaPost{}).
+		Where("user_id = ? AND deleted_by = ? AND deleted_at IS NOT NULL", userID, userID)
+
+	// Count total
+	if err := query.Count(&totalCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count trashed posts")
+		return nil, err
+	}
+
+	// Fetch paginated posts
+	if err := query.
+		Order("deleted_at desc").
+		Limit(pageSize).
+		Offset(offset).
+		Find(&posts).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get trashed posts")
+		return nil, err
+	}
+
+	retention := s.trashRetention()
+	trashed := make([]TrashedPost, len(posts))
+	for i, post := range posts {
+		trashed[i] = TrashedPost{
+			SocialMediaPost: post,
+			DeletedAt:       post.DeletedAt.Time,
+			PurgeAt:         post.DeletedAt.Time.Add(retention),
+		}
+	}
+
+	totalPages := (totalCount + int64(pageSize) - 1) / int64(pageSize)
+
+	return map[string]any{
+		"posts":        trashed,
+		"total_count":  totalCount,
+		"current_page": page,
+		"total_pages":  totalPages,
+	}, nil
+}
+
+// RestoreSocialMediaPost brings a post back from the trash together with the comments and reactions
+// that were deleted with it. Authors can restore posts they deleted themselves; moderators can
+// restore any post.
+func (s *SocialMediaService) RestoreSocialMediaPost(postID string, userID string, role string) (*models.SocialMediaPost, error) {
+	var post models.SocialMediaPost
+	result := s.db.Unscoped().Where("post_id = ? AND deleted_at IS NOT NULL", postID).First(&post)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to get trashed social media post")
+		return nil, ErrPostNotFound
+	}
+
+	// Authors cannot undo a moderator's removal
+	if !(post.UserID == userID && post.DeletedBy == userID) && !models.CanModerate(role) {
+		s.logger.WithFields(logrus.Fields{
+			"post_id": postID,
+			"user_id": userID,
+		}).Warn("User is not allowed to restore the post")
+		return nil, ErrPostForbidden
+	}
+
+	deletedAt := post.DeletedAt.Time
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.SocialMediaComments{}).
+			Where("post_id = ? AND deleted_at = ?", postID, deletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Reaction{}).
+			Where("post_id = ? AND deleted_at = ?", postID, deletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&post).Updates(map[string]any{"deleted_at": nil, "deleted_by": ""}).Error; err != nil {
+			return err
+		}
+		return recordModerationAction(tx, userID, models.ModerationTargetPost, postID, post.UserID, models.ModerationActionRestore, "")
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to restore social media post")
+		return nil, errors.New("failed to restore social media post")
+	}
+
+	post.DeletedAt = gorm.DeletedAt{}
+	post.DeletedBy = ""
+
+	s.logger.WithFields(logrus.Fields{
+		"post_id": postID,
+		"user_id": userID,
+	}).Info("Post restored")
+
+	if err := attachPostDetails(s.db, []*models.SocialMediaPost{&post}, userID); err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+// PurgeTrash permanently removes posts, comments, reactions and notifications that were deleted before the cutoff
+func (s *SocialMediaService) PurgeTrash(cutoff time.Time) (int64, error) {
+	const batchSize = 500
+	var purged int64
+
+	for {
+		var postIDs []string
+		if err := s.db.Unscoped().Model(&models.SocialMediaPost{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Limit(batchSize).
+			Pluck("post_id", &postIDs).Error; err != nil {
+			return purged, err
+		}
+		if len(postIDs) == 0 {
+			break
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Where("post_id IN ?", postIDs).Delete(&models.Reaction{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("post_id IN ?", postIDs).Delete(&models.PostHashtag{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("post_id IN ?", postIDs).Delete(&models.PostMention{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("notification_id IN (?)", tx.Model(&models.Notification{}).
+				Select("notification_id").
+				Where("post_id IN ?", postIDs)).Delete(&models.NotificationActor{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("post_id IN ?", postIDs).Delete(&models.Notification{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("post_id IN ?", postIDs).Delete(&models.SocialMediaComments{}).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Where("post_id IN ?", postIDs).Delete(&models.SocialMediaPost{}).Error
+		})
+		if err != nil {
+			return purged, err
+		}
+
+		purged += int64(len(postIDs))
+		if len(postIDs) < batchSize {
+			break
+		}
+	}
+
+	// Comments deleted on their own, with their reactions
+	if err := s.db.Unscoped().
+		Where("comment_id IN (?)", s.db.Unscoped().Model(&models.SocialMediaComments{}).
+			Select("comment_id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff)).
+		Delete(&models.Reaction{}).Error; err != nil {
+		return purged, err
+	}
+	if err := s.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Delete(&models.SocialMediaComments{}).Error; err != nil {
+		return purged, err
+	}
+
+	return purged, nil
+}
+
+// StartTrashPurger purges trash older than the configured retention period until ctx is cancelled
+func (s *SocialMediaService) StartTrashPurger(ctx context.Context) {
+	interval := time.Duration(s.config.TrashPurgeIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeTrash(time.Now().Add(-s.trashRetention()))
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to purge trash")
+		} else if purged > 0 {
+			s.logger.WithField("count", purged).Info("Trashed posts purged")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// trashRetention is how long deleted posts stay in the trash
+func (s *SocialMediaService) trashRetention() time.Duration {
+	return time.Duration(s.config.TrashRetentionDays) * 24 * time.Hour
+}
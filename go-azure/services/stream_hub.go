@@ -0,0 +1,154 @@
+package services
+
+import (
+	"sync"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Types of the events pushed to connected clients
+const (
+	StreamEventPostCreated      = "post.created"
+	StreamEventPostReactions    = "post.reactions"
+	StreamEventCommentCreated   = "comment.created"
+	StreamEventNotification     = "notification"
+	StreamEventMessageCreated   = "message.created"
+	StreamEventConversationRead = "conversation.read"
+	StreamEventHeartbeat        = "heartbeat"
+)
+
+// streamBufferSize is how many events may wait for a slow connection before it is dropped
+const streamBufferSize = 64
+
+// StreamEvent is an event pushed to connected clients
+type StreamEvent struct {
+	Type string `json:"type"`
+	Data any    `json:"data,omitempty"`
+}
+
+// PostReactionsEvent carries the new reaction counts of a post. The viewer's own reaction
+// is left out because the event goes to everyone.
+type PostReactionsEvent struct {
+	PostID        string           `json:"post_id"`
+	Reactions     map[string]int64 `json:"reactions"`
+	ReactionCount int64            `json:"reaction_count"`
+	LikeCount     int64            `json:"like_count"`
+}
+
+// CommentCreatedEvent carries a new comment of a post
+type CommentCreatedEvent struct {
+	PostID  string                      `json:"post_id"`
+	Comment *models.SocialMediaComments `json:"comment"`
+}
+
+// NotificationEventData carries a new or updated notification and the recipient's unread count
+type NotificationEventData struct {
+	Notification models.Notification `json:"notification"`
+	UnreadCount  int64               `json:"unread_count"`
+}
+
+// StreamSubscription is one connection listening to the hub
+type StreamSubscription struct {
+	userID string
+	events chan StreamEvent
+}
+
+// Events returns the events for the connection. The channel is closed when the connection
+// falls too far behind or the hub shuts down; the client is expected to reconnect.
+func (sub *StreamSubscription) Events() <-chan StreamEvent {
+	return sub.events
+}
+
+// StreamHub is an in-process pub/sub hub fanning events out to connected clients.
+// Publishing never blocks: a connection whose buffer is full is dropped instead.
+type StreamHub struct {
+	logger *logrus.Logger
+
+	mu            sync.Mutex
+	subscriptions map[*StreamSubscription]struct{}
+	closed        bool
+}
+
+// NewStreamHub creates a new StreamHub
+func NewStreamHub() *StreamHub {
+	return &StreamHub{
+		logger:        utils.GetLogger(),
+		subscriptions: make(map[*StreamSubscription]struct{}),
+	}
+}
+
+// Subscribe registers a connection of the user. It returns nil once the hub is closed.
+func (h *StreamHub) Subscribe(userID string) *StreamSubscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	sub := &StreamSubscription{userID: userID, events: make(chan StreamEvent, streamBufferSize)}
+	h.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes a connection; unsubscribing twice has no effect
+func (h *StreamHub) Unsubscribe(sub *StreamSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(sub)
+}
+
+// Broadcast sends the event to every connection
+func (h *StreamHub) Broadcast(event StreamEvent) {
+	h.publish(event, func(*StreamSubscription) bool { return true })
+}
+
+// Publish sends the event to the connections of one user
+func (h *StreamHub) Publish(userID string, event StreamEvent) {
+	h.publish(event, func(sub *StreamSubscription) bool { return sub.userID == userID })
+}
+
+// Close drops every connection and refuses new ones. It is meant to run when the server shuts down.
+func (h *StreamHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscriptions {
+		h.remove(sub)
+	}
+}
+
+// publish sends the event to the matching connections without blocking
+func (h *StreamHub) publish(event StreamEvent, match func(*StreamSubscription) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscriptions {
+		if !match(sub) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			h.logger.WithFields(logrus.Fields{
+				"user_id": sub.userID,
+				"type":    event.Type,
+			}).Warn("Stream connection is too slow, dropping it")
+			h.remove(sub)
+		}
+	}
+}
+
+// remove forgets the connection and closes its channel. The caller holds h.mu.
+func (h *StreamHub) remove(sub *StreamSubscription) {
+	if _, ok := h.subscriptions[sub]; !ok {
+		return
+	}
+	delete(h.subscriptions, sub)
+	close(sub.events)
+}
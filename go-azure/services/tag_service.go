@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidTag is returned for an empty or overlong hashtag
+var ErrInvalidTag = errors.New("invalid hashtag")
+
+// maxTrendingWindow caps the window a client may ask trending tags for
+const maxTrendingWindow = 7 * 24 * time.Hour
+
+// TagService handles hashtag pages and trending tags
+type TagService struct {
+	config *config.Config
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewTagService creates a new TagService
+func NewTagService(config *config.Config) *TagService {
+	return &TagService{
+		config: config,
+		db:     utils.GetDB(),
+		logger: utils.GetLogger(),
+	}
+}
+
+// GetTagPosts returns the posts with a hashtag, newest first, using keyset pagination on (created_at, post_id)
+func (s *TagService) GetTagPosts(tag string, cursor string, limit int, viewerID string) (*PostFeedPage, error) {
+	var posts []models.SocialMediaPost
+
+	tag = utils.NormalizeHashtag(tag)
+	if tag == "" || len([]rune(tag)) > utils.MaxHashtagLength {
+		return nil, ErrInvalidTag
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	query := s.db.Model(&models.SocialMediaPost{}).
+		Select("social_media_posts.*").
+		Joins("JOIN post_hashtags ON post_hashtags.post_id = social_media_posts.post_id").
+		Where("post_hashtags.tag = ?", tag)
+
+	if cursor != "" {
+		position, err := utils.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("post_hashtags.created_at < ? OR (post_hashtags.created_at = ? AND post_hashtags.post_id < ?)",
+			position.CreatedAt, position.CreatedAt, position.ID)
+	}
+
+	hasMore, err := utils.FindPage(query.Order("post_hashtags.created_at desc, post_hashtags.post_id desc"), limit, &posts)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get tag posts")
+		return nil, err
+	}
+
+	page := &PostFeedPage{HasMore: hasMore}
+	if page.HasMore {
+		last := posts[len(posts)-1]
+		page.NextCursor = utils.EncodeCursor(last.CreatedAt, last.PostID)
+	}
+
+	if err := attachPostDetails(s.db, postPointers(posts), viewerID); err != nil {
+		return nil, err
+	}
+	page.Posts = posts
+
+	return page, nil
+}
+
+// GetTrendingTags returns the hashtags used by the most posts created within the window.
+// A zero window uses TRENDING_WINDOW_HOURS.
+func (s *TagService) GetTrendingTags(window time.Duration, limit int) ([]models.TrendingTag, error) {
+	tags := []models.TrendingTag{}
+
+	if window <= 0 {
+		window = time.Duration(s.config.TrendingWindowHours) * time.Hour
+	}
+	if window > maxTrendingWindow {
+		window = maxTrendingWindow
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 50 {
+		limit = 50
+	}
+
+	if err := s.db.Model(&models.PostHashtag{}).
+		Select("post_hashtags.tag, COUNT(*) AS post_count").
+		Joins("JOIN social_media_posts ON social_media_posts.post_id = post_hashtags.post_id AND social_media_posts.deleted_at IS NULL").
+		Where("post_hashtags.created_at >= ?", time.Now().Add(-window)).
+		Group("post_hashtags.tag").
+		Order("post_count desc, post_hashtags.tag asc").
+		Limit(limit).
+		Scan(&tags).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get trending tags")
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// resolveMentions maps the @handles in text to user IDs. Handles that do not belong to a user are
+// ignored, so text such as "@everyone" can still be posted.
+func resolveMentions(db *gorm.DB, text string) ([]string, error) {
+	handles := utils.ExtractMentions(text)
+	if len(handles) == 0 {
+		return nil, nil
+	}
+
+	var users []models.User
+	if err := db.Select("id, username").Where("username IN ?", handles).Find(&users).Error; err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to resolve mentions")
+		return nil, errors.New("failed to resolve mentions")
+	}
+
+	userIDs := make(map[string]string, len(users))
+	for _, user := range users {
+		userIDs[user.Username] = user.ID
+	}
+
+	mentioned := make([]string, 0, len(handles))
+	for _, handle := range handles {
+		if userID, ok := userIDs[handle]; ok {
+			mentioned = append(mentioned, userID)
+		}
+	}
+
+	return mentioned, nil
+}
+
+// syncPostEntities replaces the hashtags and mentions recorded for a post with the ones in its text.
+// It returns the users who were not mentioned by the post before.
+func syncPostEntities(tx *gorm.DB, post *models.SocialMediaPost, mentionedUserIDs []string) ([]string, error) {
+	var previousMentions []string
+	if err := tx.Model(&models.PostMention{}).Where("post_id = ?", post.PostID).Pluck("user_id", &previousMentions).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("post_id = ?", post.PostID).Delete(&models.PostHashtag{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("post_id = ?", post.PostID).Delete(&models.PostMention{}).Error; err != nil {
+		return nil, err
+	}
+
+	var hashtags []models.PostHashtag
+	for _, tag := range utils.ExtractHashtags(post.PostText) {
+		hashtags = append(hashtags, models.PostHashtag{Tag: tag, PostID: post.PostID, CreatedAt: post.CreatedAt})
+	}
+	if len(hashtags) > 0 {
+		if err := tx.Create(&hashtags).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var mentions []models.PostMention
+	var newMentions []string
+	for _, userID := range mentionedUserIDs {
+		mentions = append(mentions, models.PostMention{PostID: post.PostID, UserID: userID, CreatedAt: post.CreatedAt})
+		if !slices.Contains(previousMentions, userID) {
+			newMentions = append(newMentions, userID)
+		}
+	}
+	if len(mentions) > 0 {
+		if err := tx.Create(&mentions).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return newMentions, nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/testutil"
+	"go-azure/utils"
+
+	"gorm.io/gorm"
+)
+
+// mentionedUsers drains the queued notifications and returns the users told about a mention
+func mentionedUsers(notifications *NotificationService) []string {
+	var userIDs []string
+	for len(notifications.events) > 0 {
+		if event := <-notifications.events; event.Type == models.NotificationMention {
+			userIDs = append(userIDs, event.RecipientID)
+		}
+	}
+	return userIDs
+}
+
+// postTags returns the hashtags recorded for a post
+func postTags(t *testing.T, db *gorm.DB, postID string) []string {
+	t.Helper()
+
+	var tags []string
+	if err := db.Model(&models.PostHashtag{}).Where("post_id = ?", postID).Order("tag").Pluck("tag", &tags).Error; err != nil {
+		t.Fatal(err)
+	}
+	return tags
+}
+
+func TestPostMentionsAndHashtags(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	grace := testutil.CreateUser(t, db, "Grace")
+	bob := testutil.CreateUser(t, db, "Bob")
+	stream := NewStreamHub()
+	notifications := NewNotificationService(stream)
+	s := NewSocialMediaService(&config.Config{}, NewTimelineService(&config.Config{}), notifications, stream)
+
+	post, err := s.CreateSocialMediaPost(&models.SocialMediaPost{
+		PostText: "hi @" + grace.Username + " and @nobody #Go #go #azure",
+	}, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postTags(t, db, post.PostID); !slices.Equal(got, []string{"azure", "go"}) {
+		t.Errorf("tags = %v, want [azure go]", got)
+	}
+	if got := mentionedUsers(notifications); !slices.Equal(got, []string{grace.ID}) {
+		t.Errorf("mention notifications for %v, want Grace only", got)
+	}
+
+	// Only users added by an edit hear about it, and dropped tags are removed
+	if _, err := s.UpdateSocialMediaPost(post.PostID, PostUpdate{
+		PostText: "hi @" + grace.Username + " and @" + bob.Username + " #go",
+	}, ada.ID, models.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	if got := postTags(t, db, post.PostID); !slices.Equal(got, []string{"go"}) {
+		t.Errorf("tags after the edit = %v, want [go]", got)
+	}
+	if got := mentionedUsers(notifications); !slices.Equal(got, []string{bob.ID}) {
+		t.Errorf("mention notifications after the edit for %v, want Bob only", got)
+	}
+	var mentioned []string
+	if err := db.Model(&models.PostMention{}).Where("post_id = ?", post.PostID).Pluck("user_id", &mentioned).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(mentioned) != 2 || !slices.Contains(mentioned, grace.ID) || !slices.Contains(mentioned, bob.ID) {
+		t.Errorf("mentions = %v, want Grace and Bob", mentioned)
+	}
+}
+
+func TestTagPages(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	stream := NewStreamHub()
+	s := NewSocialMediaService(&config.Config{}, NewTimelineService(&config.Config{}), NewNotificationService(stream), stream)
+	tags := NewTagService(&config.Config{TrendingWindowHours: 24})
+
+	var goPosts []*models.SocialMediaPost
+	for _, text := range []string{"#go one", "#go #azure two", "#azure three"} {
+		post, err := s.CreateSocialMediaPost(&models.SocialMediaPost{PostText: text}, ada.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.Contains(postTags(t, db, post.PostID), "go") {
+			goPosts = append(goPosts, post)
+		}
+		// Tag pages are ordered by the posts' millisecond timestamps
+		time.Sleep(2 * time.Millisecond)
+	}
+	// The "#azure three" post no longer counts once it is deleted
+	if err := db.Where("post_text = ?", "#azure three").Delete(&models.SocialMediaPost{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := tags.GetTagPosts("#GO", "", 1, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].PostID != goPosts[1].PostID || !page.HasMore {
+		t.Fatalf("first page = %d posts, more %v; want the newest #go post", len(page.Posts), page.HasMore)
+	}
+	page, err = tags.GetTagPosts("go", page.NextCursor, 1, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].PostID != goPosts[0].PostID || page.HasMore {
+		t.Errorf("second page = %d posts, more %v; want the oldest #go post", len(page.Posts), page.HasMore)
+	}
+
+	for _, tag := range []string{"", "#", strings.Repeat("a", utils.MaxHashtagLength+1)} {
+		if _, err := tags.GetTagPosts(tag, "", 10, ada.ID); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("GetTagPosts(%q) = %v, want %v", tag, err, ErrInvalidTag)
+		}
+	}
+
+	trending, err := tags.GetTrendingTags(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.TrendingTag{{Tag: "go", PostCount: 2}, {Tag: "azure", PostCount: 1}}
+	if !slices.Equal(trending, want) {
+		t.Errorf("trending = %v, want %v", trending, want)
+	}
+}
@@ -2,14 +2,63 @@ package services
 
 import (
 	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"go-azure/models"
 	"go-azure/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	// ErrTaskNotFound is returned when a user has no task with the ID
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrInvalidTaskTitle is returned for an empty or overlong task title
+	ErrInvalidTaskTitle = errors.New("title must be between 1 and 255 characters")
+	// ErrInvalidPriority is returned for a priority that is not one of the known ones
+	ErrInvalidPriority = errors.New("priority must be one of low, medium, high, urgent")
+	// ErrInvalidLabels is returned for too many labels, or an empty or overlong one
+	ErrInvalidLabels = errors.New("a task can have at most 20 labels of 1 to 50 characters")
+	// ErrInvalidPosition is returned for a negative position
+	ErrInvalidPosition = errors.New("position must not be negative")
+	// ErrInvalidParentTask is returned when the parent of a subtask is not one of the user's
+	// top-level tasks
+	ErrInvalidParentTask = errors.New("parent task must be another of your tasks that is not a subtask")
+	// ErrTaskHasSubtasks is returned when a task with subtasks would become a subtask
+	ErrTaskHasSubtasks = errors.New("a task with subtasks cannot become a subtask")
+	// ErrSubtasksIncomplete is returned when completing a task whose subtasks are not all completed
+	ErrSubtasksIncomplete = errors.New("task has incomplete subtasks")
+)
+
+const (
+	// maxTaskTitleLength is the longest title a task can have
+	maxTaskTitleLength = 255
+	// MaxTaskLabels is how many labels a task can have
+	MaxTaskLabels = 20
+	// maxTaskLabelLength is the longest label a task can have
+	maxTaskLabelLength = 50
+)
+
+// TaskUpdate holds the task fields to change. Nil and unset fields are left as they are; DueDate
+// and ParentTaskID are cleared when set to null.
+type TaskUpdate struct {
+	Title        *string
+	Description  *string
+	Completed    *bool
+	Priority     *string
+	Position     *int
+	Labels       *[]string
+	DueDate      utils.Optional[time.Time]
+	ParentTaskID utils.Optional[string]
+	// CompleteSubtasks completes the incomplete subtasks of a task being completed, which is
+	// refused otherwise
+	CompleteSubtasks bool
+}
+
 // TaskService handles task operations
 type TaskService struct {
 	db     *gorm.DB
@@ -24,42 +73,111 @@ func NewTaskService() *TaskService {
 	}
 }
 
-// GetAllTasks returns all tasks for a user
+// GetAllTasks returns the top-level tasks of a user in order, each with its subtasks
 func (s *TaskService) GetAllTasks(userID string) []*models.Task {
 	var tasks []*models.Task
 
-	result := s.db.Where("user_id = ?", userID).Find(&tasks)
+	result := s.db.Where("user_id = ?", userID).Order("position, created_at").Find(&tasks)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to get tasks")
 		return []*models.Task{}
 	}
 
-	return tasks
+	parents := make(map[string]*models.Task, len(tasks))
+	for _, task := range tasks {
+		if task.ParentTaskID == nil {
+			parents[task.ID] = task
+		}
+	}
+	topLevel := []*models.Task{}
+	for _, task := range tasks {
+		if task.ParentTaskID != nil {
+			if parent, ok := parents[*task.ParentTaskID]; ok {
+				parent.Subtasks = append(parent.Subtasks, task)
+				continue
+			}
+		}
+		topLevel = append(topLevel, task)
+	}
+
+	return topLevel
 }
 
-// GetTaskByID returns a task by ID
+// GetTaskByID returns a task by ID, with its subtasks
 func (s *TaskService) GetTaskByID(taskID string, userID string) (*models.Task, error) {
 	var task models.Task
 
 	result := s.db.Where("id = ? AND user_id = ?", taskID, userID).First(&task)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrTaskNotFound
+		}
 		s.logger.WithError(result.Error).Error("Failed to get task")
-		return nil, errors.New("task not found")
+		return nil, errors.New("failed to get task")
+	}
+
+	if task.ParentTaskID == nil {
+		if err := s.db.Where("parent_task_id = ?", task.ID).Order("position, created_at").Find(&task.Subtasks).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to get subtasks")
+			return nil, errors.New("failed to get task")
+		}
 	}
 
 	return &task, nil
 }
 
-// CreateTask creates a new task
+// CreateTask creates a new task at the end of its list: the user's top-level tasks, or the
+// subtasks of its parent. An incomplete subtask reopens its parent.
 func (s *TaskService) CreateTask(task *models.Task, userID string) (*models.Task, error) {
 	// Set task ID and user ID
 	task.ID = uuid.New().String()
 	task.UserID = userID
+	task.Subtasks = nil
+
+	title, err := validateTaskTitle(task.Title)
+	if err != nil {
+		return nil, err
+	}
+	task.Title = title
+	if task.Priority == "" {
+		task.Priority = models.PriorityMedium
+	} else if !models.IsValidPriority(task.Priority) {
+		return nil, ErrInvalidPriority
+	}
+	if task.Labels, err = normalizeLabels(task.Labels); err != nil {
+		return nil, err
+	}
+	if task.ParentTaskID != nil && *task.ParentTaskID == "" {
+		task.ParentTaskID = nil
+	}
 
 	// Create task in database
-	result := s.db.Create(task)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to create task")
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user's tasks so concurrent creates do not take the same position
+		if err := lockUserTasks(tx, userID); err != nil {
+			return err
+		}
+		parent, err := taskListParent(tx, userID, task.ParentTaskID, task.ID)
+		if err != nil {
+			return err
+		}
+		if err := reopenParentTask(tx, parent, task.Completed); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := siblingTasks(tx, userID, task.ParentTaskID).Count(&count).Error; err != nil {
+			return err
+		}
+		task.Position = int(count)
+
+		return tx.Create(task).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidParentTask) {
+			return nil, err
+		}
+		s.logger.WithError(err).Error("Failed to create task")
 		return nil, errors.New("failed to create task")
 	}
 
@@ -71,25 +189,127 @@ func (s *TaskService) CreateTask(task *models.Task, userID string) (*models.Task
 	return task, nil
 }
 
-// UpdateTask updates an existing task
-func (s *TaskService) UpdateTask(taskID string, updatedTask *models.Task, userID string) (*models.Task, error) {
-	// Get existing task
-	var existingTask models.Task
-	result := s.db.Where("id = ? AND user_id = ?", taskID, userID).First(&existingTask)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to get task for update")
-		return nil, errors.New("task not found")
+// UpdateTask changes the fields of an existing task that are set in update. Moving a task to
+// another parent or position reorders the tasks around it. A subtask that is incomplete after
+// the update reopens its parent.
+func (s *TaskService) UpdateTask(taskID string, update TaskUpdate, userID string) (*models.Task, error) {
+	updates := map[string]any{}
+
+	if update.Title != nil {
+		title, err := validateTaskTitle(*update.Title)
+		if err != nil {
+			return nil, err
+		}
+		updates["title"] = title
+	}
+	if update.Description != nil {
+		updates["description"] = *update.Description
+	}
+	if update.Priority != nil {
+		if !models.IsValidPriority(*update.Priority) {
+			return nil, ErrInvalidPriority
+		}
+		updates["priority"] = *update.Priority
+	}
+	if update.Labels != nil {
+		labels, err := normalizeLabels(*update.Labels)
+		if err != nil {
+			return nil, err
+		}
+		updates["labels"] = labels
+	}
+	if update.DueDate.Set {
+		updates["due_date"] = update.DueDate.Value
+	}
+	if update.Position != nil && *update.Position < 0 {
+		return nil, ErrInvalidPosition
 	}
 
-	// Update task fields
-	existingTask.Title = updatedTask.Title
-	existingTask.Description = updatedTask.Description
-	existingTask.Completed = updatedTask.Completed
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user's tasks so concurrent moves do not interleave their reordering
+		if err := lockUserTasks(tx, userID); err != nil {
+			return err
+		}
+		var task models.Task
+		result := tx.Where("id = ? AND user_id = ?", taskID, userID).First(&task)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrTaskNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
 
-	// Save changes to database
-	result = s.db.Save(&existingTask)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to update task")
+		parentTaskID := task.ParentTaskID
+		if update.ParentTaskID.Set {
+			parentTaskID = update.ParentTaskID.Value
+			if parentTaskID != nil && *parentTaskID == "" {
+				parentTaskID = nil
+			}
+		}
+		moved := !sameParentTask(task.ParentTaskID, parentTaskID)
+		completed := task.Completed
+		if update.Completed != nil {
+			completed = *update.Completed
+		}
+
+		// The parent of a subtask that is incomplete after the update may have to be reopened
+		parent, err := taskListParent(tx, userID, parentTaskID, task.ID)
+		if err != nil {
+			return err
+		}
+		if err := reopenParentTask(tx, parent, completed); err != nil {
+			return err
+		}
+		if moved && parent != nil {
+			var subtasks int64
+			if err := tx.Model(&models.Task{}).Where("parent_task_id = ?", task.ID).Count(&subtasks).Error; err != nil {
+				return err
+			}
+			if subtasks > 0 {
+				return ErrTaskHasSubtasks
+			}
+		}
+
+		if update.Completed != nil {
+			if *update.Completed && !task.Completed {
+				var count int64
+				if err := tx.Model(&models.Task{}).Where("parent_task_id = ? AND completed = ?", task.ID, false).Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					if !update.CompleteSubtasks {
+						return ErrSubtasksIncomplete
+					}
+					if err := tx.Model(&models.Task{}).Where("parent_task_id = ? AND completed = ?", task.ID, false).
+						Update("completed", true).Error; err != nil {
+						return err
+					}
+				}
+			}
+			updates["completed"] = *update.Completed
+		}
+
+		if moved || update.Position != nil {
+			position, err := moveTask(tx, &task, parentTaskID, update.Position)
+			if err != nil {
+				return err
+			}
+			updates["parent_task_id"] = parentTaskID
+			updates["position"] = position
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&task).Updates(updates).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTaskNotFound), errors.Is(err, ErrInvalidParentTask),
+			errors.Is(err, ErrTaskHasSubtasks), errors.Is(err, ErrSubtasksIncomplete):
+			return nil, err
+		}
+		s.logger.WithError(err).Error("Failed to update task")
 		return nil, errors.New("failed to update task")
 	}
 
@@ -98,23 +318,45 @@ func (s *TaskService) UpdateTask(taskID string, updatedTask *models.Task, userID
 		"user_id": userID,
 	}).Info("Task updated")
 
-	return &existingTask, nil
+	return s.GetTaskByID(taskID, userID)
 }
 
-// DeleteTask deletes a task
+// DeleteTask deletes a task along with its subtasks
 func (s *TaskService) DeleteTask(taskID string, userID string) error {
-	// Check if task exists and belongs to user
-	var task models.Task
-	result := s.db.Where("id = ? AND user_id = ?", taskID, userID).First(&task)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to get task for deletion")
-		return errors.New("task not found")
-	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user's tasks so concurrent changes do not take the positions being closed up
+		if err := lockUserTasks(tx, userID); err != nil {
+			return err
+		}
 
-	// Delete task
-	result = s.db.Delete(&task)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to delete task")
+		// Check if task exists and belongs to user
+		var task models.Task
+		result := tx.Where("id = ? AND user_id = ?", taskID, userID).First(&task)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrTaskNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// Delete task and subtasks
+		if err := tx.Where("parent_task_id = ?", task.ID).Delete(&models.Task{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&task).Error; err != nil {
+			return err
+		}
+
+		// Close the gap the task leaves in its list
+		return siblingTasks(tx, userID, task.ParentTaskID).
+			Where("position > ?", task.Position).
+			UpdateColumn("position", gorm.Expr("position - 1")).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrTaskNotFound) {
+			return err
+		}
+		s.logger.WithError(err).Error("Failed to delete task")
 		return errors.New("failed to delete task")
 	}
 
@@ -125,3 +367,133 @@ func (s *TaskService) DeleteTask(taskID string, userID string) error {
 
 	return nil
 }
+
+// moveTask makes room for the task at position among the tasks with the parent, at the end when
+// position is nil or past it, and returns the position the task moves to
+func moveTask(tx *gorm.DB, task *models.Task, parentTaskID *string, position *int) (int, error) {
+	sameList := sameParentTask(task.ParentTaskID, parentTaskID)
+	if !sameList {
+		// Close the gap the task leaves in its old list
+		if err := siblingTasks(tx, task.UserID, task.ParentTaskID).
+			Where("position > ?", task.Position).
+			UpdateColumn("position", gorm.Expr("position - 1")).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	var count int64
+	if err := siblingTasks(tx, task.UserID, parentTaskID).Where("id <> ?", task.ID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	target := int(count)
+	if position != nil && *position < target {
+		target = *position
+	}
+
+	others := siblingTasks(tx, task.UserID, parentTaskID).Where("id <> ?", task.ID)
+	var err error
+	switch {
+	case !sameList:
+		err = others.Where("position >= ?", target).UpdateColumn("position", gorm.Expr("position + 1")).Error
+	case target < task.Position:
+		err = others.Where("position >= ? AND position < ?", target, task.Position).UpdateColumn("position", gorm.Expr("position + 1")).Error
+	case target > task.Position:
+		err = others.Where("position > ? AND position <= ?", task.Position, target).UpdateColumn("position", gorm.Expr("position - 1")).Error
+	}
+	if err != nil {
+		return 0, err
+	}
+	return target, nil
+}
+
+// siblingTasks scopes a query to the user's tasks with the parent, or to their top-level tasks
+func siblingTasks(tx *gorm.DB, userID string, parentTaskID *string) *gorm.DB {
+	query := tx.Model(&models.Task{}).Where("user_id = ?", userID)
+	if parentTaskID == nil {
+		return query.Where("parent_task_id IS NULL")
+	}
+	return query.Where("parent_task_id = ?", *parentTaskID)
+}
+
+// lockUserTasks locks the user's row, which every change to their tasks takes before reading or
+// writing any task. Changes to one user's tasks are serialized, so positions are never counted
+// twice and task rows are never locked in conflicting orders, for example by an update of a
+// subtask and the deletion of its parent.
+func lockUserTasks(tx *gorm.DB, userID string) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", userID).First(&models.User{}).Error
+}
+
+// taskListParent returns the parent of a list of the user's tasks, nil for their top-level tasks.
+// The parent must be one of the user's top-level tasks other than the task itself, otherwise
+// ErrInvalidParentTask is returned.
+func taskListParent(tx *gorm.DB, userID string, parentTaskID *string, taskID string) (*models.Task, error) {
+	if parentTaskID == nil {
+		return nil, nil
+	}
+	if *parentTaskID == taskID {
+		return nil, ErrInvalidParentTask
+	}
+
+	var parent models.Task
+	if err := tx.Where("id = ? AND user_id = ?", *parentTaskID, userID).First(&parent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidParentTask
+		}
+		return nil, err
+	}
+	if parent.ParentTaskID != nil {
+		return nil, ErrInvalidParentTask
+	}
+	return &parent, nil
+}
+
+// reopenParentTask marks a completed parent incomplete when it gets an incomplete subtask, so a
+// completed task never has incomplete subtasks
+func reopenParentTask(tx *gorm.DB, parent *models.Task, subtaskCompleted bool) error {
+	if parent == nil || !parent.Completed || subtaskCompleted {
+		return nil
+	}
+	if err := tx.Model(parent).Update("completed", false).Error; err != nil {
+		return err
+	}
+	parent.Completed = false
+	return nil
+}
+
+// sameParentTask reports whether two parent task IDs are the same, nil for top-level tasks
+func sameParentTask(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// validateTaskTitle trims a task title and checks its length
+func validateTaskTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" || utf8.RuneCountInString(title) > maxTaskTitleLength {
+		return "", ErrInvalidTaskTitle
+	}
+	return title, nil
+}
+
+// normalizeLabels trims labels and drops duplicates, keeping their order
+func normalizeLabels(labels []string) (models.Labels, error) {
+	normalized := models.Labels{}
+	seen := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" || utf8.RuneCountInString(label) > maxTaskLabelLength {
+			return nil, ErrInvalidLabels
+		}
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		normalized = append(normalized, label)
+	}
+	if len(normalized) > MaxTaskLabels {
+		return nil, ErrInvalidLabels
+	}
+	return normalized, nil
+}
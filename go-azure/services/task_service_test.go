@@ -0,0 +1,235 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"go-azure/models"
+	"go-azure/testutil"
+	"go-azure/utils"
+)
+
+func TestUpdateSubtaskWhileDeletingParent(t *testing.T) {
+	db := testutil.OpenDB(t)
+	user := testutil.CreateUser(t, db, "Ada Lovelace")
+	service := NewTaskService()
+
+	for range 20 {
+		parent, err := service.CreateTask(&models.Task{Title: "parent", Completed: true}, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subtask, err := service.CreateTask(&models.Task{Title: "subtask", Completed: true, ParentTaskID: &parent.ID}, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Reopening the subtask reads its parent, which the delete removes with the subtask. On
+		// MySQL both lock the user's row first; sqlite serializes them on its one connection.
+		var wg sync.WaitGroup
+		var updateErr, deleteErr error
+		reopened := false
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, updateErr = service.UpdateTask(subtask.ID, TaskUpdate{Completed: &reopened}, user.ID)
+		}()
+		go func() {
+			defer wg.Done()
+			deleteErr = service.DeleteTask(parent.ID, user.ID)
+		}()
+		wg.Wait()
+
+		if updateErr != nil && !errors.Is(updateErr, ErrTaskNotFound) {
+			t.Fatalf("UpdateTask: %v", updateErr)
+		}
+		if deleteErr != nil {
+			t.Fatalf("DeleteTask: %v", deleteErr)
+		}
+		if tasks := service.GetAllTasks(user.ID); len(tasks) != 0 {
+			t.Fatalf("tasks left after deleting the parent: %+v", tasks)
+		}
+	}
+}
+
+// createTasks creates top-level tasks with the titles, in order
+func createTasks(t *testing.T, service *TaskService, userID string, titles ...string) map[string]*models.Task {
+	t.Helper()
+
+	tasks := make(map[string]*models.Task, len(titles))
+	for _, title := range titles {
+		task, err := service.CreateTask(&models.Task{Title: title}, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tasks[title] = task
+	}
+	return tasks
+}
+
+// taskTitles returns the titles of the user's top-level tasks in order, checking that their
+// positions count up from 0
+func taskTitles(t *testing.T, service *TaskService, userID string) []string {
+	t.Helper()
+
+	var titles []string
+	for i, task := range service.GetAllTasks(userID) {
+		if task.Position != i {
+			t.Errorf("task %q at position %d, want %d", task.Title, task.Position, i)
+		}
+		titles = append(titles, task.Title)
+	}
+	return titles
+}
+
+func TestTasksOfOtherUsersCannotBeChanged(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	grace := testutil.CreateUser(t, db, "Grace")
+	service := NewTaskService()
+
+	adas := createTasks(t, service, ada.ID, "a", "b")
+	graces := createTasks(t, service, grace.ID, "g")
+	first := 0
+	title := "taken"
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{name: "get", want: ErrTaskNotFound, call: func() error {
+			_, err := service.GetTaskByID(adas["b"].ID, grace.ID)
+			return err
+		}},
+		{name: "move", want: ErrTaskNotFound, call: func() error {
+			_, err := service.UpdateTask(adas["b"].ID, TaskUpdate{Position: &first}, grace.ID)
+			return err
+		}},
+		{name: "rename", want: ErrTaskNotFound, call: func() error {
+			_, err := service.UpdateTask(adas["b"].ID, TaskUpdate{Title: &title}, grace.ID)
+			return err
+		}},
+		{name: "delete", want: ErrTaskNotFound, call: func() error {
+			return service.DeleteTask(adas["a"].ID, grace.ID)
+		}},
+		{name: "create a subtask", want: ErrInvalidParentTask, call: func() error {
+			_, err := service.CreateTask(&models.Task{Title: "sub", ParentTaskID: &adas["a"].ID}, grace.ID)
+			return err
+		}},
+		{name: "move own task under it", want: ErrInvalidParentTask, call: func() error {
+			_, err := service.UpdateTask(graces["g"].ID, TaskUpdate{ParentTaskID: utils.Optional[string]{Set: true, Value: &adas["a"].ID}}, grace.ID)
+			return err
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(); !errors.Is(err, test.want) {
+				t.Errorf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	if titles := taskTitles(t, service, ada.ID); !slices.Equal(titles, []string{"a", "b"}) {
+		t.Errorf("Ada's tasks = %v, want [a b]", titles)
+	}
+}
+
+func TestUpdateTaskReorders(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	service := NewTaskService()
+	tasks := createTasks(t, service, ada.ID, "a", "b", "c", "d")
+
+	tests := []struct {
+		title    string
+		position int
+		want     []string
+	}{
+		{title: "d", position: 0, want: []string{"d", "a", "b", "c"}},
+		{title: "d", position: 2, want: []string{"a", "b", "d", "c"}},
+		{title: "a", position: 99, want: []string{"b", "d", "c", "a"}},
+		{title: "c", position: 2, want: []string{"b", "d", "c", "a"}},
+	}
+	for _, test := range tests {
+		position := test.position
+		if _, err := service.UpdateTask(tasks[test.title].ID, TaskUpdate{Position: &position}, ada.ID); err != nil {
+			t.Fatal(err)
+		}
+		if titles := taskTitles(t, service, ada.ID); !slices.Equal(titles, test.want) {
+			t.Errorf("after moving %s to %d: %v, want %v", test.title, test.position, titles, test.want)
+		}
+	}
+
+	if err := service.DeleteTask(tasks["d"].ID, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+	if titles := taskTitles(t, service, ada.ID); !slices.Equal(titles, []string{"b", "c", "a"}) {
+		t.Errorf("after deleting d: %v, want [b c a]", titles)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	service := NewTaskService()
+	tasks := createTasks(t, service, ada.ID, "parent", "other")
+	parentID := tasks["parent"].ID
+	for _, title := range []string{"one", "two"} {
+		if _, err := service.CreateTask(&models.Task{Title: title, ParentTaskID: &parentID}, ada.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	completed := true
+	if _, err := service.UpdateTask(parentID, TaskUpdate{Completed: &completed}, ada.ID); !errors.Is(err, ErrSubtasksIncomplete) {
+		t.Fatalf("completing with incomplete subtasks = %v, want %v", err, ErrSubtasksIncomplete)
+	}
+	parent, err := service.UpdateTask(parentID, TaskUpdate{Completed: &completed, CompleteSubtasks: true}, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subtask := range parent.Subtasks {
+		if !subtask.Completed {
+			t.Errorf("subtask %q was not completed with its parent", subtask.Title)
+		}
+	}
+
+	// An incomplete subtask reopens its parent
+	if _, err := service.CreateTask(&models.Task{Title: "three", ParentTaskID: &parentID}, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+	parent, err = service.GetTaskByID(parentID, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.Completed {
+		t.Error("parent stayed completed after adding an incomplete subtask")
+	}
+	if len(parent.Subtasks) != 3 || parent.Subtasks[2].Position != 2 {
+		t.Errorf("subtasks = %+v, want three with the new one last", parent.Subtasks)
+	}
+
+	// Tasks with subtasks cannot become subtasks themselves
+	otherID := tasks["other"].ID
+	if _, err := service.UpdateTask(parentID, TaskUpdate{ParentTaskID: utils.Optional[string]{Set: true, Value: &otherID}}, ada.ID); !errors.Is(err, ErrTaskHasSubtasks) {
+		t.Errorf("nesting a task with subtasks = %v, want %v", err, ErrTaskHasSubtasks)
+	}
+
+	// Deleting the parent deletes its subtasks
+	if err := service.DeleteTask(parentID, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+	var left int64
+	if err := db.Model(&models.Task{}).Where("parent_task_id = ?", parentID).Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d subtasks left after deleting their parent", left)
+	}
+	if titles := taskTitles(t, service, ada.ID); !slices.Equal(titles, []string{"other"}) {
+		t.Errorf("tasks = %v, want [other]", titles)
+	}
+}
@@ -0,0 +1,703 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// celebritiesKey is a sorted set of authors that are not fanned out, scored by follower count
+	celebritiesKey = "timeline:celebrities"
+	// fanOutBatchSize is how many followers are loaded at a time when fanning out a post
+	fanOutBatchSize = 1000
+	// maxTimelineReads bounds how often a page read is retried when its posts were deleted
+	maxTimelineReads = 5
+	// fanOutQueueSize is how many posts and rebuilds can wait for the fan-out worker
+	fanOutQueueSize = 1000
+	// timelineBuildMargin is how far before a timeline build began posts are read again once it
+	// is built, catching posts saved while it was built that were not fanned out to it
+	timelineBuildMargin = time.Minute
+)
+
+// TimelineService materializes home timelines. New posts are written to the timeline of each
+// follower (fan-out-on-write) so reading a page only touches the posts on that page. Posts of
+// authors with at least TimelineCelebrityFollowers followers are not fanned out; they are
+// merged in from the posts table when a timeline is read (fan-out-on-read). Timelines nobody
+// reads for TimelineTTLHours expire and are not fanned out to in the meantime.
+type TimelineService struct {
+	config *config.Config
+	db     *gorm.DB
+	cache  utils.Cache
+	logger *logrus.Logger
+	ttl    time.Duration
+
+	// Work waiting for the fan-out worker
+	jobs chan timelineJob
+}
+
+// NewTimelineService creates a new TimelineService
+func NewTimelineService(config *config.Config) *TimelineService {
+	ttl := time.Duration(config.TimelineTTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	return &TimelineService{
+		config: config,
+		db:     utils.GetDB(),
+		cache:  utils.GetCache(),
+		logger: utils.GetLogger(),
+		ttl:    ttl,
+		jobs:   make(chan timelineJob, fanOutQueueSize),
+	}
+}
+
+// timelineJob is work for the fan-out worker: a new post to fan out, or an author whose
+// followers' timelines must be rebuilt
+type timelineJob struct {
+	post               *models.SocialMediaPost
+	rebuildFollowersOf string
+}
+
+// timelineEntry is a post reference stored in a timeline
+type timelineEntry struct {
+	PostID    string
+	CreatedAt int64 // unix milliseconds
+}
+
+// before reports whether the entry sorts after position in a newest-first timeline
+func (e timelineEntry) before(position *utils.Cursor) bool {
+	createdAt := position.CreatedAt.UnixMilli()
+	return e.CreatedAt < createdAt || (e.CreatedAt == createdAt && e.PostID < position.ID)
+}
+
+// timelineKey is the sorted set holding a user's timeline, scored by post creation time
+func timelineKey(userID string) string {
+	return "timeline:" + userID
+}
+
+// timelineBuiltKey marks a timeline as fully built from the database
+func timelineBuiltKey(userID string) string {
+	return "timeline:" + userID + ":built"
+}
+
+// LoadCelebrities fills the celebrity set from the follows table. It runs once at startup;
+// FollowService keeps the set up to date afterwards.
+func (s *TimelineService) LoadCelebrities() error {
+	var rows []struct {
+		FolloweeID string
+		Total      int64
+	}
+	if err := s.db.Model(&models.Follow{}).
+		Select("followee_id, COUNT(*) AS total").
+		Group("followee_id").
+		Having("COUNT(*) >= ?", s.config.TimelineCelebrityFollowers).
+		Scan(&rows).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to load celebrities")
+		return errors.New("failed to load celebrities")
+	}
+
+	ctx := context.Background()
+	if err := s.cache.Del(ctx, celebritiesKey); err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	members := make([]utils.Z, 0, len(rows))
+	for _, row := range rows {
+		members = append(members, utils.Z{Score: float64(row.Total), Member: row.FolloweeID})
+	}
+	if err := s.cache.ZAdd(ctx, celebritiesKey, members...); err != nil {
+		return err
+	}
+
+	s.logger.WithField("count", len(rows)).Info("Celebrities loaded")
+	return nil
+}
+
+// FollowersChanged records the new follower count of a user and drops the follower's timeline
+// so it is rebuilt with or without the followee's posts on the next read. When the followee stops
+// being a celebrity, the timelines of all their followers are rebuilt, since their recent posts
+// were merged in at read time and are missing from those timelines.
+func (s *TimelineService) FollowersChanged(followerID string, followeeID string, followersCount int64) {
+	ctx := context.Background()
+
+	var err error
+	if followersCount >= int64(s.config.TimelineCelebrityFollowers) {
+		err = s.cache.ZAdd(ctx, celebritiesKey, utils.Z{Score: float64(followersCount), Member: followeeID})
+	} else {
+		var wasCelebrity bool
+		wasCelebrity, err = s.isCelebrity(ctx, followeeID)
+		if err == nil {
+			err = s.cache.ZRem(ctx, celebritiesKey, followeeID)
+		}
+		if err == nil && wasCelebrity {
+			s.enqueue(timelineJob{rebuildFollowersOf: followeeID})
+		}
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to update celebrities")
+	}
+
+	s.invalidate(ctx, followerID)
+}
+
+// FanOutPost queues a new post for the fan-out worker and returns immediately. Posts are dropped
+// from timelines when the queue is full; they are back once those timelines are rebuilt.
+func (s *TimelineService) FanOutPost(post models.SocialMediaPost) {
+	s.enqueue(timelineJob{post: &post})
+}
+
+// enqueue queues work for the fan-out worker unless the queue is full
+func (s *TimelineService) enqueue(job timelineJob) {
+	select {
+	case s.jobs <- job:
+	default:
+		entry := s.logger.WithField("user_id", job.rebuildFollowersOf)
+		if job.post != nil {
+			entry = s.logger.WithFields(logrus.Fields{"post_id": job.post.PostID, "user_id": job.post.UserID})
+		}
+		entry.Error("Timeline queue is full, dropping fan-out")
+	}
+}
+
+// StartFanOutWorker fans out queued posts and rebuilds queued timelines until ctx is cancelled.
+// Jobs are handled one at a time, so a burst of posts cannot flood the cache or the database.
+func (s *TimelineService) StartFanOutWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.jobs:
+			if job.post != nil {
+				s.fanOut(*job.post)
+			} else {
+				s.invalidateFollowers(job.rebuildFollowersOf)
+			}
+		}
+	}
+}
+
+// fanOut adds a new post to the timelines of its author and, unless the author is a celebrity,
+// of every follower
+func (s *TimelineService) fanOut(post models.SocialMediaPost) {
+	ctx := context.Background()
+	entry := utils.Z{Score: float64(post.CreatedAt.UnixMilli()), Member: post.PostID}
+
+	s.pushBuilt(ctx, post.UserID, entry)
+
+	celebrity, err := s.isCelebrity(ctx, post.UserID)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to check celebrity")
+	}
+	if celebrity {
+		// Followers read these posts from the database instead
+		return
+	}
+
+	delivered := 0
+	lastFollowerID := ""
+	for {
+		var followerIDs []string
+		if err := s.db.Model(&models.Follow{}).
+			Where("followee_id = ? AND follower_id > ?", post.UserID, lastFollowerID).
+			Order("follower_id").
+			Limit(fanOutBatchSize).
+			Pluck("follower_id", &followerIDs).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to load followers for fan-out")
+			return
+		}
+
+		for _, followerID := range followerIDs {
+			s.pushBuilt(ctx, followerID, entry)
+		}
+		delivered += len(followerIDs)
+
+		if len(followerIDs) < fanOutBatchSize {
+			break
+		}
+		lastFollowerID = followerIDs[len(followerIDs)-1]
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"post_id":   post.PostID,
+		"user_id":   post.UserID,
+		"followers": delivered,
+	}).Info("Post fanned out")
+}
+
+// invalidateFollowers drops the timelines of every follower of the user so they are rebuilt on
+// their next read
+func (s *TimelineService) invalidateFollowers(userID string) {
+	ctx := context.Background()
+
+	invalidated := 0
+	lastFollowerID := ""
+	for {
+		var followerIDs []string
+		if err := s.db.Model(&models.Follow{}).
+			Where("followee_id = ? AND follower_id > ?", userID, lastFollowerID).
+			Order("follower_id").
+			Limit(fanOutBatchSize).
+			Pluck("follower_id", &followerIDs).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to load followers for timeline rebuild")
+			return
+		}
+
+		for _, followerID := range followerIDs {
+			s.invalidate(ctx, followerID)
+		}
+		invalidated += len(followerIDs)
+
+		if len(followerIDs) < fanOutBatchSize {
+			break
+		}
+		lastFollowerID = followerIDs[len(followerIDs)-1]
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":   userID,
+		"followers": invalidated,
+	}).Info("Follower timelines invalidated")
+}
+
+// GetHomeFeedPage returns a numbered page of the posts of the users userID follows plus their own
+// posts, newest first, in the same shape as GetAllSocialMediaPosts. It reads the posts table
+// rather than the materialized timeline, so deep pages get slower; GetHomeTimeline does not.
+func (s *TimelineService) GetHomeFeedPage(userID string, page int, pageSize int) (map[string]any, error) {
+	var posts []models.SocialMediaPost
+	var totalCount int64
+
+	// Defaults
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	offset := (page - 1) * pageSize
+
+	query := s.db.Model(&models.SocialMediaPost{}).
+		Where("user_id = ? OR user_id IN (?)", userID,
+			s.db.Model(&models.Follow{}).Select("followee_id").Where("follower_id = ?", userID))
+
+	// Count total
+	if err := query.Count(&totalCount).Error; err != nil {
+		s.logger.WithError(err).Error("Count failed")
+		return nil, err
+	}
+
+	// Fetch paginated posts
+	if err := query.
+		Order("created_at desc, post_id desc").
+		Limit(pageSize).
+		Offset(offset).
+		Find(&posts).Error; err != nil {
+		s.logger.WithError(err).Error("Query failed")
+		return nil, err
+	}
+
+	if err := attachPostDetails(s.db, postPointers(posts), userID); err != nil {
+		return nil, err
+	}
+
+	totalPages := (totalCount + int64(pageSize) - 1) / int64(pageSize)
+
+	return map[string]any{
+		"posts":        posts,
+		"total_count":  totalCount,
+		"current_page": page,
+		"total_pages":  totalPages,
+	}, nil
+}
+
+// GetHomeTimeline returns a page of the user's home timeline, newest first. Pass the
+// next_cursor of the previous page to continue. Each read costs O(limit) timeline entries
+// plus one small indexed query per followed celebrity.
+func (s *TimelineService) GetHomeTimeline(userID string, cursor string, limit int) (*PostFeedPage, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	var position *utils.Cursor
+	if cursor != "" {
+		var err error
+		position, err = utils.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	if err := s.ensureTimeline(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	celebrities, err := s.followedCelebrities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read one post more than limit to know whether there is another page. Entries of deleted
+	// posts are skipped, so read again from where the previous read stopped until that is reached.
+	posts := make([]models.SocialMediaPost, 0, limit+1)
+	exhausted := false
+	for read := 0; read < maxTimelineReads && len(posts) <= limit; read++ {
+		want := limit + 1 - len(posts)
+
+		entries, err := s.readEntries(ctx, userID, celebrities, position, want)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			exhausted = true
+			break
+		}
+
+		found, err := s.loadPosts(entries)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, found...)
+
+		if len(entries) < want {
+			exhausted = true
+			break
+		}
+		last := entries[len(entries)-1]
+		position = &utils.Cursor{CreatedAt: time.UnixMilli(last.CreatedAt), ID: last.PostID}
+	}
+
+	page := &PostFeedPage{Posts: posts}
+	if len(posts) > limit {
+		page.Posts = posts[:limit]
+		page.HasMore = true
+		last := page.Posts[limit-1]
+		page.NextCursor = utils.EncodeCursor(last.CreatedAt, last.PostID)
+	} else if !exhausted {
+		// Gave up on a run of deleted posts; continue after the last entry that was read
+		page.HasMore = true
+		page.NextCursor = utils.EncodeCursor(position.CreatedAt, position.ID)
+	}
+
+	if err := attachPostDetails(s.db, postPointers(page.Posts), userID); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// readEntries returns up to count entries older than position, merging the materialized
+// timeline with the recent posts of followed celebrities
+func (s *TimelineService) readEntries(ctx context.Context, userID string, celebrities []string, position *utils.Cursor, count int) ([]timelineEntry, error) {
+	entries, err := s.readTimeline(ctx, userID, position, count)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, celebrityID := range celebrities {
+		query := s.db.Model(&models.SocialMediaPost{}).
+			Select("post_id, created_at").
+			Where("user_id = ?", celebrityID)
+		if position != nil {
+			query = query.Where("created_at < ? OR (created_at = ? AND post_id < ?)", position.CreatedAt, position.CreatedAt, position.ID)
+		}
+
+		var rows []struct {
+			PostID    string
+			CreatedAt time.Time
+		}
+		if err := query.Order("created_at desc, post_id desc").Limit(count).Scan(&rows).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to read celebrity posts")
+			return nil, errors.New("failed to read home timeline")
+		}
+		for _, row := range rows {
+			entries = append(entries, timelineEntry{PostID: row.PostID, CreatedAt: row.CreatedAt.UnixMilli()})
+		}
+	}
+
+	// Newest first; a celebrity's posts fanned out before they became one appear twice
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CreatedAt != entries[j].CreatedAt {
+			return entries[i].CreatedAt > entries[j].CreatedAt
+		}
+		return entries[i].PostID > entries[j].PostID
+	})
+	merged := make([]timelineEntry, 0, len(entries))
+	for i, entry := range entries {
+		if i > 0 && entry.PostID == entries[i-1].PostID {
+			continue
+		}
+		merged = append(merged, entry)
+	}
+	if len(merged) > count {
+		merged = merged[:count]
+	}
+
+	return merged, nil
+}
+
+// readTimeline returns up to count entries of the materialized timeline older than position
+func (s *TimelineService) readTimeline(ctx context.Context, userID string, position *utils.Cursor, count int) ([]timelineEntry, error) {
+	upper := "+inf"
+	if position != nil {
+		upper = strconv.FormatInt(position.CreatedAt.UnixMilli(), 10)
+	}
+
+	entries := make([]timelineEntry, 0, count)
+	offset := int64(0)
+	for len(entries) < count {
+		want := int64(count - len(entries))
+		members, err := s.cache.ZRevRangeByScoreWithScores(ctx, timelineKey(userID), &utils.ZRangeBy{
+			Min:    "-inf",
+			Max:    upper,
+			Offset: offset,
+			Count:  want,
+		})
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to read timeline")
+			return nil, errors.New("failed to read home timeline")
+		}
+
+		for _, member := range members {
+			entry := timelineEntry{PostID: member.Member, CreatedAt: int64(member.Score)}
+			// Posts created in the same millisecond as the cursor post may already have been returned
+			if position != nil && !entry.before(position) {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+
+		if int64(len(members)) < want {
+			break
+		}
+		offset += int64(len(members))
+	}
+
+	return entries, nil
+}
+
+// loadPosts loads the posts of the entries in timeline order, skipping deleted ones
+func (s *TimelineService) loadPosts(entries []timelineEntry) ([]models.SocialMediaPost, error) {
+	postIDs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		postIDs = append(postIDs, entry.PostID)
+	}
+
+	var found []models.SocialMediaPost
+	if err := s.db.Where("post_id IN ?", postIDs).Find(&found).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to load timeline posts")
+		return nil, errors.New("failed to read home timeline")
+	}
+
+	byID := make(map[string]models.SocialMediaPost, len(found))
+	for _, post := range found {
+		byID[post.PostID] = post
+	}
+
+	posts := make([]models.SocialMediaPost, 0, len(found))
+	for _, postID := range postIDs {
+		if post, ok := byID[postID]; ok {
+			posts = append(posts, post)
+		}
+	}
+
+	return posts, nil
+}
+
+// ensureTimeline builds a user's timeline from the database the first time it is read,
+// for example after a restart, after it expired or after the user followed or unfollowed
+// someone. Reading a timeline keeps it from expiring.
+func (s *TimelineService) ensureTimeline(ctx context.Context, userID string) error {
+	built, err := s.cache.Exists(ctx, timelineBuiltKey(userID))
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to check timeline")
+		return errors.New("failed to read home timeline")
+	}
+	if built {
+		if err := s.cache.Expire(ctx, timelineBuiltKey(userID), s.ttl); err != nil {
+			s.logger.WithError(err).Error("Failed to refresh timeline")
+		}
+		if err := s.cache.Expire(ctx, timelineKey(userID), s.ttl); err != nil {
+			s.logger.WithError(err).Error("Failed to refresh timeline")
+		}
+		return nil
+	}
+
+	celebrities, err := s.celebrities(ctx)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	members, err := s.timelinePosts(userID, celebrities, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	// Drop what is left of an expired timeline, then mark it built so new posts are fanned out to it
+	key := timelineKey(userID)
+	err = s.cache.Del(ctx, key)
+	if err == nil && len(members) > 0 {
+		err = s.cache.ZAdd(ctx, key, members...)
+	}
+	if err == nil {
+		err = s.cache.Expire(ctx, key, s.ttl)
+	}
+	if err == nil {
+		err = s.cache.Set(ctx, timelineBuiltKey(userID), "1", s.ttl)
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to build timeline")
+		return errors.New("failed to read home timeline")
+	}
+
+	// Posts saved while the timeline was built were not fanned out to it
+	recent, err := s.timelinePosts(userID, celebrities, started.Add(-timelineBuildMargin))
+	if err != nil {
+		return err
+	}
+	if len(recent) > 0 {
+		s.push(ctx, userID, recent...)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+		"posts":   len(members),
+	}).Info("Timeline built")
+
+	return nil
+}
+
+// timelinePosts returns the newest posts of the user and of the authors they follow that are not
+// celebrities, as timeline entries. A non-zero since leaves out posts created before it.
+func (s *TimelineService) timelinePosts(userID string, celebrities []string, since time.Time) ([]utils.Z, error) {
+	followees := s.db.Model(&models.Follow{}).Select("followee_id").Where("follower_id = ?", userID)
+	if len(celebrities) > 0 {
+		followees = followees.Where("followee_id NOT IN ?", celebrities)
+	}
+
+	query := s.db.Model(&models.SocialMediaPost{}).
+		Select("post_id, created_at").
+		Where("user_id = ? OR user_id IN (?)", userID, followees)
+	if !since.IsZero() {
+		query = query.Where("created_at >= ?", since)
+	}
+
+	var rows []struct {
+		PostID    string
+		CreatedAt time.Time
+	}
+	if err := query.
+		Order("created_at desc, post_id desc").
+		Limit(s.config.TimelineMaxLength).
+		Scan(&rows).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to build timeline")
+		return nil, errors.New("failed to read home timeline")
+	}
+
+	members := make([]utils.Z, 0, len(rows))
+	for _, row := range rows {
+		members = append(members, utils.Z{Score: float64(row.CreatedAt.UnixMilli()), Member: row.PostID})
+	}
+	return members, nil
+}
+
+// push adds entries to a timeline and trims it to TimelineMaxLength. If that fails the
+// timeline is dropped so it is rebuilt on the next read instead of silently missing the post.
+func (s *TimelineService) push(ctx context.Context, userID string, entries ...utils.Z) {
+	key := timelineKey(userID)
+
+	err := s.cache.ZAdd(ctx, key, entries...)
+	if err == nil {
+		err = s.cache.ZRemRangeByRank(ctx, key, 0, int64(-s.config.TimelineMaxLength-1))
+	}
+	if err == nil {
+		// The timeline outlives its built marker, which reads refresh, by at most the TTL
+		err = s.cache.Expire(ctx, key, s.ttl)
+	}
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to push to timeline")
+		s.invalidate(ctx, userID)
+	}
+}
+
+// pushBuilt adds an entry to a timeline that is built. Timelines that are not, because they were
+// never read or expired, get the post from the database when they are built on their next read.
+func (s *TimelineService) pushBuilt(ctx context.Context, userID string, entry utils.Z) {
+	built, err := s.cache.Exists(ctx, timelineBuiltKey(userID))
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to check timeline")
+		s.invalidate(ctx, userID)
+		return
+	}
+	if built {
+		s.push(ctx, userID, entry)
+	}
+}
+
+// invalidate drops a timeline so it is rebuilt from the database on the next read
+func (s *TimelineService) invalidate(ctx context.Context, userID string) {
+	if err := s.cache.Del(ctx, timelineBuiltKey(userID), timelineKey(userID)); err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to invalidate timeline")
+	}
+}
+
+// isCelebrity reports whether the user's posts are merged in at read time
+func (s *TimelineService) isCelebrity(ctx context.Context, userID string) (bool, error) {
+	_, err := s.cache.ZScore(ctx, celebritiesKey, userID)
+	if errors.Is(err, utils.ErrCacheMiss) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// celebrities returns every author whose posts are merged in at read time
+func (s *TimelineService) celebrities(ctx context.Context) ([]string, error) {
+	members, err := s.cache.ZRevRangeByScoreWithScores(ctx, celebritiesKey, &utils.ZRangeBy{Min: "-inf", Max: "+inf"})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to read celebrities")
+		return nil, errors.New("failed to read home timeline")
+	}
+
+	userIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.Member)
+	}
+	return userIDs, nil
+}
+
+// followedCelebrities returns the celebrities the user follows
+func (s *TimelineService) followedCelebrities(ctx context.Context, userID string) ([]string, error) {
+	celebrities, err := s.celebrities(ctx)
+	if err != nil || len(celebrities) == 0 {
+		return nil, err
+	}
+
+	var followed []string
+	if err := s.db.Model(&models.Follow{}).
+		Where("follower_id = ? AND followee_id IN ?", userID, celebrities).
+		Pluck("followee_id", &followed).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to read followed celebrities")
+		return nil, errors.New("failed to read home timeline")
+	}
+	return followed, nil
+}
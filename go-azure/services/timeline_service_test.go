@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/testutil"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createPost stores a post by the user created minutes ago
+func createPost(t *testing.T, db *gorm.DB, userID string, minutes int) models.SocialMediaPost {
+	t.Helper()
+
+	post := models.SocialMediaPost{
+		PostID:    uuid.New().String(),
+		UserID:    userID,
+		PostText:  "post",
+		CreatedAt: time.Now().Add(-time.Duration(minutes) * time.Minute).Truncate(time.Millisecond),
+	}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestHomeFeedPagesAndCursor(t *testing.T) {
+	db := testutil.OpenDB(t)
+	ada := testutil.CreateUser(t, db, "Ada")
+	grace := testutil.CreateUser(t, db, "Grace")
+	bob := testutil.CreateUser(t, db, "Bob")
+	if err := db.Create(&models.Follow{FollowerID: ada.ID, FolloweeID: grace.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	newest := createPost(t, db, grace.ID, 1)
+	createPost(t, db, ada.ID, 2)
+	oldest := createPost(t, db, grace.ID, 3)
+	createPost(t, db, bob.ID, 0)
+
+	service := NewTimelineService(&config.Config{TimelineMaxLength: 800, TimelineCelebrityFollowers: 10000})
+
+	// Without a cursor the feed keeps the page shape of GET /posts
+	page, err := service.GetHomeFeedPage(ada.ID, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := page["posts"].([]models.SocialMediaPost)
+	if page["total_count"] != int64(3) || page["total_pages"] != int64(2) || page["current_page"] != 2 ||
+		len(posts) != 1 || posts[0].PostID != oldest.PostID {
+		t.Errorf("page 2 = %+v", page)
+	}
+
+	// The cursor form walks the same posts through the timeline
+	first, err := service.GetHomeTimeline(ada.ID, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Posts) != 2 || first.Posts[0].PostID != newest.PostID || !first.HasMore {
+		t.Fatalf("first cursor page = %+v", first)
+	}
+	second, err := service.GetHomeTimeline(ada.ID, first.NextCursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Posts) != 1 || second.Posts[0].PostID != oldest.PostID || second.HasMore {
+		t.Errorf("second cursor page = %+v", second)
+	}
+}
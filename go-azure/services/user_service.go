@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidName is returned for an empty or overlong display name
+	ErrInvalidName = errors.New("name must be between 1 and 100 characters")
+	// ErrBioTooLong is returned for a bio over MaxBioLength characters
+	ErrBioTooLong = errors.New("bio must be at most 500 characters")
+)
+
+const (
+	// MaxNameLength is the longest display name a user can set
+	MaxNameLength = 100
+	// MaxBioLength is the longest bio a user can set
+	MaxBioLength = 500
+)
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left as they are; an empty
+// AvatarMediaID removes the avatar.
+type ProfileUpdate struct {
+	Name          *string
+	Bio           *string
+	AvatarMediaID *string
+}
+
+// UserService handles user profiles
+type UserService struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewUserService creates a new UserService
+func NewUserService() *UserService {
+	return &UserService{
+		db:     utils.GetDB(),
+		logger: utils.GetLogger(),
+	}
+}
+
+// GetProfile returns the user with their avatar URL and post and follow counts
+func (s *UserService) GetProfile(userID string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.WithError(err).Error("Failed to get user")
+		return nil, errors.New("failed to get user")
+	}
+
+	if user.AvatarMediaID != "" {
+		user.AvatarURL = models.MediaURL(user.AvatarMediaID)
+	}
+
+	stats := models.UserStats{}
+	if err := s.db.Model(&models.SocialMediaPost{}).Where("user_id = ?", userID).Count(&stats.PostsCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count posts")
+		return nil, errors.New("failed to count posts")
+	}
+	if err := s.db.Model(&models.Follow{}).Where("followee_id = ?", userID).Count(&stats.FollowersCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count followers")
+		return nil, errors.New("failed to count followers")
+	}
+	if err := s.db.Model(&models.Follow{}).Where("follower_id = ?", userID).Count(&stats.FollowingCount).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count followees")
+		return nil, errors.New("failed to count followees")
+	}
+	user.Stats = &stats
+
+	return &user, nil
+}
+
+// UpdateProfile changes the user's display name, bio or avatar and returns the updated profile.
+// An edited name is no longer overwritten by the Microsoft display name on login. The avatar must
+// be media the user uploaded.
+func (s *UserService) UpdateProfile(userID string, update ProfileUpdate) (*models.User, error) {
+	updates := map[string]any{}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" || utf8.RuneCountInString(name) > MaxNameLength {
+			return nil, ErrInvalidName
+		}
+		updates["name"] = name
+		updates["name_edited"] = true
+	}
+
+	if update.Bio != nil {
+		bio := strings.TrimSpace(*update.Bio)
+		if utf8.RuneCountInString(bio) > MaxBioLength {
+			return nil, ErrBioTooLong
+		}
+		updates["bio"] = bio
+	}
+
+	if update.AvatarMediaID != nil {
+		if *update.AvatarMediaID != "" {
+			var count int64
+			if err := s.db.Model(&models.Media{}).Where("media_id = ? AND user_id = ?", *update.AvatarMediaID, userID).Count(&count).Error; err != nil {
+				s.logger.WithError(err).Error("Failed to check media")
+				return nil, errors.New("failed to get media")
+			}
+			if count == 0 {
+				return nil, ErrMediaNotFound
+			}
+		}
+		updates["avatar_media_id"] = *update.AvatarMediaID
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to update profile")
+			return nil, errors.New("failed to update profile")
+		}
+
+		s.logger.WithField("user_id", userID).Info("Profile updated")
+	}
+
+	return s.GetProfile(userID)
+}
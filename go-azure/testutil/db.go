@@ -0,0 +1,56 @@
+// Package testutil sets up the dependencies of the services for tests. It is only imported by
+// _test.go files, so its sqlite driver is not linked into the API.
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-azure/migrations"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// OpenDB creates an empty sqlite database with every table, makes it the database returned by
+// utils.GetDB and resets the cache. Queries specific to MySQL, such as FULLTEXT searches, are
+// not available. Row locks are ignored by sqlite, which serializes writers on its single
+// connection instead.
+func OpenDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(migrations.Models...); err != nil {
+		t.Fatal(err)
+	}
+
+	utils.DB = db
+	utils.InitCache()
+	return db
+}
+
+// CreateUser creates a user with the name and the user role
+func CreateUser(t *testing.T, db *gorm.DB, name string) *models.User {
+	t.Helper()
+
+	user := &models.User{ID: uuid.New().String(), Name: name, Role: models.RoleUser}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
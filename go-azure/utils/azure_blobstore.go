@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// azureStorageVersion is the Blob service REST API version the requests are signed for
+const azureStorageVersion = "2021-08-06"
+
+// AzureBlobStore stores blobs in an Azure Blob Storage container using the REST API with
+// Shared Key authorization. It also works against the Azurite emulator.
+type AzureBlobStore struct {
+	account   string
+	key       []byte
+	endpoint  string
+	container string
+	client    *http.Client
+}
+
+// NewAzureBlobStore creates an AzureBlobStore. An empty endpoint means
+// https://<account>.blob.core.windows.net; for Azurite pass http://127.0.0.1:10000/devstoreaccount1.
+func NewAzureBlobStore(account string, accountKey string, container string, endpoint string) (*AzureBlobStore, error) {
+	if account == "" || accountKey == "" || container == "" {
+		return nil, errors.New("azure storage account, key and container are required")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(accountKey)
+	if err != nil {
+		return nil, errors.New("azure storage key is not valid base64")
+	}
+
+	if endpoint == "" {
+		endpoint = "https://" + account + ".blob.core.windows.net"
+	}
+
+	return &AzureBlobStore{
+		account:   account,
+		key:       key,
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		container: container,
+		client:    &http.Client{Timeout: 2 * time.Minute},
+	}, nil
+}
+
+// EnsureContainer creates the container if it does not exist yet
+func (s *AzureBlobStore) EnsureContainer(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+"/"+s.container+"?restype=container", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		// ContainerAlreadyExists
+		return nil
+	}
+	return checkAzureResponse(resp, "create container "+s.container)
+}
+
+// Put uploads the blob as a block blob in a single request
+func (s *AzureBlobStore) Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error {
+	blobURL, err := s.blobURL(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, blobURL, data)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkAzureResponse(resp, "put blob "+key)
+}
+
+// Open reads the blob size and returns a reader that downloads ranges on demand
+func (s *AzureBlobStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	blobURL, err := s.blobURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, blobURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if err := checkAzureResponse(resp, "get blob properties "+key); err != nil {
+		return nil, err
+	}
+
+	return &azureBlobReader{ctx: ctx, store: s, url: blobURL, key: key, size: resp.ContentLength}, nil
+}
+
+// Delete deletes the blob
+func (s *AzureBlobStore) Delete(ctx context.Context, key string) error {
+	blobURL, err := s.blobURL(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, blobURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = checkAzureResponse(resp, "delete blob "+key)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *AzureBlobStore) blobURL(key string) (string, error) {
+	if err := validateBlobKey(key); err != nil {
+		return "", err
+	}
+	return s.endpoint + "/" + s.container + "/" + key, nil
+}
+
+// do signs and sends a request
+func (s *AzureBlobStore) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureStorageVersion)
+
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(s.stringToSign(req)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req.Header.Set("Authorization", "SharedKey "+s.account+":"+signature)
+
+	return s.client.Do(req)
+}
+
+// stringToSign builds the Shared Key string to sign of the Blob service
+// (https://learn.microsoft.com/rest/api/storageservices/authorize-with-shared-key)
+func (s *AzureBlobStore) stringToSign(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	parts := []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date; x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	}
+
+	return strings.Join(parts, "\n") + "\n" + canonicalizedHeaders(req.Header) + s.canonicalizedResource(req.URL)
+}
+
+// canonicalizedHeaders lists the x-ms- headers as sorted "name:value\n" lines
+func canonicalizedHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(name + ":" + strings.TrimSpace(header.Get(name)) + "\n")
+	}
+	return builder.String()
+}
+
+// canonicalizedResource is /<account><path> followed by the sorted query parameters
+func (s *AzureBlobStore) canonicalizedResource(u *url.URL) string {
+	resource := "/" + s.account + u.EscapedPath()
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+	return resource
+}
+
+// checkAzureResponse turns a non-2xx response into an error
+func checkAzureResponse(resp *http.Response, operation string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrBlobNotFound
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("azure %s: %s %s", operation, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// azureBlobReader reads a blob with ranged GET requests. Sequential reads share one response;
+// seeking closes it and the next read requests the range starting at the new offset.
+type azureBlobReader struct {
+	ctx    context.Context
+	store  *AzureBlobStore
+	url    string
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *azureBlobReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("x-ms-range", fmt.Sprintf("bytes=%d-", r.offset))
+
+		resp, err := r.store.do(req)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkAzureResponse(resp, "get blob "+r.key); err != nil {
+			resp.Body.Close()
+			return 0, err
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *azureBlobReader) Seek(offset int64, whence int) (int64, error) {
+	var position int64
+	switch whence {
+	case io.SeekStart:
+		position = offset
+	case io.SeekCurrent:
+		position = r.offset + offset
+	case io.SeekEnd:
+		position = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if position < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if position != r.offset {
+		r.closeBody()
+		r.offset = position
+	}
+	return position, nil
+}
+
+func (r *azureBlobReader) Close() error {
+	r.closeBody()
+	return nil
+}
+
+func (r *azureBlobReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
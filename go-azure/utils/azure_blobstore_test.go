@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// Azurite's well-known development account
+const (
+	azuriteAccount = "devstoreaccount1"
+	azuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// newAzuriteStore returns a store on the Azurite emulator at AZURITE_BLOB_ENDPOINT, by default
+// http://127.0.0.1:10000/devstoreaccount1, and skips the test when the emulator is not running
+func newAzuriteStore(t *testing.T) *AzureBlobStore {
+	t.Helper()
+
+	endpoint := os.Getenv("AZURITE_BLOB_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:10000/" + azuriteAccount
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialTimeout("tcp", endpointURL.Host, time.Second)
+	if err != nil {
+		t.Skipf("Azurite is not running at %s: %v", endpoint, err)
+	}
+	conn.Close()
+
+	store, err := NewAzureBlobStore(azuriteAccount, azuriteKey, "test-media", endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EnsureContainer(context.Background()); err != nil {
+		t.Fatalf("EnsureContainer: %v", err)
+	}
+	return store
+}
+
+func TestAzureBlobStore(t *testing.T) {
+	store := newAzuriteStore(t)
+	ctx := context.Background()
+	key := "test/" + time.Now().Format("20060102150405.000000000")
+	data := []byte("0123456789abcdefghij")
+
+	if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	t.Cleanup(func() { store.Delete(ctx, key) })
+
+	reader, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+
+	got, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read %q, %v, want %q", got, err, data)
+	}
+
+	// Seeking requests a range starting at the new offset
+	if _, err := reader.Seek(10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got = make([]byte, 5)
+	if _, err := io.ReadFull(reader, got); err != nil || string(got) != "abcde" {
+		t.Fatalf("read %q after seek, %v, want %q", got, err, "abcde")
+	}
+	if size, err := reader.Seek(0, io.SeekEnd); err != nil || size != int64(len(data)) {
+		t.Errorf("Seek to end = %d, %v, want %d", size, err, len(data))
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Open(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Open after delete error = %v, want %v", err, ErrBlobNotFound)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
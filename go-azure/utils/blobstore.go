@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go-azure/config"
+)
+
+// ErrBlobNotFound is returned when a blob does not exist
+var ErrBlobNotFound = errors.New("blob not found")
+
+// blobKeyPattern restricts keys to simple relative paths such as "<media_id>/original"
+var blobKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(/[A-Za-z0-9][A-Za-z0-9._-]*)*$`)
+
+// BlobStore stores binary objects such as uploaded images under string keys
+type BlobStore interface {
+	// Put stores size bytes read from data under key, replacing any existing blob
+	Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error
+	// Open returns a seekable reader over the blob so it can be served with range requests
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete removes the blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewBlobStore creates the BlobStore selected by cfg.MediaStorage
+func NewBlobStore(cfg *config.Config) (BlobStore, error) {
+	switch cfg.MediaStorage {
+	case "local":
+		return NewLocalBlobStore(cfg.MediaLocalDir)
+	case "azure":
+		store, err := NewAzureBlobStore(cfg.AzureStorageAccount, cfg.AzureStorageKey, cfg.AzureStorageContainer, cfg.AzureStorageEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.EnsureContainer(context.Background()); err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown media storage %q", cfg.MediaStorage)
+	}
+}
+
+func validateBlobKey(key string) error {
+	if !blobKeyPattern.MatchString(key) || strings.Contains(key, "..") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// LocalBlobStore keeps blobs as files below a root directory
+type LocalBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore creates a LocalBlobStore, creating root if needed
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{root: root}, nil
+}
+
+// Put writes the blob to a temporary file and renames it into place so readers never see a partial file
+func (s *LocalBlobStore) Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, data)
+	if err == nil && written != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Open opens the blob file
+func (s *LocalBlobStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return file, err
+}
+
+// Delete removes the blob file
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if err := validateBlobKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
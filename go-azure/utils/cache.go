@@ -0,0 +1,385 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned when a key or member does not exist, like redis.Nil
+var ErrCacheMiss = errors.New("cache: key not found")
+
+// Z is a sorted set member and its score
+type Z struct {
+	Score  float64
+	Member string
+}
+
+// ZRangeBy limits a sorted set range by score. Min and Max use Redis syntax:
+// a number, "(" followed by a number for an exclusive bound, "-inf" or "+inf".
+// A zero Count returns every member in range.
+type ZRangeBy struct {
+	Min, Max      string
+	Offset, Count int64
+}
+
+// Cache is the subset of Redis commands used by the application. Method names and
+// semantics follow the Redis commands of the same name so a Redis client can back it.
+type Cache interface {
+	Exists(ctx context.Context, key string) (bool, error)
+	Set(ctx context.Context, key string, value string, expiration time.Duration) error
+	GetDel(ctx context.Context, key string) (string, error)
+	Del(ctx context.Context, keys ...string) error
+	Expire(ctx context.Context, key string, expiration time.Duration) error
+	ZAdd(ctx context.Context, key string, members ...Z) error
+	ZRem(ctx context.Context, key string, members ...string) error
+	ZScore(ctx context.Context, key string, member string) (float64, error)
+	ZRevRangeByScoreWithScores(ctx context.Context, key string, opt *ZRangeBy) ([]Z, error)
+	ZRemRangeByRank(ctx context.Context, key string, start int64, stop int64) error
+}
+
+var cache Cache
+
+// InitCache initializes the cache. Only the in-process implementation is available for now.
+func InitCache() Cache {
+	cache = NewMemoryCache()
+	return cache
+}
+
+// GetCache returns the cache
+func GetCache() Cache {
+	return cache
+}
+
+// MemoryCache is an in-process Cache. Data is lost when the process exits.
+type MemoryCache struct {
+	mu      sync.Mutex
+	strings map[string]memoryString
+	zsets   map[string]*sortedSet
+	sets    int // Set calls since expired strings were last evicted
+}
+
+// memorySweepInterval is how many Set calls pass between evictions of every expired string, so
+// keys that are never read again do not pile up
+const memorySweepInterval = 1000
+
+type memoryString struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates an empty MemoryCache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		strings: make(map[string]memoryString),
+		zsets:   make(map[string]*sortedSet),
+	}
+}
+
+// Exists reports whether the key holds a value
+func (c *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.getZSet(key); ok {
+		return true, nil
+	}
+	_, ok := c.getString(key)
+	return ok, nil
+}
+
+// Set stores a string value. A zero expiration keeps it forever.
+func (c *MemoryCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := memoryString{value: value}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+	delete(c.zsets, key)
+	c.strings[key] = entry
+
+	c.sets++
+	if c.sets >= memorySweepInterval {
+		c.sets = 0
+		now := time.Now()
+		for k, e := range c.strings {
+			if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+				delete(c.strings, k)
+			}
+		}
+		for k, set := range c.zsets {
+			if !set.expiresAt.IsZero() && now.After(set.expiresAt) {
+				delete(c.zsets, k)
+			}
+		}
+	}
+	return nil
+}
+
+// GetDel returns a string value and removes it, or ErrCacheMiss when the key holds none
+func (c *MemoryCache) GetDel(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.getZSet(key); ok {
+		return "", fmt.Errorf("cache: %s does not hold a string", key)
+	}
+	entry, ok := c.getString(key)
+	if !ok {
+		return "", ErrCacheMiss
+	}
+	delete(c.strings, key)
+	return entry.value, nil
+}
+
+// Del removes the keys
+func (c *MemoryCache) Del(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.strings, key)
+		delete(c.zsets, key)
+	}
+	return nil
+}
+
+// Expire sets a key to be removed after expiration. Writing a string with Set clears it, while
+// changing a sorted set keeps it, as in Redis.
+func (c *MemoryCache) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(expiration)
+	if set, ok := c.getZSet(key); ok {
+		set.expiresAt = expiresAt
+		return nil
+	}
+	if entry, ok := c.getString(key); ok {
+		entry.expiresAt = expiresAt
+		c.strings[key] = entry
+	}
+	return nil
+}
+
+// ZAdd adds members to a sorted set, updating the score of existing members
+func (c *MemoryCache) ZAdd(ctx context.Context, key string, members ...Z) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set, ok := c.getZSet(key)
+	if !ok {
+		if _, isString := c.getString(key); isString {
+			return fmt.Errorf("cache: %s does not hold a sorted set", key)
+		}
+		set = &sortedSet{scores: make(map[string]float64)}
+		c.zsets[key] = set
+	}
+	for _, member := range members {
+		set.add(member)
+	}
+	return nil
+}
+
+// ZRem removes members from a sorted set
+func (c *MemoryCache) ZRem(ctx context.Context, key string, members ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set, ok := c.getZSet(key)
+	if !ok {
+		return nil
+	}
+	for _, member := range members {
+		set.remove(member)
+	}
+	c.dropIfEmpty(key)
+	return nil
+}
+
+// ZScore returns the score of a member, or ErrCacheMiss
+func (c *MemoryCache) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set, ok := c.getZSet(key)
+	if !ok {
+		return 0, ErrCacheMiss
+	}
+	score, ok := set.scores[member]
+	if !ok {
+		return 0, ErrCacheMiss
+	}
+	return score, nil
+}
+
+// ZRevRangeByScoreWithScores returns members with a score in range, highest score first.
+// Members with equal scores are returned in reverse lexicographical order.
+func (c *MemoryCache) ZRevRangeByScoreWithScores(ctx context.Context, key string, opt *ZRangeBy) ([]Z, error) {
+	lower, lowerExclusive, err := parseScoreBound(opt.Min)
+	if err != nil {
+		return nil, err
+	}
+	upper, upperExclusive, err := parseScoreBound(opt.Max)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set, ok := c.getZSet(key)
+	if !ok {
+		return []Z{}, nil
+	}
+
+	// Index of the first member above the upper bound; the range ends just before it
+	end := sort.Search(len(set.members), func(i int) bool {
+		if upperExclusive {
+			return set.members[i].Score >= upper
+		}
+		return set.members[i].Score > upper
+	})
+
+	result := []Z{}
+	skipped := int64(0)
+	for i := end - 1; i >= 0; i-- {
+		member := set.members[i]
+		if member.Score < lower || (lowerExclusive && member.Score == lower) {
+			break
+		}
+		if skipped < opt.Offset {
+			skipped++
+			continue
+		}
+		result = append(result, member)
+		if opt.Count > 0 && int64(len(result)) == opt.Count {
+			break
+		}
+	}
+	return result, nil
+}
+
+// ZRemRangeByRank removes members by rank, lowest score first. Negative ranks count from the end.
+func (c *MemoryCache) ZRemRangeByRank(ctx context.Context, key string, start int64, stop int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set, ok := c.getZSet(key)
+	if !ok {
+		return nil
+	}
+
+	size := int64(len(set.members))
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop {
+		return nil
+	}
+
+	for _, member := range set.members[start : stop+1] {
+		delete(set.scores, member.Member)
+	}
+	set.members = append(set.members[:start], set.members[stop+1:]...)
+	c.dropIfEmpty(key)
+	return nil
+}
+
+// getString returns a string value, evicting it if it expired. The caller holds c.mu.
+func (c *MemoryCache) getString(key string) (memoryString, bool) {
+	entry, ok := c.strings[key]
+	if !ok {
+		return memoryString{}, false
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(c.strings, key)
+		return memoryString{}, false
+	}
+	return entry, true
+}
+
+// getZSet returns a sorted set, evicting it if it expired. The caller holds c.mu.
+func (c *MemoryCache) getZSet(key string) (*sortedSet, bool) {
+	set, ok := c.zsets[key]
+	if !ok {
+		return nil, false
+	}
+	if !set.expiresAt.IsZero() && time.Now().After(set.expiresAt) {
+		delete(c.zsets, key)
+		return nil, false
+	}
+	return set, true
+}
+
+// dropIfEmpty deletes an empty sorted set, as Redis does. The caller holds c.mu.
+func (c *MemoryCache) dropIfEmpty(key string) {
+	if set, ok := c.zsets[key]; ok && len(set.members) == 0 {
+		delete(c.zsets, key)
+	}
+}
+
+// sortedSet keeps members ordered by (score, member) for range reads in O(log n + count)
+type sortedSet struct {
+	members   []Z
+	scores    map[string]float64
+	expiresAt time.Time // zero for sets that never expire
+}
+
+func (s *sortedSet) add(member Z) {
+	s.remove(member.Member)
+
+	i := s.search(member)
+	s.members = append(s.members, Z{})
+	copy(s.members[i+1:], s.members[i:])
+	s.members[i] = member
+	s.scores[member.Member] = member.Score
+}
+
+func (s *sortedSet) remove(member string) {
+	score, ok := s.scores[member]
+	if !ok {
+		return
+	}
+
+	i := s.search(Z{Score: score, Member: member})
+	s.members = append(s.members[:i], s.members[i+1:]...)
+	delete(s.scores, member)
+}
+
+// search returns the position of member in the ordering
+func (s *sortedSet) search(member Z) int {
+	return sort.Search(len(s.members), func(i int) bool {
+		current := s.members[i]
+		if current.Score != member.Score {
+			return current.Score > member.Score
+		}
+		return current.Member >= member.Member
+	})
+}
+
+// parseScoreBound parses a Redis score bound such as "(10", "10", "-inf" or "+inf"
+func parseScoreBound(bound string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(bound, "(")
+	value, err := strconv.ParseFloat(strings.TrimPrefix(bound, "("), 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("cache: invalid score bound %q", bound)
+	}
+	return value, exclusive, nil
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheExpire(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache()
+
+	if err := cache.ZAdd(ctx, "zset", Z{Score: 1, Member: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set(ctx, "string", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"zset", "string", "missing"} {
+		if err := cache.Expire(ctx, key, 20*time.Millisecond); err != nil {
+			t.Fatalf("Expire(%q): %v", key, err)
+		}
+	}
+
+	// Changing a sorted set keeps its expiry
+	if err := cache.ZAdd(ctx, "zset", Z{Score: 2, Member: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := cache.Exists(ctx, "zset"); !exists {
+		t.Fatal("sorted set expired early")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	for _, key := range []string{"zset", "string", "missing"} {
+		if exists, _ := cache.Exists(ctx, key); exists {
+			t.Errorf("%q exists after it expired", key)
+		}
+	}
+	if members, _ := cache.ZRevRangeByScoreWithScores(ctx, "zset", &ZRangeBy{Min: "-inf", Max: "+inf"}); len(members) != 0 {
+		t.Errorf("expired sorted set has members %v", members)
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a list ordered by (created_at, id)
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// EncodeCursor returns an opaque, URL-safe cursor for the given position
+func EncodeCursor(createdAt time.Time, id string) string {
+	data, _ := json.Marshal(Cursor{CreatedAt: createdAt.UTC(), ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor created by EncodeCursor
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" || cursor.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// FindPage reads up to limit rows of the query, which must be ordered by its keyset, into rows.
+// It reads one row more than limit to report whether another page follows, and drops that row.
+func FindPage[T any](query *gorm.DB, limit int, rows *[]T) (bool, error) {
+	if err := query.Limit(limit + 1).Find(rows).Error; err != nil {
+		return false, err
+	}
+	if len(*rows) > limit {
+		*rows = (*rows)[:limit]
+		return true, nil
+	}
+	return false, nil
+}
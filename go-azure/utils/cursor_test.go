@@ -0,0 +1,37 @@
+package utils_test
+
+import (
+	"testing"
+
+	"go-azure/models"
+	"go-azure/testutil"
+	"go-azure/utils"
+)
+
+func TestFindPage(t *testing.T) {
+	db := testutil.OpenDB(t)
+	for _, name := range []string{"Ada", "Bob", "Grace"} {
+		testutil.CreateUser(t, db, name)
+	}
+
+	tests := []struct {
+		limit    int
+		wantRows int
+		wantMore bool
+	}{
+		{limit: 2, wantRows: 2, wantMore: true},
+		{limit: 3, wantRows: 3, wantMore: false},
+		{limit: 5, wantRows: 3, wantMore: false},
+	}
+	for _, test := range tests {
+		var users []models.User
+		hasMore, err := utils.FindPage(db.Order("name"), test.limit, &users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != test.wantRows || hasMore != test.wantMore {
+			t.Errorf("FindPage(limit %d) = %d rows, more %v; want %d rows, more %v",
+				test.limit, len(users), hasMore, test.wantRows, test.wantMore)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-azure/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBRevocationStore is a RevocationStore in the revoked_tokens and user_token_revocations tables,
+// shared by every instance of the API
+type DBRevocationStore struct {
+	db *gorm.DB
+}
+
+// NewDBRevocationStore creates a DBRevocationStore
+func NewDBRevocationStore(db *gorm.DB) *DBRevocationStore {
+	return &DBRevocationStore{db: db}
+}
+
+// Revoke implements RevocationStore
+func (s *DBRevocationStore) Revoke(ctx context.Context, jti string, userID string, expiresAt time.Time) error {
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}).Error
+}
+
+// RevokeUser implements RevocationStore
+func (s *DBRevocationStore) RevokeUser(ctx context.Context, userID string, issuedBefore time.Time, expiresAt time.Time) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.UserTokenRevocation{UserID: userID, RevokedBefore: issuedBefore, ExpiresAt: expiresAt}).Error; err != nil {
+			return err
+		}
+		// An existing entry only ever moves forward
+		if err := tx.Model(&models.UserTokenRevocation{}).
+			Where("user_id = ? AND revoked_before < ?", userID, issuedBefore).
+			Update("revoked_before", issuedBefore).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.UserTokenRevocation{}).
+			Where("user_id = ? AND expires_at < ?", userID, expiresAt).
+			Update("expires_at", expiresAt).Error
+	})
+}
+
+// IsRevoked implements RevocationStore
+func (s *DBRevocationStore) IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (bool, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	var cutoff models.UserTokenRevocation
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&cutoff).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return revokedBefore(issuedAt, cutoff.RevokedBefore), nil
+}
+
+// Prune implements RevocationStore
+func (s *DBRevocationStore) Prune(ctx context.Context, now time.Time) (int64, error) {
+	tokens := s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.RevokedToken{})
+	if tokens.Error != nil {
+		return 0, tokens.Error
+	}
+	users := s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.UserTokenRevocation{})
+	if users.Error != nil {
+		return tokens.RowsAffected, users.Error
+	}
+	return tokens.RowsAffected + users.RowsAffected, nil
+}
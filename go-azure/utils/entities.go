@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// A hashtag starts a word and needs at least one letter, so "#1" or "a#b" are not tags
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#&])#([\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*)`)
+	// A mention starts a word, so the domain of an email address is not a mention, and the
+	// handle starts with a letter like every username, so "@10am" is not a mention either
+	mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@])@([A-Za-z][A-Za-z0-9_]*)`)
+)
+
+// MaxHashtagLength is the longest hashtag that is recorded, in characters
+const MaxHashtagLength = 100
+
+// ExtractHashtags returns the distinct hashtags in text, lowercased and without the "#",
+// in order of first appearance. Tags longer than MaxHashtagLength are ignored.
+func ExtractHashtags(text string) []string {
+	return extractEntities(hashtagPattern, text, func(tag string) bool {
+		return len([]rune(tag)) <= MaxHashtagLength
+	})
+}
+
+// ExtractMentions returns the distinct @handles in text, lowercased and without the "@",
+// in order of first appearance
+func ExtractMentions(text string) []string {
+	return extractEntities(mentionPattern, text, func(string) bool { return true })
+}
+
+func extractEntities(pattern *regexp.Regexp, text string, keep func(string) bool) []string {
+	var entities []string
+	seen := make(map[string]bool)
+	for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+		entity := strings.ToLower(match[1])
+		if !seen[entity] && keep(entity) {
+			seen[entity] = true
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
+// NormalizeHashtag lowercases a tag and strips a leading "#", as used in URLs such as /tags/:tag
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
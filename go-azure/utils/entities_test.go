@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "hi @Ada and @grace_h, @ada again", want: []string{"ada", "grace_h"}},
+		{text: "mail ada@example.com", want: nil},
+		{text: "see you @10am or @_ada", want: nil},
+		{text: "(@ada2)", want: []string{"ada2"}},
+	}
+	for _, test := range tests {
+		if got := ExtractMentions(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("ExtractMentions(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+
+	// Registers PNG for image.DecodeConfig
+	_ "image/png"
+)
+
+var (
+	// ErrUnsupportedImage is returned for images that cannot be parsed
+	ErrUnsupportedImage = errors.New("unsupported or corrupt image")
+	// ErrImageTooLarge is returned for animated GIFs with too many frames or pixels to decode
+	ErrImageTooLarge = errors.New("image has too many frames or pixels")
+)
+
+const (
+	// jpegQuality is used when a JPEG has to be re-encoded to apply its EXIF orientation
+	jpegQuality = 92
+	// maxGIFFrames and maxGIFPixels bound the memory used to decode an animated GIF, which
+	// holds every frame at once; maxGIFPixels counts the pixels of all frames together
+	maxGIFFrames = 500
+	maxGIFPixels = 100_000_000
+)
+
+// StripImageMetadata removes EXIF, XMP, IPTC, comments and text chunks from an image so
+// uploads do not leak camera details or GPS coordinates. JPEG and PNG are rewritten without
+// the metadata segments and keep their pixels untouched, except that a JPEG with an EXIF
+// orientation is rotated and re-encoded since the orientation tag is removed with the EXIF.
+// GIF is decoded and re-encoded losslessly, which drops its comment and application blocks.
+func StripImageMetadata(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEGMetadata(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	case "image/gif":
+		return stripGIFMetadata(data)
+	default:
+		return nil, ErrUnsupportedImage
+	}
+}
+
+// JPEG markers
+const (
+	jpegSOI  = 0xD8
+	jpegEOI  = 0xD9
+	jpegSOS  = 0xDA
+	jpegAPP1 = 0xE1 // EXIF and XMP
+	jpegAPPD = 0xED // Photoshop IRB and IPTC
+	jpegCOM  = 0xFE
+)
+
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegSOI {
+		return nil, ErrUnsupportedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	orientation := 1
+	i := 2
+	for {
+		// Skip fill bytes before the marker
+		for i < len(data) && data[i] == 0xFF && i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return nil, ErrUnsupportedImage
+		}
+
+		marker := data[i+1]
+		if marker == jpegEOI {
+			out.Write(data[i : i+2])
+			break
+		}
+		// Markers without a length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, ErrUnsupportedImage
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, ErrUnsupportedImage
+		}
+		segment := data[i:end]
+
+		if marker == jpegSOS {
+			// Entropy-coded data follows up to EOI; copy it all
+			out.Write(data[i:])
+			break
+		}
+
+		switch marker {
+		case jpegAPP1:
+			if value, ok := exifOrientation(segment[4:]); ok {
+				orientation = value
+			}
+		case jpegAPPD, jpegCOM:
+		default:
+			out.Write(segment)
+		}
+		i = end
+	}
+
+	if orientation == 1 {
+		return out.Bytes(), nil
+	}
+
+	// Rotate the pixels now that the tag telling viewers to do so is gone
+	img, err := jpeg.Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	var rotated bytes.Buffer
+	if err := jpeg.Encode(&rotated, applyOrientation(img, orientation), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return rotated.Bytes(), nil
+}
+
+// exifOrientation reads the orientation tag (0x0112) from the IFD0 of an APP1 EXIF payload
+func exifOrientation(payload []byte) (int, bool) {
+	if len(payload) < 14 || string(payload[:6]) != "Exif\x00\x00" {
+		return 0, false
+	}
+	tiff := payload[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if value < 1 || value > 8 {
+				return 0, false
+			}
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// applyOrientation transforms img so it displays upright for the given EXIF orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	var dst *image.RGBA
+	if orientation >= 5 {
+		// Orientations 5-8 swap width and height
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			i := src.PixOffset(x, y)
+			j := dst.PixOffset(dx, dy)
+			copy(dst.Pix[j:j+4], src.Pix[i:i+4])
+		}
+	}
+	return dst
+}
+
+// pngMetadataChunks are the ancillary PNG chunks that carry metadata
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if len(data) < len(signature) || string(data[:len(signature)]) != signature {
+		return nil, ErrUnsupportedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString(signature)
+
+	i := len(signature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, ErrUnsupportedImage
+		}
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrUnsupportedImage
+		}
+		if crc32.ChecksumIEEE(data[i+4:i+8+length]) != binary.BigEndian.Uint32(data[i+8+length:end]) {
+			return nil, ErrUnsupportedImage
+		}
+
+		if !pngMetadataChunks[chunkType] {
+			out.Write(data[i:end])
+		}
+		i = end
+
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func stripGIFMetadata(data []byte) ([]byte, error) {
+	if err := checkGIFSize(data); err != nil {
+		return nil, err
+	}
+
+	img, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	var out bytes.Buffer
+	if err := gif.EncodeAll(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// checkGIFSize walks the blocks of a GIF without decoding them and returns ErrImageTooLarge when
+// it has more than maxGIFFrames frames or more than maxGIFPixels pixels over all frames
+func checkGIFSize(data []byte) error {
+	// Header and logical screen descriptor
+	const headerSize = 13
+	if len(data) < headerSize || !bytes.HasPrefix(data, []byte("GIF8")) {
+		return ErrUnsupportedImage
+	}
+	i := headerSize + colorTableSize(data[10])
+
+	frames := 0
+	var pixels int64
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension: label, then data sub-blocks
+			if i+2 > len(data) {
+				return ErrUnsupportedImage
+			}
+			i = skipGIFSubBlocks(data, i+2)
+		case 0x2C: // image descriptor, optional local color table, LZW code size, data sub-blocks
+			if i+10 > len(data) {
+				return ErrUnsupportedImage
+			}
+			width := int64(binary.LittleEndian.Uint16(data[i+5 : i+7]))
+			height := int64(binary.LittleEndian.Uint16(data[i+7 : i+9]))
+			frames++
+			pixels += width * height
+			if frames > maxGIFFrames || pixels > maxGIFPixels {
+				return ErrImageTooLarge
+			}
+			i = skipGIFSubBlocks(data, i+10+colorTableSize(data[i+9])+1)
+		case 0x3B: // trailer
+			return nil
+		default:
+			return ErrUnsupportedImage
+		}
+		if i < 0 {
+			return ErrUnsupportedImage
+		}
+	}
+	// A GIF cut short is left for the decoder to reject
+	return nil
+}
+
+// colorTableSize is the size in bytes of the color table announced by a packed fields byte
+func colorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
+
+// skipGIFSubBlocks returns the offset after the data sub-blocks starting at i, or -1 when they
+// run past the end of data
+func skipGIFSubBlocks(data []byte, i int) int {
+	for i < len(data) {
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
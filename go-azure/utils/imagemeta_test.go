@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// encodeGIF returns an animated GIF of frames frames of width by height pixels
+func encodeGIF(t *testing.T, frames int, width int, height int) []byte {
+	t.Helper()
+
+	animation := &gif.GIF{}
+	for range frames {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White})
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var out bytes.Buffer
+	if err := gif.EncodeAll(&out, animation); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestStripGIFMetadataBoundsFrames(t *testing.T) {
+	if _, err := StripImageMetadata("image/gif", encodeGIF(t, 3, 16, 16)); err != nil {
+		t.Errorf("small animation: %v", err)
+	}
+
+	if _, err := StripImageMetadata("image/gif", encodeGIF(t, maxGIFFrames+1, 1, 1)); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("too many frames error = %v, want %v", err, ErrImageTooLarge)
+	}
+
+	// One 4000x4000 frame is accepted but ten of them are 160 million pixels
+	if _, err := StripImageMetadata("image/gif", encodeGIF(t, 1, 4000, 4000)); err != nil {
+		t.Errorf("one large frame: %v", err)
+	}
+	if _, err := StripImageMetadata("image/gif", encodeGIF(t, 10, 4000, 4000)); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("too many pixels error = %v, want %v", err, ErrImageTooLarge)
+	}
+}
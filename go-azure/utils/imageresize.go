@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"image"
+	"image/draw"
+)
+
+// ResizeImage scales src down to width x height with a box filter: every output pixel is the
+// average of the source pixels it covers. It is meant for downscaling; upscaling repeats pixels.
+func ResizeImage(src image.Image, width int, height int) *image.RGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	// Work on RGBA pixels directly instead of calling At for every pixel
+	rgba, ok := src.(*image.RGBA)
+	if !ok || rgba.Rect.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for dy := 0; dy < height; dy++ {
+		y0 := dy * srcHeight / height
+		y1 := max((dy+1)*srcHeight/height, y0+1)
+
+		for dx := 0; dx < width; dx++ {
+			x0 := dx * srcWidth / width
+			x1 := max((dx+1)*srcWidth/width, x0+1)
+
+			var r, g, b, a, n uint32
+			for y := y0; y < y1; y++ {
+				row := rgba.Pix[y*rgba.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i] = uint8((r + n/2) / n)
+			dst.Pix[i+1] = uint8((g + n/2) / n)
+			dst.Pix[i+2] = uint8((b + n/2) / n)
+			dst.Pix[i+3] = uint8((a + n/2) / n)
+		}
+	}
+
+	return dst
+}
+
+// FitWidth returns the height that keeps the aspect ratio of a srcWidth x srcHeight image at width
+func FitWidth(srcWidth int, srcHeight int, width int) int {
+	return max((srcHeight*width+srcWidth/2)/srcWidth, 1)
+}
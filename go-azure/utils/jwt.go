@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,18 +18,19 @@ type CustomClaims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
 	Name   string `json:"name"`
+	Role   string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token for a user
-func GenerateToken(userID string, email string, name string, secret string, expirationMinutes int) (*models.TokenDetails, error) {
+// GenerateToken generates a new JWT token for a user, signed with the active key of the ring
+func GenerateToken(userID string, email string, name string, role string, keys *KeyRing, expirationMinutes int) (*models.TokenDetails, error) {
 	// Create token details
 	expiresAt := time.Now().Add(time.Minute * time.Duration(expirationMinutes))
 	td := &models.TokenDetails{
 		TokenType:    "Bearer",
 		ExpiresIn:    int64(expirationMinutes * 60), // Convert to seconds
 		ExpiresAt:    expiresAt,
-		RefreshToken: uuid.New().String(),
+		RefreshToken: rand.Text(),
 	}
 
 	// Create claims with registered claims for better security
@@ -35,6 +38,7 @@ func GenerateToken(userID string, email string, name string, secret string, expi
 		UserID: userID,
 		Email:  email,
 		Name:   name,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -46,12 +50,9 @@ func GenerateToken(userID string, email string, name string, secret string, expi
 		},
 	}
 
-	// Create token with custom claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
 	// Sign token
 	var err error
-	td.AccessToken, err = token.SignedString([]byte(secret))
+	td.AccessToken, err = keys.Sign(claims)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to sign JWT token")
 		return nil, err
@@ -60,16 +61,18 @@ func GenerateToken(userID string, email string, name string, secret string, expi
 	return td, nil
 }
 
-// ValidateToken validates a JWT token
-func ValidateToken(tokenString string, secret string) (jwt.MapClaims, error) {
+// HashRefreshToken returns the SHA-256 hash under which a refresh token is stored. Login codes,
+// stream tickets and personal access tokens are stored under it too. All of them are random, so
+// an unsalted fast hash is enough.
+func HashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateToken validates a JWT token against the key of the ring named by its kid header
+func ValidateToken(tokenString string, keys *KeyRing) (jwt.MapClaims, error) {
 	// Parse token with custom claims
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, keys.Keyfunc, jwt.WithValidMethods([]string{keys.Algorithm()}))
 
 	if err != nil {
 		logrus.WithError(err).Error("Failed to parse JWT token")
@@ -92,6 +95,7 @@ func ValidateToken(tokenString string, secret string) (jwt.MapClaims, error) {
 		"user_id": claims.UserID,
 		"email":   claims.Email,
 		"name":    claims.Name,
+		"role":    claims.Role,
 		"exp":     claims.ExpiresAt.Time.Unix(),
 		"iat":     claims.IssuedAt.Time.Unix(),
 		"sub":     claims.Subject,
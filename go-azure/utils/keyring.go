@@ -0,0 +1,348 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go-azure/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrUnknownSigningKey is returned for tokens without a kid or signed with a key the ring does not hold
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+const (
+	// minRSAKeyBits is the smallest RSA key accepted for signing
+	minRSAKeyBits = 2048
+	// keyReloadInterval limits how often a token with an unknown kid reloads the key directory,
+	// which picks up a key another instance has started signing with
+	keyReloadInterval = 10 * time.Second
+)
+
+// signingKey is a key of a KeyRing
+type signingKey struct {
+	id         string
+	privateKey interface{} // the key tokens are signed with
+	publicKey  interface{} // the key signatures are verified with
+	jwk        *JWK        // the published public key; nil for HS256 secrets
+	// retiredUntil is when a key that no longer signs stops verifying, once every token it signed
+	// has expired. Zero for the active key and the keys in the key directory.
+	retiredUntil time.Time
+}
+
+// KeyRing holds the keys access tokens are signed and verified with. One key signs new tokens and
+// every token names it in its kid header. Keys that are replaced keep verifying the tokens they
+// signed until those expire.
+//
+// With RS256 or EdDSA, the keys are the PEM private keys in a directory, the file that sorts last
+// signing, so a key is rotated by adding a file that sorts after the others. Without a directory,
+// keys are generated at startup and rotated on an interval; they are lost on restart and differ
+// between instances. HS256 signs with the shared secret and publishes no keys.
+type KeyRing struct {
+	mu               sync.RWMutex
+	method           jwt.SigningMethod
+	dir              string
+	tokenLifetime    time.Duration
+	rotationInterval time.Duration
+	keys             map[string]*signingKey
+	active           *signingKey
+	rotatedAt        time.Time // when the active key was generated
+	reloadedAt       time.Time // when the key directory was last read
+}
+
+// NewKeyRing creates the KeyRing for cfg.JWTSigningAlgorithm, loading the keys in cfg.JWTKeysDir
+// or generating one
+func NewKeyRing(cfg *config.Config) (*KeyRing, error) {
+	ring := &KeyRing{
+		dir:              cfg.JWTKeysDir,
+		tokenLifetime:    time.Duration(cfg.JWTExpirationMinutes) * time.Minute,
+		rotationInterval: time.Duration(cfg.JWTKeyRotationHours) * time.Hour,
+		keys:             make(map[string]*signingKey),
+	}
+	if ring.rotationInterval <= 0 {
+		ring.rotationInterval = 24 * time.Hour
+	}
+
+	switch cfg.JWTSigningAlgorithm {
+	case "HS256":
+		if cfg.JWTSecret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		ring.method = jwt.SigningMethodHS256
+		sum := sha256.Sum256([]byte(cfg.JWTSecret))
+		key := &signingKey{
+			id:         "hs-" + base64.RawURLEncoding.EncodeToString(sum[:8]),
+			privateKey: []byte(cfg.JWTSecret),
+			publicKey:  []byte(cfg.JWTSecret),
+		}
+		ring.keys[key.id] = key
+		ring.active = key
+		return ring, nil
+	case "RS256":
+		ring.method = jwt.SigningMethodRS256
+	case "EdDSA":
+		ring.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unknown JWT signing algorithm %q", cfg.JWTSigningAlgorithm)
+	}
+
+	if ring.dir != "" {
+		if err := ring.loadDir(time.Now()); err != nil {
+			return nil, err
+		}
+		return ring, nil
+	}
+
+	logrus.Warn("JWT_KEYS_DIR is not set; signing with generated keys, which are lost on restart")
+	if err := ring.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Algorithm returns the JWS algorithm tokens are signed with
+func (r *KeyRing) Algorithm() string {
+	return r.method.Alg()
+}
+
+// Sign signs the claims with the active key, naming it in the kid header
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	key := r.active
+	r.mu.RUnlock()
+
+	token := jwt.NewWithClaims(r.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.privateKey)
+}
+
+// Keyfunc returns the key to verify the token with, for jwt.Parse. Tokens naming a key the ring
+// does not hold reload the key directory, at most every keyReloadInterval.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != r.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownSigningKey
+	}
+
+	now := time.Now()
+	key, ok := r.key(kid, now)
+	if !ok && r.dir != "" {
+		r.mu.RLock()
+		due := now.Sub(r.reloadedAt) >= keyReloadInterval
+		r.mu.RUnlock()
+		if due {
+			if err := r.loadDir(now); err != nil {
+				logrus.WithError(err).Error("Failed to reload JWT signing keys")
+			}
+			key, ok = r.key(kid, now)
+		}
+	}
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+	return key.publicKey, nil
+}
+
+// key returns the key with the kid unless it was retired and its tokens have expired
+func (r *KeyRing) key(kid string, now time.Time) (*signingKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[kid]
+	if !ok || (!key.retiredUntil.IsZero() && now.After(key.retiredUntil)) {
+		return nil, false
+	}
+	return key, true
+}
+
+// JWKS returns the public keys tokens are verified with, ordered by key ID. It is empty for HS256.
+func (r *KeyRing) JWKS() JWKS {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range r.keys {
+		if key.jwk != nil {
+			set.Keys = append(set.Keys, *key.jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+// Maintain drops retired keys whose tokens have all expired, then reloads the key directory or,
+// with generated keys, rotates the active key when it is due
+func (r *KeyRing) Maintain(now time.Time) error {
+	if r.method == jwt.SigningMethodHS256 {
+		return nil
+	}
+
+	r.mu.Lock()
+	for kid, key := range r.keys {
+		if !key.retiredUntil.IsZero() && now.After(key.retiredUntil) {
+			delete(r.keys, kid)
+		}
+	}
+	due := now.Sub(r.rotatedAt) >= r.rotationInterval
+	r.mu.Unlock()
+
+	if r.dir != "" {
+		return r.loadDir(now)
+	}
+	if due {
+		return r.rotate(now)
+	}
+	return nil
+}
+
+// rotate generates a key to sign with. The key it replaces verifies the tokens it signed until
+// they expire.
+func (r *KeyRing) rotate(now time.Time) error {
+	var privateKey crypto.Signer
+	var err error
+	switch r.method {
+	case jwt.SigningMethodRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	default:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	key, err := r.newSigningKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active != nil {
+		r.active.retiredUntil = now.Add(r.tokenLifetime)
+	}
+	r.keys[key.id] = key
+	r.active = key
+	r.rotatedAt = now
+	logrus.WithField("kid", key.id).Info("JWT signing key rotated")
+	return nil
+}
+
+// loadDir reads the keys in the key directory. Keys whose files were removed are retired.
+func (r *KeyRing) loadDir(now time.Time) error {
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no *.pem keys in %s", r.dir)
+	}
+	sort.Strings(paths)
+
+	keys := make(map[string]*signingKey, len(paths))
+	var active *signingKey
+	for _, path := range paths {
+		key, err := r.readKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		keys[key.id] = key
+		active = key
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for kid, key := range r.keys {
+		if _, ok := keys[kid]; ok {
+			continue
+		}
+		if key.retiredUntil.IsZero() {
+			key.retiredUntil = now.Add(r.tokenLifetime)
+		}
+		keys[kid] = key
+	}
+	if r.active == nil || r.active.id != active.id {
+		logrus.WithField("kid", active.id).Info("JWT signing key loaded")
+	}
+	r.keys = keys
+	r.active = active
+	r.reloadedAt = now
+	return nil
+}
+
+// readKey reads a PEM encoded PKCS #8 or PKCS #1 private key for the ring's algorithm
+func (r *KeyRing) readKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var privateKey interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if r.method != jwt.SigningMethodRS256 {
+			return nil, errors.New("RSA key cannot sign " + r.method.Alg())
+		}
+		if privateKey.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must have at least %d bits", minRSAKeyBits)
+		}
+		return r.newSigningKey(privateKey)
+	case ed25519.PrivateKey:
+		if r.method != jwt.SigningMethodEdDSA {
+			return nil, errors.New("Ed25519 key cannot sign " + r.method.Alg())
+		}
+		return r.newSigningKey(privateKey)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+}
+
+// newSigningKey wraps a private key, identified by the thumbprint of its public key
+func (r *KeyRing) newSigningKey(privateKey crypto.Signer) (*signingKey, error) {
+	jwk, err := NewJWK(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	jwk.Use = "sig"
+	jwk.Algorithm = r.method.Alg()
+	return &signingKey{
+		id:         jwk.KeyID,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public(),
+		jwk:        &jwk,
+	}, nil
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-azure/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestKeyRing creates a KeyRing generating EdDSA keys, whose tokens live 15 minutes
+func newTestKeyRing(t *testing.T) *KeyRing {
+	t.Helper()
+
+	ring, err := NewKeyRing(&config.Config{JWTSigningAlgorithm: "EdDSA", JWTExpirationMinutes: 15, JWTKeyRotationHours: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+// signTestToken returns a token of the ring's active key and the key's ID
+func signTestToken(t *testing.T, ring *KeyRing) (string, string) {
+	t.Helper()
+
+	details, err := GenerateToken("user-1", "ada@example.com", "Ada", "user", ring, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(details.AccessToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return details.AccessToken, token.Header["kid"].(string)
+}
+
+func TestKeyRingRotationRetiresOldKeys(t *testing.T) {
+	ring := newTestKeyRing(t)
+	now := time.Now()
+
+	first, firstKid := signTestToken(t, ring)
+	if err := ring.rotate(now); err != nil {
+		t.Fatal(err)
+	}
+	second, secondKid := signTestToken(t, ring)
+	if secondKid == firstKid {
+		t.Fatal("rotation kept signing with the old key")
+	}
+	if _, err := ValidateToken(first, ring); err != nil {
+		t.Errorf("token of the replaced key: %v", err)
+	}
+	if keys := ring.JWKS().Keys; len(keys) != 2 {
+		t.Errorf("JWKS has %d keys, want 2 while the replaced key verifies", len(keys))
+	}
+
+	// A key replaced a token lifetime ago no longer verifies, though it is still held
+	if err := ring.rotate(now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(second, ring); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("token of a key retired in the past = %v, want %v", err, ErrUnknownSigningKey)
+	}
+	if _, err := ValidateToken(first, ring); err != nil {
+		t.Errorf("token of a key retired until later: %v", err)
+	}
+
+	// Once every token of the first key has expired, maintenance drops both retired keys
+	if err := ring.Maintain(now.Add(16 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if keys := ring.JWKS().Keys; len(keys) != 1 {
+		t.Errorf("JWKS has %d keys after maintenance, want 1", len(keys))
+	}
+	if _, err := ValidateToken(first, ring); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("token of a dropped key = %v, want %v", err, ErrUnknownSigningKey)
+	}
+}
+
+func TestKeyRingRejectsUnknownKeys(t *testing.T) {
+	ring := newTestKeyRing(t)
+	other := newTestKeyRing(t)
+
+	foreign, _ := signTestToken(t, other)
+	if _, err := ValidateToken(foreign, ring); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("token of another ring = %v, want %v", err, ErrUnknownSigningKey)
+	}
+
+	// A token without a kid is rejected even when signed with the active key
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()})
+	noKid, err := token.SignedString(ring.active.privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(noKid, ring); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("token without a kid = %v, want %v", err, ErrUnknownSigningKey)
+	}
+}
+
+func TestKeyRingHS256PublishesNoKeys(t *testing.T) {
+	ring, err := NewKeyRing(&config.Config{JWTSigningAlgorithm: "HS256", JWTSecret: "test-secret", JWTExpirationMinutes: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := ring.JWKS()
+	if set.Keys == nil || len(set.Keys) != 0 {
+		t.Errorf("JWKS keys = %#v, want an empty list", set.Keys)
+	}
+	token, _ := signTestToken(t, ring)
+	if _, err := ValidateToken(token, ring); err != nil {
+		t.Errorf("HS256 token: %v", err)
+	}
+}
+
+func TestKeyRingLoadsKeyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeKey := func(name string) {
+		t.Helper()
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeKey("2024-01.pem")
+	ring, err := NewKeyRing(&config.Config{JWTSigningAlgorithm: "EdDSA", JWTKeysDir: dir, JWTExpirationMinutes: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, firstKid := signTestToken(t, ring)
+
+	// The key that sorts last signs
+	writeKey("2024-02.pem")
+	if err := ring.Maintain(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	_, secondKid := signTestToken(t, ring)
+	if secondKid == firstKid {
+		t.Fatal("added key does not sign")
+	}
+
+	// A removed key keeps verifying its tokens until they expire
+	if err := os.Remove(filepath.Join(dir, "2024-01.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ring.Maintain(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(first, ring); err != nil {
+		t.Errorf("token of a removed key: %v", err)
+	}
+	if err := ring.Maintain(time.Now().Add(16 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(first, ring); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("token of a removed key after its tokens expired = %v, want %v", err, ErrUnknownSigningKey)
+	}
+}
@@ -0,0 +1,26 @@
+package utils
+
+import "encoding/json"
+
+// Optional is a field of a partial update that tells a field left out of the JSON body apart from
+// one sent as null, which clears it
+type Optional[T any] struct {
+	Set   bool // the field was sent
+	Value *T   // the value sent; nil when it was null
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It is only called for fields present in the body.
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+	return nil
+}
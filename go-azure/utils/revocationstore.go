@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-azure/config"
+)
+
+// RevocationStore remembers revoked access tokens until they expire
+type RevocationStore interface {
+	// Revoke revokes the token with the jti until it expires
+	Revoke(ctx context.Context, jti string, userID string, expiresAt time.Time) error
+	// RevokeUser revokes every token of the user issued at or before issuedBefore. The entry is
+	// kept until expiresAt, when all of those tokens have expired. An earlier cutoff never
+	// replaces a later one.
+	RevokeUser(ctx context.Context, userID string, issuedBefore time.Time, expiresAt time.Time) error
+	// IsRevoked reports whether the token was revoked by its jti or with every token of its user
+	IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (bool, error)
+	// Prune removes the entries of tokens that expired before now and returns how many were removed
+	Prune(ctx context.Context, now time.Time) (int64, error)
+}
+
+// NewRevocationStore creates the RevocationStore selected by cfg.TokenRevocationStore
+func NewRevocationStore(cfg *config.Config) (RevocationStore, error) {
+	switch cfg.TokenRevocationStore {
+	case "memory":
+		return NewMemoryRevocationStore(), nil
+	case "database":
+		return NewDBRevocationStore(GetDB()), nil
+	default:
+		return nil, fmt.Errorf("unknown token revocation store %q", cfg.TokenRevocationStore)
+	}
+}
+
+// revokedBefore reports whether a token issued at issuedAt falls under a cutoff. Token
+// timestamps have second precision, so tokens issued in the cutoff's second are revoked too.
+func revokedBefore(issuedAt time.Time, cutoff time.Time) bool {
+	return !issuedAt.After(cutoff.Truncate(time.Second))
+}
+
+// MemoryRevocationStore is an in-process RevocationStore. Revocations are lost when the process
+// exits and are not shared between instances, so it is meant for development and single instances.
+type MemoryRevocationStore struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time        // jti -> token expiry
+	users  map[string]memoryUserCutoff // user ID -> cutoff
+}
+
+type memoryUserCutoff struct {
+	revokedBefore time.Time
+	expiresAt     time.Time
+}
+
+// NewMemoryRevocationStore creates an empty MemoryRevocationStore
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]memoryUserCutoff),
+	}
+}
+
+// Revoke implements RevocationStore
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, jti string, userID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+// RevokeUser implements RevocationStore
+func (s *MemoryRevocationStore) RevokeUser(ctx context.Context, userID string, issuedBefore time.Time, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.users[userID]
+	if issuedBefore.After(cutoff.revokedBefore) {
+		cutoff.revokedBefore = issuedBefore
+	}
+	if expiresAt.After(cutoff.expiresAt) {
+		cutoff.expiresAt = expiresAt
+	}
+	s.users[userID] = cutoff
+	return nil
+}
+
+// IsRevoked implements RevocationStore
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[jti]; ok {
+		return true, nil
+	}
+	if cutoff, ok := s.users[userID]; ok && revokedBefore(issuedAt, cutoff.revokedBefore) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// Prune implements RevocationStore
+func (s *MemoryRevocationStore) Prune(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pruned int64
+	for jti, expiresAt := range s.tokens {
+		if expiresAt.Before(now) {
+			delete(s.tokens, jti)
+			pruned++
+		}
+	}
+	for userID, cutoff := range s.users {
+		if cutoff.expiresAt.Before(now) {
+			delete(s.users, userID)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
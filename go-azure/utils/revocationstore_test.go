@@ -0,0 +1,150 @@
+package utils_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-azure/testutil"
+	"go-azure/utils"
+)
+
+// revocationStores creates each RevocationStore, the database one on an empty database
+var revocationStores = map[string]func(t *testing.T) utils.RevocationStore{
+	"memory": func(t *testing.T) utils.RevocationStore { return utils.NewMemoryRevocationStore() },
+	"database": func(t *testing.T) utils.RevocationStore {
+		return utils.NewDBRevocationStore(testutil.OpenDB(t))
+	},
+}
+
+func TestRevocationStoreRevoke(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	for name, newStore := range revocationStores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			if err := store.Revoke(ctx, "jti-1", "user-1", now.Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			// Revoking twice, as a repeated sign-out does, is not an error
+			if err := store.Revoke(ctx, "jti-1", "user-1", now.Add(time.Hour)); err != nil {
+				t.Fatalf("Revoke again: %v", err)
+			}
+
+			tests := []struct {
+				jti  string
+				want bool
+			}{
+				{jti: "jti-1", want: true},
+				{jti: "jti-2", want: false},
+			}
+			for _, test := range tests {
+				revoked, err := store.IsRevoked(ctx, test.jti, "user-1", now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if revoked != test.want {
+					t.Errorf("IsRevoked(%q) = %v, want %v", test.jti, revoked, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRevocationStoreRevokeUser(t *testing.T) {
+	ctx := context.Background()
+	// Tokens carry their issue time in whole seconds, unlike the cutoff
+	second := time.Now().Truncate(time.Second)
+	cutoff := second.Add(500 * time.Millisecond)
+	for name, newStore := range revocationStores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			if err := store.RevokeUser(ctx, "user-1", cutoff, cutoff.Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			// An earlier cutoff does not replace the later one
+			if err := store.RevokeUser(ctx, "user-1", cutoff.Add(-time.Hour), cutoff.Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name     string
+				userID   string
+				issuedAt time.Time
+				want     bool
+			}{
+				{name: "issued before the cutoff", userID: "user-1", issuedAt: cutoff.Add(-time.Minute), want: true},
+				{name: "issued in the cutoff's second", userID: "user-1", issuedAt: second, want: true},
+				{name: "issued after the cutoff", userID: "user-1", issuedAt: second.Add(time.Second), want: false},
+				{name: "another user", userID: "user-2", issuedAt: cutoff.Add(-time.Minute), want: false},
+			}
+			for _, test := range tests {
+				revoked, err := store.IsRevoked(ctx, "jti", test.userID, test.issuedAt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if revoked != test.want {
+					t.Errorf("%s: IsRevoked = %v, want %v", test.name, revoked, test.want)
+				}
+			}
+
+			// Nor does its earlier expiry shorten how long the cutoff is kept
+			if _, err := store.Prune(ctx, cutoff.Add(30*time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if revoked, _ := store.IsRevoked(ctx, "jti", "user-1", cutoff.Add(-time.Minute)); !revoked {
+				t.Error("cutoff was pruned before its latest expiry")
+			}
+		})
+	}
+}
+
+func TestRevocationStorePruneKeepsUnexpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	for name, newStore := range revocationStores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			if err := store.Revoke(ctx, "expired", "user-1", now.Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Revoke(ctx, "live", "user-1", now.Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.RevokeUser(ctx, "user-expired", now.Add(-time.Hour), now.Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.RevokeUser(ctx, "user-live", now.Add(-time.Hour), now.Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+
+			pruned, err := store.Prune(ctx, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pruned != 2 {
+				t.Errorf("Prune = %d, want 2", pruned)
+			}
+
+			tests := []struct {
+				jti    string
+				userID string
+				want   bool
+			}{
+				{jti: "expired", userID: "user-1", want: false},
+				{jti: "live", userID: "user-1", want: true},
+				{jti: "other", userID: "user-expired", want: false},
+				{jti: "other", userID: "user-live", want: true},
+			}
+			for _, test := range tests {
+				revoked, err := store.IsRevoked(ctx, test.jti, test.userID, now.Add(-2*time.Hour))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if revoked != test.want {
+					t.Errorf("IsRevoked(%q, %q) after Prune = %v, want %v", test.jti, test.userID, revoked, test.want)
+				}
+			}
+		})
+	}
+}
@@ -22,16 +22,51 @@ apiClient.interceptors.request.use(
   }
 )
 
+// Exchanges the stored refresh token for new tokens. Concurrent callers share one request,
+// since a refresh token can only be used once.
+let refreshing = null
+const refreshTokens = () => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem('refresh_token')
+    refreshing = (refreshToken
+      ? axios.post(`${import.meta.env.VITE_API_URL}/auth/refresh`, { refresh_token: refreshToken })
+      : Promise.reject(new Error('No refresh token')))
+      .then(response => {
+        localStorage.setItem('access_token', response.data.access_token)
+        localStorage.setItem('refresh_token', response.data.refresh_token)
+        return response.data.access_token
+      })
+      .finally(() => {
+        refreshing = null
+      })
+  }
+  return refreshing
+}
+
 // Add response interceptor to handle common errors
 apiClient.interceptors.response.use(
   response => {
     return response
   },
-  error => {
+  async error => {
     // Handle 401 Unauthorized errors (token expired, etc.)
     if (error.response && error.response.status === 401) {
+      // Retry once with a refreshed access token
+      const request = error.config
+      if (!request._retried) {
+        request._retried = true
+        try {
+          const accessToken = await refreshTokens()
+          request.headers.Authorization = `Bearer ${accessToken}`
+          return apiClient(request)
+        } catch (refreshError) {
+          // Fall through to a new login
+        }
+      }
+
       // Clear auth data
       localStorage.removeItem('access_token')
+      localStorage.removeItem('refresh_token')
       // Redirect to login page
       window.location.href = '/login'
     }
@@ -42,11 +77,49 @@ apiClient.interceptors.response.use(
 export default {
   // Auth endpoints
   auth: {
-    getMicrosoftLoginUrl() {
-      return apiClient.get('/auth/microsoft')
+    getProviders() {
+      return apiClient.get('/auth/providers')
+    },
+    getLoginUrl(provider, loginHint) {
+      return apiClient.get(`/auth/${provider}`, {
+        params: loginHint ? { login_hint: loginHint } : undefined,
+        withCredentials: true
+      })
+    },
+    // Links the identity the signed-in user logs in with next to their account
+    getLinkUrl(provider) {
+      return apiClient.post(`/auth/${provider}/link`, undefined, { withCredentials: true })
+    },
+    getIdentities() {
+      return apiClient.get('/auth/identities')
+    },
+    getTokens() {
+      return apiClient.get('/auth/tokens')
     },
-    signOut() {
-      return apiClient.post('/auth/signout')
+    // Creates a personal access token; the response is the only time the token is shown
+    createToken(name, scopes, expiresAt) {
+      return apiClient.post('/auth/tokens', { name, scopes, expires_at: expiresAt || undefined })
+    },
+    revokeToken(tokenId) {
+      return apiClient.delete(`/auth/tokens/${tokenId}`)
+    },
+    getCurrentUser() {
+      return apiClient.get('/auth/me')
+    },
+    // Accepts any of name, bio and avatar_media_id; an empty avatar_media_id removes the avatar
+    updateProfile(profile) {
+      return apiClient.patch('/auth/me', profile)
+    },
+    exchangeCode(code) {
+      return apiClient.post('/auth/exchange', { code })
+    },
+    // Revokes the access token, and the refresh tokens of this login when one is given
+    signOut(refreshToken) {
+      return apiClient.post('/auth/signout', refreshToken ? { refresh_token: refreshToken } : undefined)
+    },
+    // Revokes every token issued at or before `before` (an ISO date string), or now when omitted
+    signOutEverywhere(before) {
+      return apiClient.post('/auth/signout-all', before ? { before } : undefined)
     }
   },
 
@@ -61,8 +134,9 @@ export default {
     create(task) {
       return apiClient.post('/tasks', task)
     },
+    // Changes only the fields present in `task`
     update(id, task) {
-      return apiClient.put(`/tasks/${id}`, task)
+      return apiClient.patch(`/tasks/${id}`, task)
     },
     delete(id) {
       return apiClient.delete(`/tasks/${id}`)
@@ -77,6 +151,12 @@ export default {
     getById(id) {
       return apiClient.get(`/posts/${id}`)
     },
+    feed(cursor, limit = 10, direction = 'next') {
+      return apiClient.get('/posts/feed', { params: { cursor, limit, direction } })
+    },
+    search(searchtext, params = {}) {
+      return apiClient.get('/posts/search', { params: { colname: 'post_text', searchtext, ...params } })
+    },
     create(post) {
       return apiClient.post('/posts', post)
     },
@@ -85,6 +165,142 @@ export default {
     },
     delete(id) {
       return apiClient.delete(`/posts/${id}`)
+    },
+    like(id) {
+      return apiClient.post(`/posts/${id}/like`)
+    },
+    unlike(id) {
+      return apiClient.delete(`/posts/${id}/like`)
+    },
+    react(id, type) {
+      return apiClient.put(`/posts/${id}/reaction`, { type })
+    },
+    unreact(id) {
+      return apiClient.delete(`/posts/${id}/reaction`)
+    }
+  },
+
+  // Hashtag endpoints
+  tags: {
+    posts(tag, cursor, limit = 10) {
+      return apiClient.get(`/tags/${encodeURIComponent(tag)}`, { params: { cursor, limit } })
+    },
+    trending(hours, limit = 10) {
+      return apiClient.get('/tags/trending', { params: { hours, limit } })
+    }
+  },
+
+  // Reaction endpoints
+  reactions: {
+    types() {
+      return apiClient.get('/reactions')
+    }
+  },
+
+  // Media endpoints
+  media: {
+    upload(file) {
+      const formData = new FormData()
+      formData.append('file', file)
+      return apiClient.post('/media', formData, {
+        headers: { 'Content-Type': 'multipart/form-data' }
+      })
+    },
+    url(path) {
+      return `${import.meta.env.VITE_API_URL}${path}`
+    },
+    // srcset attribute for a post's image, with absolute URLs
+    srcset(image) {
+      return image.variants.map(variant => `${this.url(variant.url)} ${variant.width}w`).join(', ')
+    }
+  },
+
+  // Follow graph and home feed endpoints
+  users: {
+    follow(userId) {
+      return apiClient.post(`/users/${userId}/follow`)
+    },
+    unfollow(userId) {
+      return apiClient.delete(`/users/${userId}/follow`)
+    },
+    followers(userId, page = 1, limit = 20) {
+      return apiClient.get(`/users/${userId}/followers`, { params: { page, limit } })
+    },
+    following(userId, page = 1, limit = 20) {
+      return apiClient.get(`/users/${userId}/following`, { params: { page, limit } })
+    },
+    followCounts(userId) {
+      return apiClient.get(`/users/${userId}/follow-counts`)
+    }
+  },
+
+  feed: {
+    // Always sends cursor, empty for the first page, to read the materialized timeline
+    home(cursor = '', limit = 10) {
+      return apiClient.get('/feed/home', { params: { cursor, limit } })
+    }
+  },
+
+  // Comments endpoints
+  comments: {
+    getByPost(postId, page = 1, limit = 20) {
+      return apiClient.get(`/posts/${postId}/comments`, { params: { page, limit } })
+    },
+    getReplies(postId, commentId, cursor, limit = 20) {
+      return apiClient.get(`/posts/${postId}/comments/${commentId}/replies`, { params: { cursor, limit } })
+    },
+    create(postId, comment) {
+      return apiClient.post(`/posts/${postId}/comments`, comment)
+    },
+    update(postId, commentId, comment) {
+      return apiClient.put(`/posts/${postId}/comments/${commentId}`, comment)
+    },
+    delete(postId, commentId) {
+      return apiClient.delete(`/posts/${postId}/comments/${commentId}`)
+    },
+    react(postId, commentId, type) {
+      return apiClient.put(`/posts/${postId}/comments/${commentId}/reaction`, { type })
+    },
+    unreact(postId, commentId) {
+      return apiClient.delete(`/posts/${postId}/comments/${commentId}/reaction`)
+    }
+  },
+
+  // Direct message endpoints
+  conversations: {
+    list(cursor, limit = 20) {
+      return apiClient.get('/conversations', { params: { cursor, limit } })
+    },
+    start(participantIds, title) {
+      return apiClient.post('/conversations', { participant_ids: participantIds, title })
+    },
+    get(conversationId) {
+      return apiClient.get(`/conversations/${conversationId}`)
+    },
+    messages(conversationId, cursor, limit = 50) {
+      return apiClient.get(`/conversations/${conversationId}/messages`, { params: { cursor, limit } })
+    },
+    send(conversationId, body) {
+      return apiClient.post(`/conversations/${conversationId}/messages`, { body })
+    },
+    markRead(conversationId, messageId) {
+      return apiClient.post(`/conversations/${conversationId}/read`, messageId ? { message_id: messageId } : undefined)
+    }
+  },
+
+  // Notification endpoints
+  notifications: {
+    list(cursor, limit = 20, unreadOnly = false) {
+      return apiClient.get('/notifications', { params: { cursor, limit, unread_only: unreadOnly } })
+    },
+    unreadCount() {
+      return apiClient.get('/notifications/unread-count')
+    },
+    markRead(notificationId) {
+      return apiClient.post(`/notifications/${notificationId}/read`)
+    },
+    markAllRead() {
+      return apiClient.post('/notifications/read-all')
     }
   }
 
@@ -0,0 +1,63 @@
+// Real-time events pushed by the server over Server-Sent Events.
+// One connection is shared by every store; EventSource reconnects by itself after a network error.
+// Events are not replayed after a reconnect, so stores should refetch when they need to be exact.
+
+const handlers = {}
+let source = null
+
+// Dispatches an event of the given type to its handlers
+const listen = (type) => {
+  source.addEventListener(type, (event) => {
+    const data = JSON.parse(event.data)
+    for (const handler of handlers[type] || []) {
+      handler(data)
+    }
+  })
+}
+
+// Opens the stream unless it is already open. Does nothing when the user is not signed in.
+export function connectStream() {
+  if (source) {
+    return source
+  }
+
+  const token = localStorage.getItem('access_token')
+  if (!token) {
+    return null
+  }
+
+  // EventSource cannot send an Authorization header, so the token goes in the query string
+  source = new EventSource(`${import.meta.env.VITE_API_URL}/stream?access_token=${encodeURIComponent(token)}`)
+  source.onerror = () => {
+    // A rejected token closes the stream for good; forget it so a later sign-in can reconnect
+    if (source && source.readyState === EventSource.CLOSED) {
+      source = null
+    }
+  }
+  Object.keys(handlers).forEach(listen)
+
+  return source
+}
+
+// Closes the stream, e.g. on logout
+export function disconnectStream() {
+  if (source) {
+    source.close()
+    source = null
+  }
+}
+
+// Registers a handler for an event type and returns a function that removes it
+export function onStreamEvent(type, handler) {
+  if (!handlers[type]) {
+    handlers[type] = []
+    if (source) {
+      listen(type)
+    }
+  }
+  handlers[type].push(handler)
+
+  return () => {
+    handlers[type] = handlers[type].filter(h => h !== handler)
+  }
+}
@@ -1,5 +1,7 @@
 import { defineStore } from 'pinia'
 import axios from 'axios'
+import api from '../services/api'
+import { disconnectStream } from '../services/stream'
 
 export const useAuthStore = defineStore('auth', {
   state: () => ({
@@ -17,72 +19,87 @@ export const useAuthStore = defineStore('auth', {
   },
 
   actions: {
-    async getMicrosoftLoginUrl() {
+    // Names of the identity providers the server offers, such as microsoft, oidc and dev
+    async getProviders() {
+      const response = await axios.get(`${import.meta.env.VITE_API_URL}/auth/providers`)
+      return response.data.providers
+    },
+
+    async getLoginUrl(provider = 'microsoft', loginHint) {
       try {
         this.loading = true
         this.error = null
 
-        const response = await axios.get(`${import.meta.env.VITE_API_URL}/auth/microsoft`)
+        // The response sets the state cookie the callback checks, so it must be stored
+        const response = await axios.get(`${import.meta.env.VITE_API_URL}/auth/${provider}`, {
+          params: loginHint ? { login_hint: loginHint } : undefined,
+          withCredentials: true
+        })
         return response.data.login_url
       } catch (error) {
-        this.error = error.response?.data?.message || 'Failed to get login URL'
+        this.error = error.response?.data?.error || 'Failed to get login URL'
         throw error
       } finally {
         this.loading = false
       }
     },
 
+    // Loads the signed-in user's profile, with their avatar and post and follow counts
     async getCurrentUser() {
-        try {
-            const response = await axios.get("/auth/me", {
-                headers: {
-                    Authorization: `Bearer ${localStorage.getItem("token")}`, // Include the JWT token
-                },
-            });
-    
-            // console.log("User Info:", response.data);
-            return response.data;
-        } catch (error) {
-            console.error("Failed to fetch user info:", error.response?.data || error.message);
-            throw error;
-        }
+      try {
+        const response = await api.auth.getCurrentUser()
+        this.user = response.data.user
+        return this.user
+      } catch (error) {
+        console.error('Failed to fetch user info:', error.response?.data || error.message)
+        throw error
+      }
+    },
+
+    async updateProfile(profile) {
+      try {
+        this.loading = true
+        this.error = null
+
+        const response = await api.auth.updateProfile(profile)
+        this.user = response.data.user
+        localStorage.setItem('user_name', this.user.name)
+        return this.user
+      } catch (error) {
+        this.error = error.response?.data?.error || 'Failed to update profile'
+        throw error
+      } finally {
+        this.loading = false
+      }
     },
 
-      async handleLoginCallback(code, user) {
+    // Exchanges the single-use code the login callback redirected with for the tokens and user
+    async handleLoginCallback(code) {
       try {
         this.loading = true
         this.error = null
 
-        // This would typically be handled by the backend
-        // For this example, we'll simulate a successful login
-        // this.user = {
-        //   id: 1,
-        //   name: 'Test User',
-        //   email: 'test@example.com'
-        // }
+        const response = await axios.post(`${import.meta.env.VITE_API_URL}/auth/exchange`, { code })
+        const { token, user } = response.data
 
         this.isAuthenticated = true
 
-        // Get the access token from the backend
-        const parsedCode = typeof code === 'string' ? JSON.parse(code) : code;
-        // Get the user info from the backend
-        const parsedUser = typeof user === 'string' ? JSON.parse(user) : user;
-        console.log("access token", parsedCode.access_token);
         // Assign user data to the store
         this.user = {
-          id: parsedUser.id,
-          name: parsedUser.name,
-          email: parsedUser.email
+          id: user.id,
+          name: user.name,
+          email: user.email
         }
 
         // Store auth token in localStorage
-        localStorage.setItem('access_token', parsedCode.access_token)
-        localStorage.setItem('user_id', parsedUser.id)
-        localStorage.setItem('user_name', parsedUser.name)
+        localStorage.setItem('access_token', token.access_token)
+        localStorage.setItem('refresh_token', token.refresh_token)
+        localStorage.setItem('user_id', user.id)
+        localStorage.setItem('user_name', user.name)
 
         return this.user
       } catch (error) {
-        this.error = error.response?.data?.message || 'Login failed'
+        this.error = error.response?.data?.error || 'Login failed'
         throw error
       } finally {
         this.loading = false
@@ -94,14 +111,9 @@ export const useAuthStore = defineStore('auth', {
         this.loading = true
         this.error = null
 
-        await axios.post(`${import.meta.env.VITE_API_URL}/auth/signout`)
+        await api.auth.signOut(localStorage.getItem('refresh_token'))
 
-        // Clear user data
-        this.user = null
-        this.isAuthenticated = false
-
-        // Remove auth token from localStorage
-        localStorage.removeItem('access_token')
+        this.clearSession()
       } catch (error) {
         this.error = error.response?.data?.message || 'Logout failed'
         throw error
@@ -110,6 +122,34 @@ export const useAuthStore = defineStore('auth', {
       }
     },
 
+    // Signs out of every device, including this one
+    async logoutEverywhere() {
+      try {
+        this.loading = true
+        this.error = null
+
+        await api.auth.signOutEverywhere()
+
+        this.clearSession()
+      } catch (error) {
+        this.error = error.response?.data?.error || 'Logout failed'
+        throw error
+      } finally {
+        this.loading = false
+      }
+    },
+
+    clearSession() {
+      // Clear user data
+      this.user = null
+      this.isAuthenticated = false
+
+      // Remove auth token from localStorage
+      localStorage.removeItem('access_token')
+      localStorage.removeItem('refresh_token')
+      disconnectStream()
+    },
+
     async checkAuth() {
       // Check if user is already authenticated
       const token = localStorage.getItem('access_token')
@@ -0,0 +1,102 @@
+import { defineStore } from 'pinia'
+import api from '../services/api'
+import { connectStream, onStreamEvent } from '../services/stream'
+
+// Removes the stream handler registered by subscribeToStream
+let unsubscribe = null
+
+export const useNotificationStore = defineStore('notifications', {
+  state: () => ({
+    notifications: [],
+    unreadCount: 0,
+    nextCursor: null,
+    hasMore: true,
+    loading: false,
+    error: null
+  }),
+
+  getters: {
+    getNotifications: (state) => state.notifications,
+    getUnreadCount: (state) => state.unreadCount,
+    getLoading: (state) => state.loading,
+    getError: (state) => state.error
+  },
+
+  actions: {
+    // Loads the next page of notifications. Pass reset to start from the most recent one.
+    async fetchNotifications(reset = false, limit = 20) {
+      if (!reset && !this.hasMore) {
+        return this.notifications
+      }
+
+      try {
+        this.loading = true
+        this.error = null
+
+        const response = await api.notifications.list(reset ? undefined : this.nextCursor || undefined, limit)
+
+        const page = response.data
+        this.notifications = reset ? page.notifications : [...this.notifications, ...page.notifications]
+        this.nextCursor = page.next_cursor || null
+        this.hasMore = page.has_more
+        this.unreadCount = page.unread_count
+
+        return this.notifications
+      } catch (error) {
+        this.error = error.response?.data?.error || 'Failed to fetch notifications'
+        throw error
+      } finally {
+        this.loading = false
+      }
+    },
+
+    async fetchUnreadCount() {
+      const response = await api.notifications.unreadCount()
+      this.unreadCount = response.data.unread_count
+      return this.unreadCount
+    },
+
+    async markRead(notificationId) {
+      await api.notifications.markRead(notificationId)
+
+      const notification = this.notifications.find(n => n.notification_id === notificationId)
+      if (notification && !notification.is_read) {
+        notification.is_read = true
+        this.unreadCount = Math.max(0, this.unreadCount - 1)
+      }
+    },
+
+    async markAllRead() {
+      await api.notifications.markAllRead()
+
+      this.notifications.forEach(notification => {
+        notification.is_read = true
+      })
+      this.unreadCount = 0
+    },
+
+    // Keeps the list and the unread count current from the server's event stream
+    subscribeToStream() {
+      if (unsubscribe) {
+        return
+      }
+
+      unsubscribe = onStreamEvent('notification', ({ notification, unread_count }) => {
+        // A grouped notification moves to the top when someone else joins it
+        this.notifications = [
+          notification,
+          ...this.notifications.filter(n => n.notification_id !== notification.notification_id)
+        ]
+        this.unreadCount = unread_count
+      })
+      connectStream()
+    },
+
+    unsubscribeFromStream() {
+      if (unsubscribe) {
+        unsubscribe()
+        unsubscribe = null
+      }
+    }
+  }
+})
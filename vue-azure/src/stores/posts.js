@@ -1,10 +1,18 @@
 import { defineStore } from 'pinia'
 import axios from 'axios'
+import { connectStream, onStreamEvent } from '../services/stream'
+
+// Remove the stream handlers registered by subscribeToStream
+let unsubscribers = []
 
 export const usePostStore = defineStore('posts', {
   state: () => ({
     posts: [],
     currentPost: {},
+    nextCursor: null,
+    hasMore: true,
+    // Comments received from the stream since the page was loaded, by post ID
+    newComments: {},
     loading: false,
     error: null
   }),
@@ -52,6 +60,42 @@ export const usePostStore = defineStore('posts', {
       }
     },
 
+    // Loads the next page of the feed for infinite scroll. Pass reset to start from the newest post.
+    async fetchFeedPage(reset = false, limit = 10) {
+      if (!reset && !this.hasMore) {
+        return this.posts
+      }
+
+      try {
+        this.loading = true
+        this.error = null
+
+        const params = { limit }
+        if (!reset && this.nextCursor) {
+          params.cursor = this.nextCursor
+        }
+
+        const response = await axios.get(`${import.meta.env.VITE_API_URL}/posts/feed`, {
+          params,
+          headers: {
+            Authorization: `Bearer ${localStorage.getItem('access_token')}`
+          }
+        })
+
+        const page = response.data
+        this.posts = reset ? page.posts : [...this.posts, ...page.posts]
+        this.nextCursor = page.next_cursor || null
+        this.hasMore = page.has_more
+
+        return this.posts
+      } catch (error) {
+        this.error = error.response?.data?.error || 'Failed to fetch posts'
+        throw error
+      } finally {
+        this.loading = false
+      }
+    },
+
     async fetchPostsById(id) {
       try {
         
@@ -156,6 +200,39 @@ export const usePostStore = defineStore('posts', {
       } finally {
         this.loading = false
       }
+    },
+
+    // Applies new posts, comments and reaction counts pushed by the server instead of polling
+    subscribeToStream() {
+      if (unsubscribers.length > 0) {
+        return
+      }
+
+      unsubscribers = [
+        onStreamEvent('post.created', (post) => {
+          // Our own posts are already in the list from createPost
+          if (!this.posts.some(p => p.post_id === post.post_id)) {
+            this.posts.unshift(post)
+          }
+        }),
+        onStreamEvent('post.reactions', ({ post_id, reactions, reaction_count, like_count }) => {
+          const post = this.posts.find(p => p.post_id === post_id)
+          if (post) {
+            post.reactions = reactions
+            post.reaction_count = reaction_count
+            post.like_count = like_count
+          }
+        }),
+        onStreamEvent('comment.created', ({ post_id, comment }) => {
+          this.newComments[post_id] = [...(this.newComments[post_id] || []), comment]
+        })
+      ]
+      connectStream()
+    },
+
+    unsubscribeFromStream() {
+      unsubscribers.forEach(unsubscribe => unsubscribe())
+      unsubscribers = []
     }
   }
 })
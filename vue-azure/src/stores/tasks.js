@@ -1,6 +1,21 @@
 import { defineStore } from 'pinia'
 import axios from 'axios'
 
+// findTask returns the task with the id among the top-level tasks and their subtasks
+function findTask(tasks, id) {
+  for (const task of tasks) {
+    if (task.id === id) {
+      return task
+    }
+    const subtask = (task.subtasks || []).find(subtask => subtask.id === id)
+    if (subtask) {
+      return subtask
+    }
+  }
+  return null
+}
+
+// The API lists top-level tasks, each with its subtasks nested under subtasks
 export const useTasksStore = defineStore('tasks', {
   state: () => ({
     tasks: [],
@@ -81,8 +96,18 @@ export const useTasksStore = defineStore('tasks', {
           }
         })
 
-        // Add the new task to the tasks array
-        this.tasks.push(response.data.task)
+        // Add the new task to the tasks array, or to the subtasks of its parent
+        const task = response.data.task
+        const parent = task.parent_task_id && this.tasks.find(t => t.id === task.parent_task_id)
+        if (parent) {
+          parent.subtasks = [...(parent.subtasks || []), task]
+          // An incomplete subtask reopens its parent
+          if (!task.completed) {
+            parent.completed = false
+          }
+        } else {
+          this.tasks.push(task)
+        }
 
         return response.data.tasks
       } catch (error) {
@@ -98,16 +123,25 @@ export const useTasksStore = defineStore('tasks', {
         this.loading = true
         this.error = null
 
-        const response = await axios.put(`${import.meta.env.VITE_API_URL}/tasks/${id}`, taskData, {
+        const response = await axios.patch(`${import.meta.env.VITE_API_URL}/tasks/${id}`, taskData, {
           headers: {
             Authorization: `Bearer ${localStorage.getItem('access_token')}`
           }
         })
 
-        // Update the task in the tasks array
-        const index = this.tasks.findIndex(task => task.id === id)
-        if (index !== -1) {
-          this.tasks[index] = response.data.task
+        // Update the task in the tasks array. Moving a task reorders the tasks around it, so
+        // the list is fetched again instead.
+        const task = response.data.task
+        const existing = findTask(this.tasks, id)
+        if (!existing || existing.parent_task_id !== task.parent_task_id || existing.position !== task.position) {
+          await this.fetchTasks()
+        } else {
+          Object.assign(existing, task)
+          // An incomplete subtask reopens its parent
+          const parent = task.parent_task_id && this.tasks.find(t => t.id === task.parent_task_id)
+          if (parent && !task.completed) {
+            parent.completed = false
+          }
         }
 
         // Update currentTask if it's the same task
@@ -135,8 +169,13 @@ export const useTasksStore = defineStore('tasks', {
           }
         })
 
-        // Remove the task from the tasks array
+        // Remove the task from the tasks array, or from the subtasks of its parent
         this.tasks = this.tasks.filter(task => task.id !== id)
+        for (const task of this.tasks) {
+          if (task.subtasks) {
+            task.subtasks = task.subtasks.filter(subtask => subtask.id !== id)
+          }
+        }
 
         // Clear currentTask if it's the same task
         if (this.currentTask && this.currentTask.id === id) {